@@ -0,0 +1,114 @@
+package go_modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// SerialNotDetectedError 没有检测到可用的串口参数
+var SerialNotDetectedError = errors.New("no working serial configuration found")
+
+const defaultDetectTimeout = 200 * time.Millisecond
+
+var (
+	defaultDetectBauds    = []int{9600, 19200, 38400, 57600, 115200, 4800, 2400, 1200}
+	defaultDetectDataBits = []byte{8}
+	defaultDetectParities = []Parity{ParityNone, ParityEven, ParityOdd}
+	defaultDetectStopBits = []byte{1, 2}
+)
+
+// SerialConfig 串口参数
+type SerialConfig struct {
+	Baud    int    //波特率
+	DataBit byte   //数据位
+	Parity  Parity //校验位
+	StopBit byte   //停止位
+}
+
+func (s SerialConfig) String() string {
+	return fmt.Sprintf("%d %d%c%d", s.Baud, s.DataBit, s.Parity, s.StopBit)
+}
+
+// DetectOptions 串口参数自动检测的参数矩阵，为空的项使用默认值
+type DetectOptions struct {
+	SlaveId     byte          //目标从站id，默认1
+	Bauds       []int         //波特率，默认9600,19200,38400,57600,115200,4800,2400,1200
+	DataBits    []byte        //数据位，默认8
+	Parities    []Parity      //校验位，默认N,E,O
+	StopBits    []byte        //停止位，默认1,2
+	Timeout     time.Duration //每次尝试的读超时，默认200ms
+	StatuteType StatuteType   //协议类型，默认ModbusRTU
+	//每次尝试后回调，err为nil表示成功，可为nil
+	OnAttempt func(config SerialConfig, err error)
+}
+
+// DetectSerial 按波特率、校验位、停止位、数据位的顺序逐个尝试打开串口并探测目标从站，返回第一个收到有效响应的参数
+// 探测请求为读1个地址为0的保持寄存器，校验通过的正常响应或异常响应都视为成功
+func DetectSerial(ctx context.Context, port string, options *DetectOptions) (*SerialConfig, error) {
+	if options == nil {
+		options = &DetectOptions{}
+	}
+	slaveId := options.SlaveId
+	if slaveId == 0 {
+		slaveId = 1
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultDetectTimeout
+	}
+	statuteType := options.StatuteType
+	if statuteType == "" {
+		statuteType = ModbusRTU
+	}
+	for _, baud := range orDefault(options.Bauds, defaultDetectBauds) {
+		for _, parity := range orDefault(options.Parities, defaultDetectParities) {
+			for _, stopBit := range orDefault(options.StopBits, defaultDetectStopBits) {
+				for _, dataBit := range orDefault(options.DataBits, defaultDetectDataBits) {
+					if err := ctx.Err(); err != nil {
+						return nil, err
+					}
+					config := SerialConfig{Baud: baud, DataBit: dataBit, Parity: parity, StopBit: stopBit}
+					err := probeSerial(port, config, slaveId, timeout, statuteType)
+					if options.OnAttempt != nil {
+						options.OnAttempt(config, err)
+					}
+					if err == nil {
+						return &config, nil
+					}
+				}
+			}
+		}
+	}
+	return nil, SerialNotDetectedError
+}
+
+// 用指定参数打开串口探测一次
+func probeSerial(port string, config SerialConfig, slaveId byte, timeout time.Duration, statuteType StatuteType) error {
+	rtu, err := NewModbusRTUPacket(port, config.Baud, config.DataBit, config.Parity, config.StopBit, timeout, 0, statuteType)
+	if err != nil {
+		return err
+	}
+	if err = rtu.Connect(); err != nil {
+		return err
+	}
+	defer rtu.Close()
+	//丢弃切换参数前残留的字节
+	_ = rtu.Flush()
+	_, err = rtu.readHoldingRegisters(noRetry, slaveId, 0, 1)
+	var abnormal *statute.ReturnedAbnormalFuncCode
+	if errors.As(err, &abnormal) {
+		return nil
+	}
+	return err
+}
+
+func orDefault[S ~[]E, E any](values, def S) S {
+	if len(values) == 0 {
+		return def
+	}
+	return values
+}
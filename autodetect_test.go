@@ -0,0 +1,53 @@
+package go_modbus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDetectSerialOrder(t *testing.T) {
+	var attempts []string
+	options := &DetectOptions{
+		Bauds:    []int{9600, 19200},
+		Parities: []Parity{ParityNone, ParityEven},
+		StopBits: []byte{1, 2},
+		OnAttempt: func(config SerialConfig, err error) {
+			if err == nil {
+				t.Errorf("attempt %s succeeded on a missing port", config)
+			}
+			attempts = append(attempts, config.String())
+		},
+	}
+	_, err := DetectSerial(context.Background(), "/dev/go-modbus-missing", options)
+	if !errors.Is(err, SerialNotDetectedError) {
+		t.Fatalf("error = %v, want %v", err, SerialNotDetectedError)
+	}
+	want := []string{"9600 8N1", "9600 8N2", "9600 8E1", "9600 8E2", "19200 8N1", "19200 8N2", "19200 8E1", "19200 8E2"}
+	if !reflect.DeepEqual(attempts, want) {
+		t.Fatalf("attempts = %v, want %v", attempts, want)
+	}
+}
+
+func TestDetectSerialCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	_, err := DetectSerial(ctx, "/dev/go-modbus-missing", &DetectOptions{OnAttempt: func(SerialConfig, error) {
+		attempts++
+		cancel()
+	}})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Fatalf("error = %v after %d attempts", err, attempts)
+	}
+}
+
+func TestSerialReadError(t *testing.T) {
+	if err := serialReadError(io.EOF); !errors.Is(err, ReadTimeoutError) || !errors.Is(err, io.EOF) {
+		t.Fatalf("serialReadError(EOF) = %v", err)
+	}
+	if err := serialReadError(io.ErrClosedPipe); err != io.ErrClosedPipe {
+		t.Fatalf("serialReadError(ErrClosedPipe) = %v", err)
+	}
+}
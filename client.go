@@ -0,0 +1,28 @@
+package go_modbus
+
+import "github.com/VaccariaSeed/go-modbus/statute"
+
+// Client MODBUS客户端的全部操作，ModbusTCPPacket和ModbusRTUPacket都实现了该接口
+// 业务代码依赖Client而不是具体的连接类型时，可以在测试中注入mock.Client
+type Client interface {
+	Connect() error
+	Close() error
+	Flush() error
+	ReadCoils(slaveId byte, address, number uint16) (length uint16, result []statute.CoilStatus, err error)
+	ReadDiscreteInputs(slaveId byte, address, number uint16) (length uint16, result []statute.CoilStatus, err error)
+	ReadHoldingRegisters(slaveId byte, address, number uint16) ([]byte, error)
+	ReadInputRegisters(slaveId byte, address, number uint16) ([]byte, error)
+	WriteSingleCoil(slaveId byte, address uint16, value statute.CoilStatus) (addr uint16, status statute.CoilStatus, err error)
+	WriteSingleRegister(slaveId byte, address uint16, value uint16) (addr, status uint16, err error)
+	WriteMultipleCoils(slaveId byte, address uint16, status ...statute.CoilStatus) (addr, size uint16, err error)
+	WriteMultipleRegisters(slaveId byte, address uint16, value ...uint16) (addr, number uint16, err error)
+	ReportServerId(slaveId byte) ([]byte, error)
+	CustomRequest(slaveId, funcCode byte, data []byte) ([]byte, error)
+	Broadcast(funcCode byte, data []byte) error
+	Unit() byte
+}
+
+var (
+	_ Client = (*ModbusTCPPacket)(nil)
+	_ Client = (*ModbusRTUPacket)(nil)
+)
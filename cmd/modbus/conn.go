@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+)
+
+// 连接参数，与NewModbusTCPPacket和NewModbusRTUPacket的参数对应
+type connFlags struct {
+	host           string
+	port           int
+	serial         string
+	baud           int
+	dataBits       int
+	parity         string
+	stopBits       int
+	codec          string
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	interval       time.Duration
+	slave          int
+	trace          bool
+}
+
+func (c *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.host, "host", "", "TCP host of the device")
+	fs.IntVar(&c.port, "port", 502, "TCP port of the device")
+	fs.StringVar(&c.serial, "serial", "", "serial port, e.g. /dev/ttyUSB0 or COM3")
+	fs.IntVar(&c.baud, "baud", 9600, "serial baud rate")
+	fs.IntVar(&c.dataBits, "databits", 8, "serial data bits")
+	fs.StringVar(&c.parity, "parity", "N", "serial parity: N, E or O")
+	fs.IntVar(&c.stopBits, "stopbits", 1, "serial stop bits: 1 or 2")
+	fs.StringVar(&c.codec, "codec", "", "framing: tcp or rtu (default tcp for -host, rtu for -serial)")
+	fs.DurationVar(&c.connectTimeout, "connect-timeout", 3*time.Second, "TCP connect timeout")
+	fs.DurationVar(&c.readTimeout, "read-timeout", 2*time.Second, "read timeout")
+	fs.DurationVar(&c.writeTimeout, "write-timeout", 2*time.Second, "TCP write timeout")
+	fs.DurationVar(&c.interval, "interval", 20*time.Millisecond, "delay between writing a request and reading the response")
+	fs.IntVar(&c.slave, "slave", 1, "slave id / unit id")
+	fs.BoolVar(&c.trace, "trace", false, "print a hex dump of every frame to stderr")
+}
+
+func (c *connFlags) statuteType() (modbus.StatuteType, error) {
+	switch strings.ToLower(c.codec) {
+	case "":
+		if c.serial != "" {
+			return modbus.ModbusRTU, nil
+		}
+		return modbus.ModbusTCP, nil
+	case "tcp":
+		return modbus.ModbusTCP, nil
+	case "rtu":
+		return modbus.ModbusRTU, nil
+	}
+	return "", errors.New("invalid -codec, want tcp or rtu")
+}
+
+func (c *connFlags) slaveId() (byte, error) {
+	if c.slave < 0 || c.slave > 255 {
+		return 0, errors.New("invalid -slave, want 0-255")
+	}
+	return byte(c.slave), nil
+}
+
+// 按参数创建连接并连接
+func (c *connFlags) open() (modbus.Client, error) {
+	cli, err := c.build()
+	if err != nil {
+		return nil, err
+	}
+	if err = cli.Connect(); err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// 按参数创建连接，不连接，-trace时为连接设置报文追踪
+func (c *connFlags) build() (modbus.Client, error) {
+	statuteType, err := c.statuteType()
+	if err != nil {
+		return nil, err
+	}
+	var cli modbus.Client
+	var packet *modbus.ModbusPacket
+	switch {
+	case c.host != "" && c.serial != "":
+		return nil, errors.New("-host and -serial are mutually exclusive")
+	case c.host != "":
+		tcp, err := modbus.NewModbusTCPPacket(c.host, c.port, c.connectTimeout, c.readTimeout, c.writeTimeout, c.interval, statuteType)
+		if err != nil {
+			return nil, err
+		}
+		cli, packet = tcp, tcp.ModbusPacket
+	case c.serial != "":
+		parity, err := modbus.ParseParity(c.parity)
+		if err != nil {
+			return nil, err
+		}
+		rtu, err := modbus.NewModbusRTUPacket(c.serial, c.baud, byte(c.dataBits), parity, byte(c.stopBits), c.readTimeout, c.interval, statuteType)
+		if err != nil {
+			return nil, err
+		}
+		cli, packet = rtu, rtu.ModbusPacket
+	default:
+		return nil, errors.New("either -host or -serial is required")
+	}
+	if c.trace {
+		packet.SetTracer(modbus.NewHexDumpTracer(stderr))
+	}
+	return cli, nil
+}
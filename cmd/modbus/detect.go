@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+)
+
+func init() {
+	register(&command{name: "detect", usage: "detect baud rate, parity and stop bits of an RTU slave", run: detect})
+}
+
+func detect(args []string) error {
+	fs := newFlagSet("detect")
+	serial := fs.String("serial", "", "serial port, e.g. /dev/ttyUSB0 or COM3")
+	slave := fs.Uint("slave", 1, "slave id to probe")
+	bauds := fs.String("bauds", "9600,19200,38400,57600,115200,4800,2400,1200", "comma separated baud rates to try")
+	dataBits := fs.String("databits", "8", "comma separated data bits to try")
+	parities := fs.String("parities", "N,E,O", "comma separated parities to try")
+	stopBits := fs.String("stopbits", "1,2", "comma separated stop bits to try")
+	timeout := fs.Duration("probe-timeout", 200*time.Millisecond, "read timeout of each attempt")
+	verbose := fs.Bool("v", false, "print every attempt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *serial == "" {
+		return fmt.Errorf("-serial is required")
+	}
+	if *slave == 0 || *slave > 247 {
+		return fmt.Errorf("invalid -slave, want 1-247")
+	}
+	options := &modbus.DetectOptions{SlaveId: byte(*slave), Timeout: *timeout}
+	var err error
+	if options.Bauds, err = parseList(*bauds, strconv.Atoi); err != nil {
+		return err
+	}
+	if options.DataBits, err = parseList(*dataBits, parseByte); err != nil {
+		return err
+	}
+	if options.StopBits, err = parseList(*stopBits, parseByte); err != nil {
+		return err
+	}
+	if options.Parities, err = parseList(*parities, modbus.ParseParity); err != nil {
+		return err
+	}
+	if *verbose {
+		options.OnAttempt = func(config modbus.SerialConfig, err error) {
+			if err != nil {
+				fmt.Fprintf(stderr, "%-14s %v\n", config, err)
+			}
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	config, err := modbus.DetectSerial(ctx, *serial, options)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "found: -baud %d -databits %d -parity %c -stopbits %d\n", config.Baud, config.DataBit, config.Parity, config.StopBit)
+	return nil
+}
+
+func parseList[T any](s string, parse func(string) (T, error)) ([]T, error) {
+	var values []T
+	for _, item := range strings.Split(s, ",") {
+		value, err := parse(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func parseByte(s string) (byte, error) {
+	value, err := strconv.ParseUint(s, 10, 8)
+	return byte(value), err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func init() {
+	register(&command{name: "explain", usage: "decode a hex or ASCII frame field by field", run: explain})
+}
+
+func explain(args []string) error {
+	fs := newFlagSet("explain")
+	codec := fs.String("codec", "", "framing: tcp, rtu or ascii (default detected from the frame)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	input := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if input == "" {
+		return errors.New("a frame is required, e.g. modbus explain 01 03 00 00 00 02 c4 0b")
+	}
+	var frame []byte
+	kind := statute.FrameKind(strings.ToLower(*codec))
+	if kind == statute.FrameASCII || (kind == "" && strings.HasPrefix(input, ":")) {
+		kind, frame = statute.FrameASCII, []byte(input)
+	} else {
+		var err error
+		if frame, err = parseHex(input); err != nil {
+			return err
+		}
+		if kind == "" {
+			kind = detectKind(frame)
+		}
+	}
+	description, err := statute.Describe(frame, kind)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s frame, %d bytes\n", strings.ToUpper(string(kind)), len(frame))
+	fmt.Fprint(stdout, description)
+	return nil
+}
+
+// 解析十六进制，忽略空格、逗号和0x前缀
+func parseHex(s string) ([]byte, error) {
+	s = strings.NewReplacer("0x", "", "0X", "", ",", "", " ", "", "\t", "", "\n", "").Replace(s)
+	frame, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex frame: %w", err)
+	}
+	return frame, nil
+}
+
+// CRC正确时为RTU，MBAP头的长度与报文一致时为TCP，否则按RTU解析
+func detectKind(frame []byte) statute.FrameKind {
+	if len(frame) >= 4 && bytes.Equal(statute.Crc16(frame[:len(frame)-2]), frame[len(frame)-2:]) {
+		return statute.FrameRTU
+	}
+	if len(frame) >= 8 && binary.BigEndian.Uint16(frame[2:]) == 0 && int(binary.BigEndian.Uint16(frame[4:])) == len(frame)-6 {
+		return statute.FrameTCP
+	}
+	return statute.FrameRTU
+}
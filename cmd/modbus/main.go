@@ -0,0 +1,65 @@
+// modbus 现场调试用的命令行工具
+//
+//	modbus <command> [flags] [values...]
+//
+// 使用 modbus help 查看所有命令
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// 子命令
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []*command
+
+func register(c *command) {
+	commands = append(commands, c)
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage()
+		return
+	}
+	index := slices.IndexFunc(commands, func(c *command) bool { return c.name == os.Args[1] })
+	if index < 0 {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := commands[index].run(os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	var sb strings.Builder
+	sb.WriteString("usage: modbus <command> [flags] [values...]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&sb, "  %-16s %s\n", c.name, c.usage)
+	}
+	sb.WriteString("\nrun 'modbus <command> -h' for the flags of a command\n")
+	fmt.Fprint(os.Stderr, sb.String())
+}
+
+// 创建子命令的FlagSet
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
+
+// 输出参数
+type outputFlags struct {
+	format    string
+	valueType string
+	order     string
+}
+
+func (o *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", "table", "output format: table, hex, json or value")
+	fs.StringVar(&o.valueType, "type", "uint16", "register value type: uint16, int16, uint32, int32, float32, uint64, int64, float64")
+	fs.StringVar(&o.order, "order", "ABCD", "byte order of multi-register values: ABCD, DCBA, BADC or CDAB")
+}
+
+func (o *outputFlags) parse() (statute.ValueType, statute.ByteOrder, error) {
+	valueType, err := statute.ParseValueType(o.valueType)
+	if err != nil {
+		return "", "", err
+	}
+	order, err := statute.ParseByteOrder(o.order)
+	if err != nil {
+		return "", "", err
+	}
+	switch o.format {
+	case "table", "hex", "json", "value":
+		return valueType, order, nil
+	}
+	return "", "", errors.New("invalid -format, want table, hex, json or value")
+}
+
+// 输出寄存器
+func (o *outputFlags) printRegisters(address uint16, data []byte) error {
+	valueType, order, err := o.parse()
+	if err != nil {
+		return err
+	}
+	if o.format == "hex" {
+		_, err = io.WriteString(stdout, hex.Dump(data))
+		return err
+	}
+	values, err := statute.DecodeValues(data, valueType, order)
+	if err != nil {
+		return err
+	}
+	size := valueType.Registers() * 2
+	switch o.format {
+	case "json":
+		return printJSON(map[string]any{
+			"address": address,
+			"type":    valueType,
+			"order":   order,
+			"raw":     hex.EncodeToString(data),
+			"values":  values,
+		})
+	case "value":
+		for _, value := range values {
+			fmt.Fprintln(stdout, value)
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ADDRESS\tRAW\t%s\n", strings.ToUpper(string(valueType)))
+	for index, value := range values {
+		fmt.Fprintf(w, "%d\t%s\t%v\n", int(address)+index*valueType.Registers(), hex.EncodeToString(data[index*size:(index+1)*size]), value)
+	}
+	return w.Flush()
+}
+
+// 输出线圈或离散输入
+func (o *outputFlags) printBits(address uint16, status []statute.CoilStatus) error {
+	if _, _, err := o.parse(); err != nil {
+		return err
+	}
+	switch o.format {
+	case "hex":
+		packed := make([]byte, (len(status)+7)/8)
+		for index, on := range status {
+			if on {
+				packed[index/8] |= 1 << (index % 8)
+			}
+		}
+		_, err := io.WriteString(stdout, hex.Dump(packed))
+		return err
+	case "json":
+		return printJSON(map[string]any{"address": address, "values": status})
+	case "value":
+		for _, on := range status {
+			fmt.Fprintln(stdout, bitString(on))
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tVALUE")
+	for index, on := range status {
+		fmt.Fprintf(w, "%d\t%s\n", int(address)+index, bitString(on))
+	}
+	return w.Flush()
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func bitString(on statute.CoilStatus) string {
+	if on {
+		return "1"
+	}
+	return "0"
+}
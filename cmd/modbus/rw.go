@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func init() {
+	register(&command{name: "read-coils", usage: "read coils (0x01)", run: readBits(statute.ReadCoils)})
+	register(&command{name: "read-discrete", usage: "read discrete inputs (0x02)", run: readBits(statute.ReadDiscreteInputs)})
+	register(&command{name: "read-holding", usage: "read holding registers (0x03)", run: readRegisters(statute.ReadHoldingRegisters)})
+	register(&command{name: "read-input", usage: "read input registers (0x04)", run: readRegisters(statute.ReadInputRegisters)})
+	register(&command{name: "write-coil", usage: "write a single coil (0x05): write-coil -addr N on|off", run: writeCoils(false)})
+	register(&command{name: "write-coils", usage: "write multiple coils (0x0F): write-coils -addr N 1 0 1 ...", run: writeCoils(true)})
+	register(&command{name: "write-register", usage: "write register values (0x06, or 0x10 for several or wide values)", run: writeRegisters})
+}
+
+// 读线圈或离散输入
+func readBits(funcCode byte) func(args []string) error {
+	return func(args []string) error {
+		fs := newFlagSet(statute.FuncCodeName(funcCode))
+		var conn connFlags
+		var output outputFlags
+		conn.register(fs)
+		output.register(fs)
+		address := fs.Uint("addr", 0, "start address")
+		count := fs.Uint("count", 1, "number of bits")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		slaveId, err := conn.slaveId()
+		if err != nil {
+			return err
+		}
+		if *address > 0xFFFF || *count == 0 || *count > 2000 {
+			return errors.New("invalid -addr or -count")
+		}
+		cli, err := conn.open()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+		var status []statute.CoilStatus
+		if funcCode == statute.ReadCoils {
+			_, status, err = cli.ReadCoils(slaveId, uint16(*address), uint16(*count))
+		} else {
+			_, status, err = cli.ReadDiscreteInputs(slaveId, uint16(*address), uint16(*count))
+		}
+		if err != nil {
+			return err
+		}
+		return output.printBits(uint16(*address), status)
+	}
+}
+
+// 读保持寄存器或输入寄存器
+func readRegisters(funcCode byte) func(args []string) error {
+	return func(args []string) error {
+		fs := newFlagSet(statute.FuncCodeName(funcCode))
+		var conn connFlags
+		var output outputFlags
+		conn.register(fs)
+		output.register(fs)
+		address := fs.Uint("addr", 0, "start address")
+		count := fs.Uint("count", 1, "number of values of -type to read")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		slaveId, err := conn.slaveId()
+		if err != nil {
+			return err
+		}
+		valueType, _, err := output.parse()
+		if err != nil {
+			return err
+		}
+		number := *count * uint(valueType.Registers())
+		if *address > 0xFFFF || number == 0 || number > 125 {
+			return errors.New("invalid -addr or -count")
+		}
+		cli, err := conn.open()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+		var data []byte
+		if funcCode == statute.ReadHoldingRegisters {
+			data, err = cli.ReadHoldingRegisters(slaveId, uint16(*address), uint16(number))
+		} else {
+			data, err = cli.ReadInputRegisters(slaveId, uint16(*address), uint16(number))
+		}
+		if err != nil {
+			return err
+		}
+		return output.printRegisters(uint16(*address), data)
+	}
+}
+
+// 写线圈
+func writeCoils(multiple bool) func(args []string) error {
+	return func(args []string) error {
+		name := "write-coil"
+		if multiple {
+			name = "write-coils"
+		}
+		fs := newFlagSet(name)
+		var conn connFlags
+		conn.register(fs)
+		address := fs.Uint("addr", 0, "start address")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		slaveId, err := conn.slaveId()
+		if err != nil {
+			return err
+		}
+		if *address > 0xFFFF || fs.NArg() == 0 || (!multiple && fs.NArg() != 1) {
+			return fmt.Errorf("usage: %s -addr N value...", name)
+		}
+		status := make([]statute.CoilStatus, 0, fs.NArg())
+		for _, arg := range fs.Args() {
+			on, err := parseBit(arg)
+			if err != nil {
+				return err
+			}
+			status = append(status, on)
+		}
+		cli, err := conn.open()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+		if !multiple {
+			addr, value, err := cli.WriteSingleCoil(slaveId, uint16(*address), status[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "wrote coil %d = %s\n", addr, bitString(value))
+			return nil
+		}
+		addr, size, err := cli.WriteMultipleCoils(slaveId, uint16(*address), status...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "wrote %d coils at %d\n", size, addr)
+		return nil
+	}
+}
+
+// 写寄存器，单个16位值使用0x06，其余使用0x10
+func writeRegisters(args []string) error {
+	fs := newFlagSet("write-register")
+	var conn connFlags
+	var output outputFlags
+	conn.register(fs)
+	output.register(fs)
+	address := fs.Uint("addr", 0, "start address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	slaveId, err := conn.slaveId()
+	if err != nil {
+		return err
+	}
+	valueType, order, err := output.parse()
+	if err != nil {
+		return err
+	}
+	if *address > 0xFFFF || fs.NArg() == 0 {
+		return errors.New("usage: write-register -addr N [-type T -order O] value...")
+	}
+	var registers []uint16
+	for _, arg := range fs.Args() {
+		value, err := statute.ParseValue(arg, valueType)
+		if err != nil {
+			return err
+		}
+		encoded, err := statute.EncodeValue(value, valueType, order)
+		if err != nil {
+			return err
+		}
+		registers = append(registers, encoded...)
+	}
+	if len(registers) > 123 {
+		return errors.New("too many values, at most 123 registers can be written at once")
+	}
+	cli, err := conn.open()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	if len(registers) == 1 {
+		addr, value, err := cli.WriteSingleRegister(slaveId, uint16(*address), registers[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "wrote register %d = %d (0x%04x)\n", addr, value, value)
+		return nil
+	}
+	addr, number, err := cli.WriteMultipleRegisters(slaveId, uint16(*address), registers...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "wrote %d registers at %d\n", number, addr)
+	return nil
+}
+
+func parseBit(s string) (statute.CoilStatus, error) {
+	switch strings.ToLower(s) {
+	case "1", "on", "true":
+		return statute.ON, nil
+	case "0", "off", "false":
+		return statute.OFF, nil
+	}
+	return statute.OFF, fmt.Errorf("invalid coil value %q, want 1/0, on/off or true/false", s)
+}
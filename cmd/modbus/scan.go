@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+)
+
+func init() {
+	register(&command{name: "scan", usage: "scan an RTU bus for responding slave ids", run: scan})
+}
+
+func scan(args []string) error {
+	fs := newFlagSet("scan")
+	var conn connFlags
+	conn.register(fs)
+	from := fs.Uint("from", 1, "first slave id")
+	to := fs.Uint("to", 247, "last slave id")
+	timeout := fs.Duration("probe-timeout", 100*time.Millisecond, "read timeout of each probe")
+	serverId := fs.Bool("server-id", false, "read Report Server ID (0x11) from each responding slave")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == 0 || *to > 247 || *from > *to {
+		return errors.New("invalid -from or -to, want 1-247")
+	}
+	if conn.serial == "" {
+		return errors.New("-serial is required")
+	}
+	cli, err := conn.build()
+	if err != nil {
+		return err
+	}
+	rtu := cli.(*modbus.ModbusRTUPacket)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	const row = "%-6s %-8s %-15s %s\n"
+	fmt.Fprintf(stdout, row, "SLAVE", "LATENCY", "RESPONSE", "SERVER ID")
+	results, err := rtu.Scan(ctx, &modbus.ScanOptions{
+		From:           byte(*from),
+		To:             byte(*to),
+		Timeout:        *timeout,
+		ReportServerId: *serverId,
+		OnResult: func(result *modbus.ScanResult) {
+			response := "ok"
+			if result.ExceptionCode != 0 {
+				response = fmt.Sprintf("exception 0x%02x", result.ExceptionCode)
+			}
+			id := "-"
+			if result.ServerIdErr != nil {
+				id = result.ServerIdErr.Error()
+			} else if result.ServerId != nil {
+				id = hex.EncodeToString(result.ServerId)
+			}
+			fmt.Fprintf(stdout, row, strconv.Itoa(int(result.SlaveId)), result.Latency.Round(time.Millisecond), response, id)
+		},
+	})
+	fmt.Fprintf(stderr, "%d slave(s) found\n", len(results))
+	_ = rtu.Close()
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/statute"
+	"github.com/tarm/serial"
+)
+
+func init() {
+	register(&command{name: "sniff", usage: "passively decode traffic of another master on a bus", run: sniff})
+}
+
+func sniff(args []string) error {
+	fs := newFlagSet("sniff")
+	var conn connFlags
+	fs.StringVar(&conn.serial, "serial", "", "serial port attached to the bus, e.g. /dev/ttyUSB0")
+	fs.IntVar(&conn.baud, "baud", 9600, "serial baud rate")
+	fs.IntVar(&conn.dataBits, "databits", 8, "serial data bits")
+	fs.StringVar(&conn.parity, "parity", "N", "serial parity: N, E or O")
+	fs.IntVar(&conn.stopBits, "stopbits", 1, "serial stop bits: 1 or 2")
+	fs.StringVar(&conn.host, "host", "", "TCP host streaming raw bus traffic, e.g. a serial device server or a mirror port")
+	fs.IntVar(&conn.port, "port", 502, "TCP port")
+	file := fs.String("file", "", "raw capture file to decode, - for stdin")
+	codec := fs.String("codec", "", "framing: tcp or rtu (default tcp for -host, rtu otherwise)")
+	dump := fs.Bool("hex", false, "print the raw frames of every transaction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	kind := statute.FrameRTU
+	switch strings.ToLower(*codec) {
+	case "":
+		if conn.host != "" {
+			kind = statute.FrameTCP
+		}
+	case "tcp":
+		kind = statute.FrameTCP
+	case "rtu":
+	default:
+		return errors.New("invalid -codec, want tcp or rtu")
+	}
+	source, err := openSource(&conn, *file)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = source.Close()
+	}()
+	sniffer := statute.NewSniffer(source, kind)
+	for {
+		transaction, err := sniffer.Next()
+		if err != nil {
+			if skipped := sniffer.Skipped(); skipped > 0 {
+				fmt.Fprintf(stderr, "%d bytes skipped while resynchronizing\n", skipped)
+			}
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		frame := transaction.Request
+		if frame == nil {
+			frame = transaction.Response
+		}
+		fmt.Fprintf(stdout, "%s %s\n", frame.Time.Format("15:04:05.000"), transaction)
+		if *dump {
+			if transaction.Request != nil {
+				fmt.Fprintf(stdout, "  TX %s\n", hex.EncodeToString(transaction.Request.Frame))
+			}
+			if transaction.Response != nil {
+				fmt.Fprintf(stdout, "  RX %s\n", hex.EncodeToString(transaction.Response.Frame))
+			}
+		}
+	}
+}
+
+// 打开监听的数据源，串口只读不写
+func openSource(conn *connFlags, file string) (io.ReadCloser, error) {
+	sources := 0
+	for _, set := range []bool{conn.serial != "", conn.host != "", file != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.New("exactly one of -serial, -host or -file is required")
+	}
+	switch {
+	case file == "-":
+		return io.NopCloser(os.Stdin), nil
+	case file != "":
+		return os.Open(file)
+	case conn.host != "":
+		return net.DialTimeout("tcp", net.JoinHostPort(conn.host, strconv.Itoa(conn.port)), 3*time.Second)
+	}
+	parity, err := modbus.ParseParity(conn.parity)
+	if err != nil {
+		return nil, err
+	}
+	return serial.OpenPort(&serial.Config{Name: conn.serial, Baud: conn.baud, Size: byte(conn.dataBits), Parity: serial.Parity(parity), StopBits: serial.StopBits(conn.stopBits)})
+}
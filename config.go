@@ -0,0 +1,348 @@
+package go_modbus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 连接URL的scheme，同时作为ClientConfig.Protocol的取值
+const (
+	SchemeTCP        = "tcp"        //Modbus TCP
+	SchemeRTUOverTCP = "rtuovertcp" //TCP上传输RTU帧，如串口服务器
+	SchemeUDP        = "udp"        //UDP上传输MBAP帧
+	SchemeRTUOverUDP = "rtuoverudp" //UDP上传输RTU帧
+	SchemeRTU        = "rtu"        //串口
+	SchemeTLS        = "tls"        //Modbus/TCP Security，默认端口802
+)
+
+const (
+	defaultPort     = 502
+	defaultUnit     = 1
+	defaultBaud     = 9600
+	defaultDataBits = 8
+	defaultStopBits = 1
+)
+
+// Duration 可以用"2s"、"500ms"等格式写在配置文件中的时长
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// ClientConfig 客户端配置，可以由ParseClientURL解析，也可以从JSON/YAML加载
+// 时长为0、串口参数为空时使用默认值，直接构造结构体时Unit需要显式设置
+type ClientConfig struct {
+	Protocol       string   `json:"protocol" yaml:"protocol"`                                 //tcp、rtuovertcp、udp、rtuoverudp、tls或rtu
+	Address        string   `json:"address" yaml:"address"`                                   //host:port，或串口号
+	Unit           byte     `json:"unit" yaml:"unit"`                                         //从站id，通过Client.Unit获取，URL和配置文件中省略时为1
+	ConnectTimeout Duration `json:"connectTimeout,omitempty" yaml:"connectTimeout,omitempty"` //连接超时，仅TCP
+	ReadTimeout    Duration `json:"readTimeout,omitempty" yaml:"readTimeout,omitempty"`       //读超时
+	WriteTimeout   Duration `json:"writeTimeout,omitempty" yaml:"writeTimeout,omitempty"`     //写超时，仅网络
+	Interval       Duration `json:"interval,omitempty" yaml:"interval,omitempty"`             //读写间隔
+	Baud           int      `json:"baud,omitempty" yaml:"baud,omitempty"`                     //波特率，默认9600
+	DataBits       int      `json:"dataBits,omitempty" yaml:"dataBits,omitempty"`             //数据位，默认8
+	Parity         string   `json:"parity,omitempty" yaml:"parity,omitempty"`                 //N、E或O，默认N
+	StopBits       int      `json:"stopBits,omitempty" yaml:"stopBits,omitempty"`             //停止位，默认1
+	Backups        []string `json:"backups,omitempty" yaml:"backups,omitempty"`               //冗余端点host:port，仅网络
+	Failures       int      `json:"failures,omitempty" yaml:"failures,omitempty"`             //连续失败多少次后切换端点，默认1
+	FailBack       Duration `json:"failBack,omitempty" yaml:"failBack,omitempty"`             //切换后每隔多久尝试回到主端点，0表示不回切
+	CertFile       string   `json:"certFile,omitempty" yaml:"certFile,omitempty"`             //TLS客户端证书，PEM
+	KeyFile        string   `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`               //TLS客户端私钥，PEM
+	CAFile         string   `json:"caFile,omitempty" yaml:"caFile,omitempty"`                 //校验服务端证书的CA，PEM，为空时使用系统CA
+	ServerName     string   `json:"serverName,omitempty" yaml:"serverName,omitempty"`         //校验服务端证书的主机名，为空时使用地址中的主机名
+	MaxAttempts    int      `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`       //最多尝试次数，大于1时按DefaultRetryable重试读请求
+	RetryBackoff   Duration `json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty"`     //第一次重试前的等待时间，之后每次翻倍
+}
+
+// ParseClientURL 解析连接URL，如：
+//
+//	tcp://10.0.0.5:502?unit=3&timeout=2s
+//	rtuovertcp://host:4001
+//	udp://10.0.0.5
+//	rtu:///dev/ttyUSB0?baud=9600&parity=E&stop=1
+//	rtu://COM3?baud=19200
+//	tcp://plc-a:502?backup=plc-b:502&failback=1m
+//	tls://plc-a?cert=client.pem&key=client.key&ca=ca.pem
+//	tcp://10.0.0.5?attempts=3&backoff=100ms
+//
+// 网络地址省略端口时使用502，tls使用802，unit默认1
+// 支持的参数：unit、timeout(读超时)、connect_timeout、write_timeout、interval、baud、databits、parity、stop、
+// backup(冗余端点，可以有多个)、failures、failback、cert、key、ca、server_name、attempts、backoff
+func ParseClientURL(rawURL string) (*ClientConfig, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &ClientConfig{Protocol: strings.ToLower(u.Scheme), Unit: defaultUnit}
+	switch c.Protocol {
+	case SchemeTCP, SchemeRTUOverTCP, SchemeUDP, SchemeRTUOverUDP, SchemeTLS:
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("missing host in %q", rawURL)
+		}
+		port := u.Port()
+		if port == "" {
+			port = strconv.Itoa(c.defaultPort())
+		}
+		c.Address = net.JoinHostPort(u.Hostname(), port)
+	case SchemeRTU:
+		c.Address = u.Host + u.Path
+		if c.Address == "" {
+			return nil, fmt.Errorf("missing serial port in %q", rawURL)
+		}
+	default:
+		return nil, fmt.Errorf("unknown scheme:%s", u.Scheme)
+	}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		switch key {
+		case "backup":
+			c.Backups = append(c.Backups, values...)
+		case "failures":
+			err = parseUint(value, 16, func(v uint64) { c.Failures = int(v) })
+		case "failback":
+			err = c.FailBack.UnmarshalText([]byte(value))
+		case "unit":
+			err = parseUint(value, 8, func(v uint64) { c.Unit = byte(v) })
+		case "timeout":
+			err = c.ReadTimeout.UnmarshalText([]byte(value))
+		case "connect_timeout":
+			err = c.ConnectTimeout.UnmarshalText([]byte(value))
+		case "write_timeout":
+			err = c.WriteTimeout.UnmarshalText([]byte(value))
+		case "interval":
+			err = c.Interval.UnmarshalText([]byte(value))
+		case "baud":
+			err = parseUint(value, 32, func(v uint64) { c.Baud = int(v) })
+		case "databits":
+			err = parseUint(value, 8, func(v uint64) { c.DataBits = int(v) })
+		case "parity":
+			c.Parity = value
+		case "cert":
+			c.CertFile = value
+		case "key":
+			c.KeyFile = value
+		case "ca":
+			c.CAFile = value
+		case "server_name":
+			c.ServerName = value
+		case "attempts":
+			err = parseUint(value, 8, func(v uint64) { c.MaxAttempts = int(v) })
+		case "backoff":
+			err = c.RetryBackoff.UnmarshalText([]byte(value))
+		case "stop":
+			err = parseUint(value, 8, func(v uint64) { c.StopBits = int(v) })
+		default:
+			err = errors.New("unknown parameter")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %s=%s: %w", key, value, err)
+		}
+	}
+	if err = c.checkSerial(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UnmarshalJSON 省略unit时为1，与URL一致
+func (c *ClientConfig) UnmarshalJSON(data []byte) error {
+	type plain ClientConfig
+	config := plain{Unit: defaultUnit}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	*c = ClientConfig(config)
+	return nil
+}
+
+// UnmarshalYAML 省略unit时为1，与URL一致，兼容gopkg.in/yaml.v2和v3
+func (c *ClientConfig) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain ClientConfig
+	config := plain{Unit: defaultUnit}
+	if err := unmarshal(&config); err != nil {
+		return err
+	}
+	*c = ClientConfig(config)
+	return nil
+}
+
+// 串口参数只用于rtu
+func (c *ClientConfig) checkSerial() error {
+	if strings.ToLower(c.Protocol) == SchemeRTU {
+		return nil
+	}
+	if c.Baud != 0 || c.DataBits != 0 || c.Parity != "" || c.StopBits != 0 {
+		return fmt.Errorf("serial parameters are not supported by %s", c.Protocol)
+	}
+	return nil
+}
+
+func parseUint(value string, bitSize int, set func(uint64)) error {
+	v, err := strconv.ParseUint(value, 10, bitSize)
+	if err == nil {
+		set(v)
+	}
+	return err
+}
+
+// Build 按配置创建客户端，不连接
+func (c *ClientConfig) Build() (Client, error) {
+	protocol := strings.ToLower(c.Protocol)
+	switch protocol {
+	case SchemeTCP, SchemeRTUOverTCP, SchemeUDP, SchemeRTUOverUDP, SchemeTLS:
+		if err := c.checkSerial(); err != nil {
+			return nil, err
+		}
+		host, port, err := splitHostPort(c.Address, c.defaultPort())
+		if err != nil {
+			return nil, err
+		}
+		modbusType := ModbusTCP
+		if protocol == SchemeRTUOverTCP || protocol == SchemeRTUOverUDP {
+			modbusType = ModbusRTU
+		}
+		var packet *ModbusTCPPacket
+		if protocol == SchemeUDP || protocol == SchemeRTUOverUDP {
+			packet, err = NewModbusUDPPacket(host, port, time.Duration(c.ReadTimeout), time.Duration(c.WriteTimeout), time.Duration(c.Interval), modbusType)
+		} else {
+			packet, err = NewModbusTCPPacket(host, port, time.Duration(c.ConnectTimeout), time.Duration(c.ReadTimeout), time.Duration(c.WriteTimeout), time.Duration(c.Interval), modbusType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(c.Backups) > 0 {
+			policy := &FailoverPolicy{Failures: c.Failures, FailBack: time.Duration(c.FailBack)}
+			for _, backup := range c.Backups {
+				host, port, err := splitHostPort(backup, c.defaultPort())
+				if err != nil {
+					return nil, fmt.Errorf("invalid backup %s: %w", backup, err)
+				}
+				policy.Backups = append(policy.Backups, Endpoint{Host: host, Port: port})
+			}
+			packet.SetFailover(policy)
+		}
+		if protocol == SchemeTLS {
+			config, err := c.tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			packet.SetTLS(config)
+		}
+		packet.SetRetryPolicy(c.retryPolicy())
+		packet.SetUnit(c.Unit)
+		return packet, nil
+	case SchemeRTU:
+		if c.Address == "" {
+			return nil, errors.New("missing serial port")
+		}
+		parity, err := ParseParity(c.Parity)
+		if err != nil {
+			return nil, err
+		}
+		baud, dataBits, stopBits := c.Baud, c.DataBits, c.StopBits
+		if baud <= 0 {
+			baud = defaultBaud
+		}
+		if dataBits <= 0 {
+			dataBits = defaultDataBits
+		}
+		if stopBits <= 0 {
+			stopBits = defaultStopBits
+		}
+		packet, err := NewModbusRTUPacket(c.Address, baud, byte(dataBits), parity, byte(stopBits), time.Duration(c.ReadTimeout), time.Duration(c.Interval), ModbusRTU)
+		if err != nil {
+			return nil, err
+		}
+		packet.SetRetryPolicy(c.retryPolicy())
+		packet.SetUnit(c.Unit)
+		return packet, nil
+	}
+	return nil, fmt.Errorf("unknown protocol:%s", c.Protocol)
+}
+
+// 配置的重试策略，不重试时返回nil
+func (c *ClientConfig) retryPolicy() *RetryPolicy {
+	if c.MaxAttempts <= 1 {
+		return nil
+	}
+	return &RetryPolicy{MaxAttempts: c.MaxAttempts, Backoff: time.Duration(c.RetryBackoff)}
+}
+
+// 协议的默认端口
+func (c *ClientConfig) defaultPort() int {
+	if strings.ToLower(c.Protocol) == SchemeTLS {
+		return DefaultTLSPort
+	}
+	return defaultPort
+}
+
+// 拆分网络地址，省略端口时使用defaultPort
+func splitHostPort(address string, defaultPort int) (string, int, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		//没有端口
+		host, portText = strings.Trim(address, "[]"), strconv.Itoa(defaultPort)
+	}
+	if host == "" {
+		return "", 0, errors.New("missing host")
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port:%s", portText)
+	}
+	return host, int(port), nil
+}
+
+// ParseParity 解析校验位，支持N/E/O和NONE/EVEN/ODD，不区分大小写，空字符串为无校验
+func ParseParity(parity string) (Parity, error) {
+	switch strings.ToUpper(parity) {
+	case "", "N", "NONE":
+		return ParityNone, nil
+	case "E", "EVEN":
+		return ParityEven, nil
+	case "O", "ODD":
+		return ParityOdd, nil
+	}
+	return 0, fmt.Errorf("invalid parity:%s", parity)
+}
+
+// Open 按配置创建客户端并连接
+func (c *ClientConfig) Open() (Client, error) {
+	client, err := c.Build()
+	if err != nil {
+		return nil, err
+	}
+	if err = client.Connect(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// OpenClient 解析连接URL，创建客户端并连接，返回的配置中包含从站id
+func OpenClient(rawURL string) (Client, *ClientConfig, error) {
+	config, err := ParseClientURL(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := config.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, config, nil
+}
@@ -0,0 +1,341 @@
+package go_modbus
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestParseClientURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want *ClientConfig
+	}{
+		{
+			url:  "tcp://10.0.0.5:1502?unit=3&timeout=2s&connect_timeout=1s&write_timeout=500ms&interval=10ms",
+			want: &ClientConfig{Protocol: SchemeTCP, Address: "10.0.0.5:1502", Unit: 3, ConnectTimeout: Duration(time.Second), ReadTimeout: Duration(2 * time.Second), WriteTimeout: Duration(500 * time.Millisecond), Interval: Duration(10 * time.Millisecond)},
+		},
+		{url: "TCP://plc.local", want: &ClientConfig{Protocol: SchemeTCP, Address: "plc.local:502", Unit: 1}},
+		{url: "tcp://[fe80::1]", want: &ClientConfig{Protocol: SchemeTCP, Address: "[fe80::1]:502", Unit: 1}},
+		{url: "rtuovertcp://host:4001", want: &ClientConfig{Protocol: SchemeRTUOverTCP, Address: "host:4001", Unit: 1}},
+		{url: "udp://10.0.0.5?unit=0", want: &ClientConfig{Protocol: SchemeUDP, Address: "10.0.0.5:502", Unit: 0}},
+		{url: "rtuoverudp://10.0.0.5:5020", want: &ClientConfig{Protocol: SchemeRTUOverUDP, Address: "10.0.0.5:5020", Unit: 1}},
+		{
+			url:  "tls://plc?cert=client.pem&key=client.key&ca=ca.pem&server_name=plc.example",
+			want: &ClientConfig{Protocol: SchemeTLS, Address: "plc:802", Unit: 1, CertFile: "client.pem", KeyFile: "client.key", CAFile: "ca.pem", ServerName: "plc.example"},
+		},
+		{
+			url:  "rtu:///dev/ttyUSB0?baud=19200&parity=E&stop=2&databits=7&unit=9",
+			want: &ClientConfig{Protocol: SchemeRTU, Address: "/dev/ttyUSB0", Unit: 9, Baud: 19200, DataBits: 7, Parity: "E", StopBits: 2},
+		},
+		{url: "rtu://COM3?baud=9600", want: &ClientConfig{Protocol: SchemeRTU, Address: "COM3", Unit: 1, Baud: 9600}},
+		{url: "rtu://COM3?attempts=3&backoff=50ms", want: &ClientConfig{Protocol: SchemeRTU, Address: "COM3", Unit: 1, MaxAttempts: 3, RetryBackoff: Duration(50 * time.Millisecond)}},
+		{url: "ascii:///dev/ttyUSB0"},
+		{url: "tcp://:502"},
+		{url: "rtu://"},
+		{url: "tcp://10.0.0.5?unit=256"},
+		{url: "tcp://10.0.0.5?timeout=2"},
+		{url: "tcp://10.0.0.5?retries=3"},
+		{url: "rtu:///dev/ttyUSB0?baud=fast"},
+		{url: "tcp://10.0.0.5?baud=9600"},
+		{url: "udp://10.0.0.5?parity=E"},
+		{url: "rtuovertcp://host:4001?stop=2"},
+		{url: "tls://plc?databits=7"},
+		{url: "%zz"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			config, err := ParseClientURL(test.url)
+			if test.want == nil {
+				if err == nil {
+					t.Fatalf("ParseClientURL = %+v, want error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, test.want) {
+				t.Fatalf("ParseClientURL = %+v, want %+v", config, test.want)
+			}
+		})
+	}
+}
+
+func TestClientConfigBuild(t *testing.T) {
+	tests := []struct {
+		url   string
+		check func(t *testing.T, client Client)
+	}{
+		{
+			url: "tcp://10.0.0.5:1502?timeout=2s&connect_timeout=1s&write_timeout=500ms&interval=10ms",
+			check: func(t *testing.T, client Client) {
+				packet := client.(*ModbusTCPPacket)
+				if packet.network != "tcp" || packet.ip != "10.0.0.5" || packet.port != 1502 || packet.transport != TransportTCP {
+					t.Fatalf("packet = %s %s:%d %s", packet.network, packet.ip, packet.port, packet.transport)
+				}
+				if packet.connectTimeout != time.Second || packet.readTimeout != 2*time.Second || packet.writeTimeout != 500*time.Millisecond || packet.rwInterval != 10*time.Millisecond {
+					t.Fatalf("timeouts = %s %s %s %s", packet.connectTimeout, packet.readTimeout, packet.writeTimeout, packet.rwInterval)
+				}
+				if _, ok := packet.ModbusCodec.(*statute.ModbusTCPCodec); !ok {
+					t.Fatalf("codec = %T", packet.ModbusCodec)
+				}
+			},
+		},
+		{
+			url: "tcp://10.0.0.5?unit=3",
+			check: func(t *testing.T, client Client) {
+				if client.Unit() != 3 {
+					t.Fatalf("Unit = %d, want 3", client.Unit())
+				}
+			},
+		},
+		{
+			url: "rtu://COM3?unit=0",
+			check: func(t *testing.T, client Client) {
+				if client.Unit() != 0 {
+					t.Fatalf("Unit = %d, want 0", client.Unit())
+				}
+			},
+		},
+		{
+			url: "rtuovertcp://host:4001",
+			check: func(t *testing.T, client Client) {
+				if client.Unit() != 1 {
+					t.Fatalf("Unit = %d, want 1", client.Unit())
+				}
+			},
+		},
+		{
+			url: "tcp://10.0.0.5?attempts=2&backoff=10ms",
+			check: func(t *testing.T, client Client) {
+				want := &RetryPolicy{MaxAttempts: 2, Backoff: 10 * time.Millisecond}
+				if packet := client.(*ModbusTCPPacket); !reflect.DeepEqual(packet.retry, want) {
+					t.Fatalf("retry = %+v, want %+v", packet.retry, want)
+				}
+			},
+		},
+		{
+			url: "rtuovertcp://host",
+			check: func(t *testing.T, client Client) {
+				packet := client.(*ModbusTCPPacket)
+				if packet.network != "tcp" || packet.port != defaultPort || packet.readTimeout != defaultReadTimeout {
+					t.Fatalf("packet = %s :%d %s", packet.network, packet.port, packet.readTimeout)
+				}
+				if _, ok := packet.ModbusCodec.(*statute.ModbusRTUCodec); !ok {
+					t.Fatalf("codec = %T", packet.ModbusCodec)
+				}
+			},
+		},
+		{
+			url: "udp://10.0.0.5",
+			check: func(t *testing.T, client Client) {
+				packet := client.(*ModbusTCPPacket)
+				if packet.network != "udp" || packet.transport != TransportUDP {
+					t.Fatalf("packet = %s %s", packet.network, packet.transport)
+				}
+				if _, ok := packet.ModbusCodec.(*statute.ModbusTCPCodec); !ok {
+					t.Fatalf("codec = %T", packet.ModbusCodec)
+				}
+			},
+		},
+		{
+			url: "rtuoverudp://10.0.0.5",
+			check: func(t *testing.T, client Client) {
+				packet := client.(*ModbusTCPPacket)
+				if _, ok := packet.ModbusCodec.(*statute.ModbusRTUCodec); !ok || packet.network != "udp" {
+					t.Fatalf("packet = %s %T", packet.network, packet.ModbusCodec)
+				}
+			},
+		},
+		{
+			url: "tls://plc?server_name=plc.example",
+			check: func(t *testing.T, client Client) {
+				packet := client.(*ModbusTCPPacket)
+				if packet.port != 802 || packet.tlsConfig == nil || packet.tlsConfig.ServerName != "plc.example" || packet.tlsConfig.MinVersion != tls.VersionTLS12 {
+					t.Fatalf("packet = :%d %+v", packet.port, packet.tlsConfig)
+				}
+			},
+		},
+		{
+			url: "rtu:///dev/ttyUSB0?baud=19200&parity=e&stop=2&databits=7&timeout=300ms",
+			check: func(t *testing.T, client Client) {
+				packet := client.(*ModbusRTUPacket)
+				if packet.port != "/dev/ttyUSB0" || packet.baud != 19200 || packet.parity != ParityEven || packet.stopBit != 2 || packet.dataBit != 7 || packet.readTimeout != 300*time.Millisecond {
+					t.Fatalf("packet = %s %d %d%c%d %s", packet.port, packet.baud, packet.dataBit, packet.parity, packet.stopBit, packet.readTimeout)
+				}
+			},
+		},
+		{
+			url: "rtu://COM3",
+			check: func(t *testing.T, client Client) {
+				packet := client.(*ModbusRTUPacket)
+				if packet.baud != defaultBaud || packet.parity != ParityNone || packet.stopBit != defaultStopBits || packet.dataBit != defaultDataBits {
+					t.Fatalf("packet = %d %d%c%d", packet.baud, packet.dataBit, packet.parity, packet.stopBit)
+				}
+				if packet.retry != nil {
+					t.Fatalf("retry = %+v, want none", packet.retry)
+				}
+			},
+		},
+		{
+			url: "rtu://COM3?attempts=3&backoff=50ms",
+			check: func(t *testing.T, client Client) {
+				want := &RetryPolicy{MaxAttempts: 3, Backoff: 50 * time.Millisecond}
+				if packet := client.(*ModbusRTUPacket); !reflect.DeepEqual(packet.retry, want) {
+					t.Fatalf("retry = %+v, want %+v", packet.retry, want)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			config, err := ParseClientURL(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := config.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, client)
+		})
+	}
+}
+
+func TestClientConfigBuildErrors(t *testing.T) {
+	for _, config := range []*ClientConfig{
+		{Protocol: "ascii", Address: "COM1"},
+		{Protocol: SchemeTCP, Address: ":502"},
+		{Protocol: SchemeTCP, Address: "10.0.0.5:http"},
+		{Protocol: SchemeRTU},
+		{Protocol: SchemeRTU, Address: "COM1", Parity: "M"},
+		{Protocol: SchemeTLS, Address: "plc", CertFile: "missing.pem", KeyFile: "missing.key"},
+		{Protocol: SchemeTLS, Address: "plc", CAFile: "missing.pem"},
+		{Protocol: SchemeTCP, Address: "10.0.0.5", Baud: 9600},
+		{Protocol: SchemeUDP, Address: "10.0.0.5", Parity: "N"},
+	} {
+		if client, err := config.Build(); err == nil {
+			t.Errorf("Build(%+v) = %T, want error", config, client)
+		}
+	}
+}
+
+func TestClientConfigJSON(t *testing.T) {
+	var config ClientConfig
+	err := json.Unmarshal([]byte(`{"protocol":"tcp","address":"10.0.0.5","unit":2,"readTimeout":"1.5s"}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ReadTimeout != Duration(1500*time.Millisecond) || config.Unit != 2 {
+		t.Fatalf("config = %+v", config)
+	}
+	//省略端口时使用502
+	client, err := config.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet := client.(*ModbusTCPPacket); packet.port != defaultPort || packet.readTimeout != 1500*time.Millisecond {
+		t.Fatalf("packet = :%d %s", packet.port, packet.readTimeout)
+	}
+	if client.Unit() != 2 {
+		t.Fatalf("Unit = %d, want 2", client.Unit())
+	}
+	//省略unit时与URL一致为1，显式的0保留
+	for text, want := range map[string]byte{
+		`{"protocol":"rtu","address":"COM1"}`:         1,
+		`{"protocol":"tcp","address":"plc","unit":0}`: 0,
+	} {
+		config = ClientConfig{}
+		if err = json.Unmarshal([]byte(text), &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Unit != want {
+			t.Fatalf("%s: unit = %d, want %d", text, config.Unit, want)
+		}
+	}
+	if err = json.Unmarshal([]byte(`{"unit":"x"}`), &config); err == nil {
+		t.Fatal("Unmarshal accepted a string unit")
+	}
+	//YAML库通过回调解码到没有UnmarshalYAML方法的类型，这里用JSON模拟
+	config = ClientConfig{}
+	err = config.UnmarshalYAML(func(v any) error {
+		return json.Unmarshal([]byte(`{"protocol":"rtu","address":"COM1","baud":19200}`), v)
+	})
+	if err != nil || config.Unit != 1 || config.Baud != 19200 {
+		t.Fatalf("UnmarshalYAML = %+v, %v", config, err)
+	}
+	if err = config.UnmarshalYAML(func(any) error { return errors.New("bad yaml") }); err == nil {
+		t.Fatal("UnmarshalYAML ignored the decode error")
+	}
+	data, err := json.Marshal(&ClientConfig{Protocol: SchemeRTU, Address: "COM1", ReadTimeout: Duration(time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"protocol":"rtu","address":"COM1","unit":0,"readTimeout":"1s"}`; string(data) != want {
+		t.Fatalf("json = %s, want %s", data, want)
+	}
+}
+
+func TestUDPTransport(t *testing.T) {
+	for _, modbusType := range []StatuteType{ModbusTCP, ModbusRTU} {
+		t.Run(string(modbusType), func(t *testing.T) {
+			device := &registerDevice{rtu: modbusType == ModbusRTU, registers: []uint16{1, 2, 3}}
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			//每个数据报是一条完整的请求
+			go func() {
+				buf := make([]byte, 512)
+				for {
+					n, addr, err := conn.ReadFrom(buf)
+					if err != nil {
+						return
+					}
+					if response := device.respond(buf[:n]); response != nil {
+						_, _ = conn.WriteTo(response, addr)
+					}
+				}
+			}()
+			packet, err := NewModbusUDPPacket("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port, replayTimeout, time.Second, time.Microsecond, modbusType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = packet.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer packet.Close()
+			if _, _, err = packet.WriteSingleRegister(1, 2, 30); err != nil {
+				t.Fatal(err)
+			}
+			data, err := packet.ReadHoldingRegisters(1, 0, 3)
+			if err != nil || !bytes.Equal(data, []byte{0, 1, 0, 2, 0, 30}) {
+				t.Fatalf("ReadHoldingRegisters = % x %v", data, err)
+			}
+			if _, err = packet.ReadHoldingRegisters(2, 0, 1); !isTimeout(err) {
+				t.Fatalf("error = %v, want timeout", err)
+			}
+		})
+	}
+}
+
+func TestParseParity(t *testing.T) {
+	tests := map[string]Parity{"": ParityNone, "n": ParityNone, "NONE": ParityNone, "E": ParityEven, "even": ParityEven, "O": ParityOdd, "Odd": ParityOdd}
+	for input, want := range tests {
+		if got, err := ParseParity(input); err != nil || got != want {
+			t.Errorf("ParseParity(%q) = %c, %v, want %c", input, got, err, want)
+		}
+	}
+	if _, err := ParseParity("M"); err == nil {
+		t.Error("ParseParity(M) succeeded")
+	}
+}
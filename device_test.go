@@ -0,0 +1,40 @@
+package go_modbus
+
+import (
+	"net"
+	"testing"
+)
+
+// 启动一个测试用的设备，对收到的每个请求调用respond，respond返回nil时不应答，返回监听端口
+func serveDevice(t *testing.T, respond func(request []byte) []byte) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			go func() {
+				buf := make([]byte, 512)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					if response := respond(append([]byte(nil), buf[:n]...)); response != nil {
+						if _, err = conn.Write(response); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,132 @@
+package fault
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// ConnectionResetError 注入Reset故障时读取返回的错误
+var ConnectionResetError = errors.New("connection reset by fault injection")
+
+// Wrap 包装客户端一侧的字节流，对读到的每帧响应注入故障
+// 每次Write视为一帧完整的请求，Delay故障在返回响应前休眠
+func Wrap(rwc io.ReadWriteCloser, kind statute.FrameKind, injector *Injector) io.ReadWriteCloser {
+	return &stream{rwc: rwc, kind: kind, injector: injector, reader: bufio.NewReader(rwc)}
+}
+
+// WrapConn 包装客户端一侧的网络连接，对读到的每帧响应注入故障
+// Delay故障超过读超时时返回超时错误，延迟的响应在下一次读取时到达
+func WrapConn(conn net.Conn, kind statute.FrameKind, injector *Injector) net.Conn {
+	return &faultConn{Conn: conn, stream: &stream{rwc: conn, kind: kind, injector: injector, reader: bufio.NewReader(conn)}}
+}
+
+// ConnWrapper 返回一个包装函数，可传给ModbusTCPPacket.WrapConn
+func (i *Injector) ConnWrapper(kind statute.FrameKind) func(net.Conn) net.Conn {
+	return func(conn net.Conn) net.Conn {
+		return WrapConn(conn, kind, i)
+	}
+}
+
+// Wrapper 返回一个包装函数，可传给ModbusRTUPacket.WrapPort
+func (i *Injector) Wrapper(kind statute.FrameKind) func(io.ReadWriteCloser) io.ReadWriteCloser {
+	return func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		return Wrap(rwc, kind, i)
+	}
+}
+
+type stream struct {
+	lock     sync.Mutex
+	rwc      io.ReadWriteCloser
+	kind     statute.FrameKind
+	injector *Injector
+	reader   *bufio.Reader
+	request  []byte
+	pending  []byte
+	deadline atomic.Int64 //读超时，UnixNano，0表示不限
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	s.request = append([]byte(nil), p...)
+	s.lock.Unlock()
+	return s.rwc.Write(p)
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for len(s.pending) == 0 {
+		response, err := statute.ReadResponse(s.reader, s.kind)
+		if response == nil {
+			return 0, err
+		}
+		action := s.injector.Apply(s.kind, s.request, response)
+		if action.Reset {
+			_ = s.rwc.Close()
+			return 0, ConnectionResetError
+		}
+		if action.Drop {
+			continue
+		}
+		if action.Delay > 0 {
+			if deadline := s.deadline.Load(); deadline != 0 && time.Now().Add(action.Delay).UnixNano() > deadline {
+				//响应晚于读超时到达
+				time.Sleep(time.Until(time.Unix(0, deadline)))
+				s.pending = action.Response
+				return 0, os.ErrDeadlineExceeded
+			}
+			time.Sleep(action.Delay)
+		}
+		s.pending = action.Response
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *stream) Close() error {
+	return s.rwc.Close()
+}
+
+type faultConn struct {
+	net.Conn
+	*stream
+}
+
+func (c *faultConn) Read(p []byte) (int, error) {
+	return c.stream.Read(p)
+}
+
+func (c *faultConn) Write(p []byte) (int, error) {
+	return c.stream.Write(p)
+}
+
+func (c *faultConn) Close() error {
+	return c.Conn.Close()
+}
+
+func (c *faultConn) SetDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *faultConn) SetReadDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *faultConn) setReadDeadline(t time.Time) {
+	if t.IsZero() {
+		c.stream.deadline.Store(0)
+		return
+	}
+	c.stream.deadline.Store(t.UnixNano())
+}
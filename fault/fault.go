@@ -0,0 +1,204 @@
+package fault
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// Kind 故障类型
+type Kind string
+
+const (
+	Delay              Kind = "delay"              //延迟响应
+	Drop               Kind = "drop"               //丢弃响应
+	CorruptCRC         Kind = "corruptCRC"         //破坏CRC或LRC，TCP帧没有校验，改为破坏最后一个字节
+	WrongTransactionId Kind = "wrongTransactionId" //错误的事务id，仅对TCP帧有效
+	Truncate           Kind = "truncate"           //截断响应，只发送前一半
+	Exception          Kind = "exception"          //以异常码替换响应
+	Reset              Kind = "reset"              //断开连接
+)
+
+// AddressRange 地址范围，包含From和To
+type AddressRange struct {
+	From uint16
+	To   uint16
+}
+
+// Rule 故障规则
+// 请求匹配SlaveIds、FuncCodes和Addresses(为空表示不限)且处于生效时间窗口内时，
+// 每Every个匹配的请求触发一次(0表示每次)，再按Probability的概率(0表示必定)注入
+type Rule struct {
+	Kind          Kind
+	Probability   float64        //触发概率，取值0~1
+	Every         int            //每N个匹配的请求触发一次
+	Start         time.Duration  //生效时间窗口起点，相对注入器创建时间
+	End           time.Duration  //生效时间窗口终点，0表示不限
+	Limit         int            //最多触发次数，0表示不限
+	SlaveIds      []byte         //匹配的从站id
+	FuncCodes     []byte         //匹配的功能码
+	Addresses     []AddressRange //匹配的地址范围，与请求的地址区间有交集即匹配
+	Delay         time.Duration  //Delay故障的延迟
+	ExceptionCode byte           //Exception故障的异常码，默认0x02
+	matched       int
+	fired         int
+}
+
+// Action 对一帧响应注入故障的结果
+type Action struct {
+	Delay    time.Duration //发送响应前的延迟
+	Drop     bool          //不发送响应
+	Reset    bool          //断开连接
+	Response []byte        //实际发送的响应
+}
+
+// NewInjector 创建一个故障注入器
+func NewInjector(rules ...*Rule) *Injector {
+	return &Injector{rules: rules, start: time.Now(), random: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), injected: make(map[Kind]int)}
+}
+
+// Injector 按规则对响应注入故障，可被模拟器和客户端连接包装共用
+type Injector struct {
+	lock     sync.Mutex
+	rules    []*Rule
+	start    time.Time
+	random   *rand.Rand
+	injected map[Kind]int
+}
+
+// Seed 设置随机数种子，使按概率触发的故障可复现
+func (i *Injector) Seed(seed uint64) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.random = rand.New(rand.NewPCG(seed, seed))
+}
+
+// AddRule 添加规则
+func (i *Injector) AddRule(rule *Rule) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.rules = append(i.rules, rule)
+}
+
+// Injected 返回某类故障已注入的次数
+func (i *Injector) Injected(kind Kind) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.injected[kind]
+}
+
+// Apply 对一次请求的响应注入故障
+// kind 帧格式
+// request 请求帧
+// response 响应帧，可以为nil
+func (i *Injector) Apply(kind statute.FrameKind, request, response []byte) *Action {
+	action := &Action{Response: response}
+	framer, err := statute.NewFramer(kind)
+	if err != nil {
+		return action
+	}
+	adu, err := framer.Decode(request)
+	if err != nil {
+		return action
+	}
+	slaveId, pdu := adu.SlaveId, adu.PDU
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	elapsed := time.Since(i.start)
+	for _, rule := range i.rules {
+		if !i.fire(rule, slaveId, pdu, elapsed) {
+			continue
+		}
+		i.injected[rule.Kind]++
+		switch rule.Kind {
+		case Delay:
+			action.Delay += rule.Delay
+		case Drop:
+			action.Drop = true
+		case Reset:
+			action.Reset = true
+		case Exception:
+			exceptionCode := rule.ExceptionCode
+			if exceptionCode == 0 {
+				exceptionCode = statute.ExceptionIllegalDataAddress
+			}
+			action.Response, _ = framer.Encode(&statute.ADU{TransactionId: adu.TransactionId, SlaveId: slaveId, PDU: []byte{pdu[0] | 0x80, exceptionCode}})
+		case CorruptCRC:
+			if kind == statute.FrameASCII && len(action.Response) >= 3 {
+				//修改LRC的最后一个十六进制字符，保留CRLF
+				action.Response = slices.Clone(action.Response)
+				index := len(action.Response) - 3
+				if action.Response[index] == '0' {
+					action.Response[index] = '1'
+				} else {
+					action.Response[index] = '0'
+				}
+			} else if len(action.Response) > 0 {
+				action.Response = slices.Clone(action.Response)
+				action.Response[len(action.Response)-1] ^= 0xFF
+			}
+		case WrongTransactionId:
+			if kind == statute.FrameTCP && len(action.Response) >= 2 {
+				action.Response = slices.Clone(action.Response)
+				binary.BigEndian.PutUint16(action.Response, binary.BigEndian.Uint16(action.Response)+1)
+			}
+		case Truncate:
+			action.Response = action.Response[:len(action.Response)/2]
+		}
+	}
+	return action
+}
+
+// 判断规则是否触发，调用方需持有锁
+func (i *Injector) fire(rule *Rule, slaveId byte, pdu []byte, elapsed time.Duration) bool {
+	if elapsed < rule.Start || (rule.End > 0 && elapsed >= rule.End) {
+		return false
+	}
+	if rule.Limit > 0 && rule.fired >= rule.Limit {
+		return false
+	}
+	if len(rule.SlaveIds) > 0 && !slices.Contains(rule.SlaveIds, slaveId) {
+		return false
+	}
+	if len(rule.FuncCodes) > 0 && !slices.Contains(rule.FuncCodes, pdu[0]) {
+		return false
+	}
+	if len(rule.Addresses) > 0 && !matchAddress(rule.Addresses, pdu) {
+		return false
+	}
+	rule.matched++
+	if rule.Every > 1 && rule.matched%rule.Every != 0 {
+		return false
+	}
+	if rule.Probability > 0 && i.random.Float64() >= rule.Probability {
+		return false
+	}
+	rule.fired++
+	return true
+}
+
+// 请求的地址区间与任一范围有交集
+func matchAddress(ranges []AddressRange, pdu []byte) bool {
+	if len(pdu) < 5 {
+		return false
+	}
+	address, quantity := binary.BigEndian.Uint16(pdu[1:]), uint16(1)
+	switch pdu[0] {
+	case statute.ReadCoils, statute.ReadDiscreteInputs, statute.ReadHoldingRegisters, statute.ReadInputRegisters, statute.WriteMultipleCoils, statute.WriteMultipleRegisters:
+		quantity = max(binary.BigEndian.Uint16(pdu[3:]), 1)
+	case statute.WriteSingleCoil, statute.WriteSingleRegister:
+	default:
+		return false
+	}
+	last := uint32(address) + uint32(quantity) - 1
+	for _, r := range ranges {
+		if uint32(r.From) <= last && address <= r.To {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package fault_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/fault"
+	"github.com/VaccariaSeed/go-modbus/simulator"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// 读保持寄存器0~1的请求和响应
+var (
+	tcpRequest    = []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x01}
+	tcpResponse   = []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x01, 0x03, 0x02, 0x00, 0x2A}
+	rtuRequest    = []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	rtuResponse   = []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}
+	asciiRequest  = statute.BuildASCIIFrame(1, []byte{0x03, 0x00, 0x00, 0x00, 0x01})
+	asciiResponse = statute.BuildASCIIFrame(1, []byte{0x03, 0x02, 0x00, 0x2A})
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     statute.FrameKind
+		rule     *fault.Rule
+		request  []byte
+		response []byte
+		check    func(t *testing.T, action *fault.Action)
+	}{
+		{
+			name: "delay", kind: statute.FrameTCP, rule: &fault.Rule{Kind: fault.Delay, Delay: time.Second},
+			request: tcpRequest, response: tcpResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if action.Delay != time.Second || !bytes.Equal(action.Response, tcpResponse) {
+					t.Fatalf("action = %+v", action)
+				}
+			},
+		},
+		{
+			name: "drop", kind: statute.FrameTCP, rule: &fault.Rule{Kind: fault.Drop},
+			request: tcpRequest, response: tcpResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if !action.Drop {
+					t.Fatal("response not dropped")
+				}
+			},
+		},
+		{
+			name: "corrupt crc", kind: statute.FrameRTU, rule: &fault.Rule{Kind: fault.CorruptCRC},
+			request: rtuRequest, response: rtuResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if _, err := statute.ReadRTUResponse(bytes.NewReader(action.Response)); !errors.Is(err, statute.CsError) {
+					t.Fatalf("decode error = %v, want crc error", err)
+				}
+				if rtuResponse[len(rtuResponse)-1] != 0x9B {
+					t.Fatal("original response modified")
+				}
+			},
+		},
+		{
+			name: "corrupt lrc", kind: statute.FrameASCII, rule: &fault.Rule{Kind: fault.CorruptCRC},
+			request: asciiRequest, response: asciiResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if _, err := statute.DecodeASCIIFrame(action.Response); !errors.Is(err, statute.LrcError) {
+					t.Fatalf("decode error = %v, want lrc error", err)
+				}
+				if !bytes.HasSuffix(action.Response, []byte("\r\n")) {
+					t.Fatalf("response = %q lost CRLF", action.Response)
+				}
+			},
+		},
+		{
+			name: "wrong transaction id", kind: statute.FrameTCP, rule: &fault.Rule{Kind: fault.WrongTransactionId},
+			request: tcpRequest, response: tcpResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if id := binary.BigEndian.Uint16(action.Response); id != 2 {
+					t.Fatalf("transaction id = %d, want 2", id)
+				}
+			},
+		},
+		{
+			name: "wrong transaction id ignored for rtu", kind: statute.FrameRTU, rule: &fault.Rule{Kind: fault.WrongTransactionId},
+			request: rtuRequest, response: rtuResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if !bytes.Equal(action.Response, rtuResponse) {
+					t.Fatalf("response = % x, want unchanged", action.Response)
+				}
+			},
+		},
+		{
+			name: "truncate", kind: statute.FrameRTU, rule: &fault.Rule{Kind: fault.Truncate},
+			request: rtuRequest, response: rtuResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if !bytes.Equal(action.Response, rtuResponse[:3]) {
+					t.Fatalf("response = % x, want % x", action.Response, rtuResponse[:3])
+				}
+			},
+		},
+		{
+			name: "exception", kind: statute.FrameTCP, rule: &fault.Rule{Kind: fault.Exception, ExceptionCode: 0x04},
+			request: tcpRequest, response: tcpResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				want := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x01, 0x83, 0x04}
+				if !bytes.Equal(action.Response, want) {
+					t.Fatalf("response = % x, want % x", action.Response, want)
+				}
+			},
+		},
+		{
+			name: "ascii exception", kind: statute.FrameASCII, rule: &fault.Rule{Kind: fault.Exception},
+			request: asciiRequest, response: asciiResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if want := statute.BuildASCIIFrame(1, []byte{0x83, statute.ExceptionIllegalDataAddress}); !bytes.Equal(action.Response, want) {
+					t.Fatalf("response = %q, want %q", action.Response, want)
+				}
+			},
+		},
+		{
+			name: "reset", kind: statute.FrameTCP, rule: &fault.Rule{Kind: fault.Reset},
+			request: tcpRequest, response: tcpResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if !action.Reset {
+					t.Fatal("connection not reset")
+				}
+			},
+		},
+		{
+			name: "slave not matched", kind: statute.FrameTCP, rule: &fault.Rule{Kind: fault.Drop, SlaveIds: []byte{2}},
+			request: tcpRequest, response: tcpResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if action.Drop {
+					t.Fatal("rule fired for another slave")
+				}
+			},
+		},
+		{
+			name: "address not matched", kind: statute.FrameTCP, rule: &fault.Rule{Kind: fault.Drop, Addresses: []fault.AddressRange{{From: 1, To: 9}}},
+			request: tcpRequest, response: tcpResponse,
+			check: func(t *testing.T, action *fault.Action) {
+				if action.Drop {
+					t.Fatal("rule fired outside the address range")
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.check(t, fault.NewInjector(test.rule).Apply(test.kind, test.request, test.response))
+		})
+	}
+}
+
+func TestEveryAndLimit(t *testing.T) {
+	injector := fault.NewInjector(&fault.Rule{Kind: fault.Drop, Every: 2, Limit: 2})
+	var dropped []bool
+	for range 6 {
+		dropped = append(dropped, injector.Apply(statute.FrameTCP, tcpRequest, tcpResponse).Drop)
+	}
+	if want := []bool{false, true, false, true, false, false}; !slices.Equal(dropped, want) {
+		t.Fatalf("dropped = %v, want %v", dropped, want)
+	}
+	if n := injector.Injected(fault.Drop); n != 2 {
+		t.Fatalf("Injected = %d, want 2", n)
+	}
+}
+
+// 连接到模拟器的客户端，wrap不为nil时包装客户端的连接
+func dial(t *testing.T, sim *simulator.Simulator, modbusType modbus.StatuteType, wrap func(net.Conn) net.Conn) *modbus.ModbusTCPPacket {
+	t.Helper()
+	kind := statute.FrameTCP
+	if modbusType == modbus.ModbusRTU {
+		kind = statute.FrameRTU
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = sim.Serve(listener, kind) }()
+	client, err := modbus.NewModbusTCPPacket("127.0.0.1", listener.Addr().(*net.TCPAddr).Port, time.Second, 100*time.Millisecond, time.Second, time.Microsecond, modbusType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		client.WrapConn(wrap)
+	}
+	if err = client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestWrapConn(t *testing.T) {
+	tests := []struct {
+		modbusType modbus.StatuteType
+		rule       *fault.Rule
+		want       error
+	}{
+		{modbus.ModbusTCP, &fault.Rule{Kind: fault.Delay, Delay: 500 * time.Millisecond}, statute.ErrTimeout},
+		{modbus.ModbusTCP, &fault.Rule{Kind: fault.Drop}, statute.ErrTimeout},
+		{modbus.ModbusRTU, &fault.Rule{Kind: fault.CorruptCRC}, statute.ErrCRC},
+		{modbus.ModbusTCP, &fault.Rule{Kind: fault.WrongTransactionId}, statute.ErrTransactionMismatch},
+		{modbus.ModbusRTU, &fault.Rule{Kind: fault.Truncate}, statute.ErrShortFrame},
+		{modbus.ModbusTCP, &fault.Rule{Kind: fault.Exception}, statute.ErrIllegalDataAddress},
+		{modbus.ModbusTCP, &fault.Rule{Kind: fault.Reset}, fault.ConnectionResetError},
+	}
+	for _, test := range tests {
+		t.Run(string(test.rule.Kind), func(t *testing.T) {
+			sim := simulator.NewSimulator(1)
+			defer sim.Close()
+			_ = sim.Slave(1).SetHoldingRegisters(0, 42)
+			kind := statute.FrameTCP
+			if test.modbusType == modbus.ModbusRTU {
+				kind = statute.FrameRTU
+			}
+			injector := fault.NewInjector(test.rule)
+			client := dial(t, sim, test.modbusType, injector.ConnWrapper(kind))
+			if _, err := client.ReadHoldingRegisters(1, 0, 1); !errors.Is(err, test.want) {
+				t.Fatalf("error = %v, want %v", err, test.want)
+			}
+			if n := injector.Injected(test.rule.Kind); n != 1 {
+				t.Fatalf("Injected = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestSimulatorFaults(t *testing.T) {
+	sim := simulator.NewSimulator(1)
+	defer sim.Close()
+	_ = sim.Slave(1).SetHoldingRegisters(0, 42)
+	sim.SetFaults(fault.NewInjector(&fault.Rule{Kind: fault.Exception, ExceptionCode: 0x06, Addresses: []fault.AddressRange{{From: 10, To: 19}}}))
+	client := dial(t, sim, modbus.ModbusRTU, nil)
+	data, err := client.ReadHoldingRegisters(1, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, 42}) {
+		t.Fatalf("data = % x, want 00 2a", data)
+	}
+	if _, err = client.ReadHoldingRegisters(1, 10, 1); !errors.Is(err, statute.ErrServerDeviceBusy) {
+		t.Fatalf("error = %v, want exception 6", err)
+	}
+	sim.SetFaults(nil)
+	if _, err = client.ReadHoldingRegisters(1, 10, 1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,191 @@
+package go_modbus
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// BroadcastSlaveId 广播地址
+const BroadcastSlaveId byte = 0x00
+
+// GatewayBackend 网关的下行通道，ModbusRTUPacket和ModbusTCPPacket都满足
+type GatewayBackend interface {
+	CustomRequest(slaveId, funcCode byte, data []byte) ([]byte, error)
+	Broadcast(funcCode byte, data []byte) error
+	Flush() error
+}
+
+var _ GatewayBackend = (*ModbusRTUPacket)(nil)
+var _ GatewayBackend = (*ModbusTCPPacket)(nil)
+
+// NewModbusGateway 创建一个Modbus TCP转RTU网关
+// 网关接收MBAP请求，以单元id作为从站id将PDU转发到串口，再将响应以原事务标识返回
+// 多个TCP客户端的请求在串口上串行执行
+func NewModbusGateway(backend *ModbusRTUPacket) *ModbusGateway {
+	return newModbusGateway(ModbusTCP, backend)
+}
+
+// NewModbusConverter 创建一个TCP上的协议转换器
+// frontend为ModbusTCP时，接收标准Modbus TCP客户端，转发到backend(使用ModbusRTU编码的ModbusTCPPacket，即RTU over TCP设备)
+// frontend为ModbusRTU时，接收RTU over TCP客户端，转发到backend(使用ModbusTCP编码的ModbusTCPPacket，即标准Modbus TCP设备)
+// MBAP头与CRC在两个方向上自动转换
+func NewModbusConverter(frontend StatuteType, backend *ModbusTCPPacket) (*ModbusGateway, error) {
+	if frontend != ModbusTCP && frontend != ModbusRTU {
+		return nil, errors.New("modbus type not supported")
+	}
+	return newModbusGateway(frontend, backend), nil
+}
+
+func newModbusGateway(frontend StatuteType, backend GatewayBackend) *ModbusGateway {
+	return &ModbusGateway{frontend: frontend, backend: backend, conns: make(map[net.Conn]struct{})}
+}
+
+// ModbusGateway Modbus网关，将TCP客户端的请求转发到下行通道
+type ModbusGateway struct {
+	frontend StatuteType //上行协议
+	backend  GatewayBackend
+	lock     sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// ListenAndServe 监听addr并提供服务
+func (g *ModbusGateway) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.Serve(listener)
+}
+
+// Serve 在listener上提供服务，直到Close
+func (g *ModbusGateway) Serve(listener net.Listener) error {
+	g.lock.Lock()
+	if g.closed {
+		g.lock.Unlock()
+		return net.ErrClosed
+	}
+	g.listener = listener
+	g.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			g.lock.Lock()
+			defer g.lock.Unlock()
+			if g.closed {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			_ = g.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn 处理一个TCP客户端的请求，直到连接出错或关闭
+func (g *ModbusGateway) ServeConn(conn net.Conn) error {
+	g.lock.Lock()
+	if g.closed {
+		g.lock.Unlock()
+		return conn.Close()
+	}
+	g.conns[conn] = struct{}{}
+	g.lock.Unlock()
+	defer func() {
+		g.lock.Lock()
+		delete(g.conns, conn)
+		g.lock.Unlock()
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		var request []byte
+		var err error
+		if g.frontend == ModbusRTU {
+			request, err = statute.ReadRTURequest(reader)
+			if errors.Is(err, statute.CsError) {
+				//校验错误的请求不应答
+				continue
+			}
+		} else {
+			request, err = statute.ReadTCPFrame(reader)
+			if err == nil && (request[2] != 0 || request[3] != 0) {
+				err = errors.New("invalid modbus tcp type")
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var response []byte
+		if g.frontend == ModbusRTU {
+			slaveId, pdu := request[0], request[1:len(request)-2]
+			if pdu = g.forward(slaveId, pdu); pdu != nil {
+				response = statute.BuildRTUFrame(slaveId, pdu)
+			}
+		} else {
+			transactionId := uint16(request[0])<<8 | uint16(request[1])
+			slaveId, pdu := request[6], request[7:]
+			if pdu = g.forward(slaveId, pdu); pdu != nil {
+				response = statute.BuildTCPFrame(transactionId, slaveId, pdu)
+			}
+		}
+		if response == nil {
+			continue
+		}
+		if _, err = conn.Write(response); err != nil {
+			return err
+		}
+	}
+}
+
+// 将PDU转发到下行通道，返回响应PDU，广播时返回nil
+func (g *ModbusGateway) forward(slaveId byte, pdu []byte) []byte {
+	funcCode := pdu[0]
+	if funcCode&0x80 != 0 || !statute.SupportedFuncCode(funcCode) {
+		return []byte{funcCode | 0x80, statute.ExceptionIllegalFunction}
+	}
+	if slaveId == BroadcastSlaveId {
+		_ = g.backend.Broadcast(funcCode, pdu[1:])
+		return nil
+	}
+	data, err := g.backend.CustomRequest(slaveId, funcCode, pdu[1:])
+	if err == nil {
+		return append([]byte{funcCode}, data...)
+	}
+	var abnormal *statute.ReturnedAbnormalFuncCode
+	if errors.As(err, &abnormal) {
+		return []byte{abnormal.GetFuncCode(), abnormal.GetExceptionCode()}
+	}
+	if errors.Is(err, NoConnectionError) {
+		return []byte{funcCode | 0x80, statute.ExceptionGatewayPathUnavailable}
+	}
+	//超时、校验错误或响应错乱，丢弃下行通道上残留的字节
+	if ferr := g.backend.Flush(); ferr != nil {
+		return []byte{funcCode | 0x80, statute.ExceptionGatewayPathUnavailable}
+	}
+	return []byte{funcCode | 0x80, statute.ExceptionGatewayTargetFailed}
+}
+
+// Close 停止服务并关闭所有客户端连接，不会关闭下行通道
+func (g *ModbusGateway) Close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.closed = true
+	for conn := range g.conns {
+		_ = conn.Close()
+	}
+	if g.listener != nil {
+		return g.listener.Close()
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package go_modbus
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// 以respond代替下行设备的GatewayBackend
+type fakeBackend struct {
+	lock     sync.Mutex
+	respond  func(slaveId, funcCode byte, data []byte) ([]byte, error)
+	flushErr error
+	requests [][]byte //收到的请求，功能码及数据域前加从站id
+}
+
+func (b *fakeBackend) CustomRequest(slaveId, funcCode byte, data []byte) ([]byte, error) {
+	b.lock.Lock()
+	b.requests = append(b.requests, append([]byte{slaveId, funcCode}, data...))
+	b.lock.Unlock()
+	return b.respond(slaveId, funcCode, data)
+}
+
+func (b *fakeBackend) Broadcast(funcCode byte, data []byte) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.requests = append(b.requests, append([]byte{BroadcastSlaveId, funcCode}, data...))
+	return nil
+}
+
+func (b *fakeBackend) Flush() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.flushErr
+}
+
+// 启动网关，返回监听端口
+func serveGateway(t *testing.T, gateway *ModbusGateway) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = gateway.Serve(listener) }()
+	t.Cleanup(func() { _ = gateway.Close() })
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestModbusGateway(t *testing.T) {
+	backend := &fakeBackend{respond: func(slaveId, funcCode byte, data []byte) ([]byte, error) {
+		switch slaveId {
+		case 1:
+			return []byte{0x02, 0x00, 0x2A}, nil
+		case 3:
+			return nil, statute.CsError
+		case 4:
+			return nil, NoConnectionError
+		}
+		return nil, ReadTimeoutError
+	}}
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(serveGateway(t, newModbusGateway(ModbusTCP, backend)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	tests := []struct {
+		name     string
+		slaveId  byte
+		pdu      []byte
+		flushErr error
+		want     []byte //响应PDU
+	}{
+		{name: "response", slaveId: 1, pdu: []byte{0x03, 0x00, 0x00, 0x00, 0x01}, want: []byte{0x03, 0x02, 0x00, 0x2A}},
+		{name: "crc error", slaveId: 3, pdu: []byte{0x03, 0x00, 0x00, 0x00, 0x01}, want: []byte{0x83, statute.ExceptionGatewayTargetFailed}},
+		{name: "no connection", slaveId: 4, pdu: []byte{0x03, 0x00, 0x00, 0x00, 0x01}, want: []byte{0x83, statute.ExceptionGatewayPathUnavailable}},
+		{name: "timeout", slaveId: 5, pdu: []byte{0x06, 0x00, 0x01, 0x00, 0x02}, want: []byte{0x86, statute.ExceptionGatewayTargetFailed}},
+		{name: "flush failed", slaveId: 5, pdu: []byte{0x06, 0x00, 0x01, 0x00, 0x02}, flushErr: NoConnectionError, want: []byte{0x86, statute.ExceptionGatewayPathUnavailable}},
+		{name: "unsupported function", slaveId: 1, pdu: []byte{0x09, 0x00}, want: []byte{0x89, statute.ExceptionIllegalFunction}},
+	}
+	for index, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend.lock.Lock()
+			backend.flushErr = test.flushErr
+			backend.lock.Unlock()
+			transactionId := uint16(0x1200 + index)
+			if _, err = conn.Write(statute.BuildTCPFrame(transactionId, test.slaveId, test.pdu)); err != nil {
+				t.Fatal(err)
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			response, err := statute.ReadTCPFrame(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := statute.BuildTCPFrame(transactionId, test.slaveId, test.want); !bytes.Equal(response, want) {
+				t.Fatalf("response = % x, want % x", response, want)
+			}
+		})
+	}
+
+	//广播只转发不应答
+	if _, err = conn.Write(statute.BuildTCPFrame(1, BroadcastSlaveId, []byte{0x06, 0x00, 0x01, 0x00, 0x02})); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if response, err := statute.ReadTCPFrame(reader); err == nil {
+		t.Fatalf("broadcast answered with % x", response)
+	}
+	backend.lock.Lock()
+	defer backend.lock.Unlock()
+	if last := backend.requests[len(backend.requests)-1]; !bytes.Equal(last, []byte{0x00, 0x06, 0x00, 0x01, 0x00, 0x02}) {
+		t.Fatalf("broadcast request = % x", last)
+	}
+	//不支持的功能码不转发
+	if len(backend.requests) != 6 {
+		t.Fatalf("%d requests forwarded, want 6", len(backend.requests))
+	}
+}
+
+func TestModbusConverter(t *testing.T) {
+	for _, frontend := range []StatuteType{ModbusTCP, ModbusRTU} {
+		t.Run(string(frontend), func(t *testing.T) {
+			//下行设备使用另一种协议
+			backendType := ModbusRTU
+			if frontend == ModbusRTU {
+				backendType = ModbusTCP
+			}
+			device := &registerDevice{rtu: backendType == ModbusRTU, registers: []uint16{1, 2, 3}}
+			//下行的读超时短于客户端，设备没有应答时客户端能收到网关的异常响应
+			backend, err := NewModbusTCPPacket("127.0.0.1", serveDevice(t, device.respond), time.Second, replayTimeout/4, time.Second, time.Microsecond, backendType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = backend.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer backend.Close()
+			converter, err := NewModbusConverter(frontend, backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := dialPacket(t, serveGateway(t, converter), frontend)
+			if _, _, err = client.WriteSingleRegister(1, 1, 20); err != nil {
+				t.Fatal(err)
+			}
+			data, err := client.ReadHoldingRegisters(1, 0, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, []byte{0, 1, 0, 20, 0, 3}) {
+				t.Fatalf("data = % x", data)
+			}
+			if _, err = client.ReadHoldingRegisters(1, 2, 2); !isException(err, 0x02) {
+				t.Fatalf("exception error = %v", err)
+			}
+			//设备没有应答
+			if _, err = client.ReadHoldingRegisters(5, 0, 1); !isException(err, statute.ExceptionGatewayTargetFailed) {
+				t.Fatalf("timeout error = %v", err)
+			}
+		})
+	}
+	if _, err := NewModbusConverter("ascii", nil); err == nil {
+		t.Fatal("NewModbusConverter accepted ascii")
+	}
+}
@@ -2,6 +2,7 @@ module github.com/VaccariaSeed/go-modbus
 
 go 1.25.0
 
-require github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
-
-require golang.org/x/sys v0.42.0 // indirect
+require (
+	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	golang.org/x/sys v0.42.0
+)
@@ -0,0 +1,99 @@
+package go_modbus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// ReadTimeoutError 读超时，与statute.ErrTimeout相同
+var ReadTimeoutError = statute.ErrTimeout
+
+const (
+	TransportTCP    = "tcp"    //网络
+	TransportSerial = "serial" //串口
+	TransportUDP    = "udp"    //UDP
+)
+
+// TransactionResult 一次请求的结果
+type TransactionResult string
+
+const (
+	ResultSuccess   TransactionResult = "success"   //成功
+	ResultTimeout   TransactionResult = "timeout"   //超时
+	ResultCsError   TransactionResult = "crc_error" //校验错误
+	ResultException TransactionResult = "exception" //从站返回异常码
+	ResultError     TransactionResult = "error"     //其他错误
+)
+
+// TransactionStats 一次请求的统计信息
+type TransactionStats struct {
+	Transport     string            //传输方式
+	SlaveId       byte              //从站id
+	FuncCode      byte              //功能码
+	Result        TransactionResult //结果
+	ExceptionCode byte              //异常码，仅在Result为ResultException时有效
+	Latency       time.Duration     //从发送到解码完成的耗时，包含重试
+	Attempts      int               //尝试次数，没有重试时为1
+	Err           error             //错误
+}
+
+// Metrics 指标采集接口，每次请求结束后调用一次
+type Metrics interface {
+	ObserveTransaction(stats *TransactionStats)
+}
+
+// SetMetrics 设置指标采集器，传nil关闭采集
+func (T *ModbusPacket) SetMetrics(metrics Metrics) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.metrics = metrics
+}
+
+// 根据错误判定请求结果
+func classifyResult(err error) (result TransactionResult, exceptionCode byte) {
+	if err == nil {
+		return ResultSuccess, 0
+	}
+	var abnormal *statute.ReturnedAbnormalFuncCode
+	if errors.As(err, &abnormal) {
+		return ResultException, abnormal.GetExceptionCode()
+	}
+	if errors.Is(err, statute.ErrCRC) || errors.Is(err, statute.ErrLRC) {
+		return ResultCsError, 0
+	}
+	if isTimeout(err) {
+		return ResultTimeout, 0
+	}
+	return ResultError, 0
+}
+
+// 是否为超时错误
+func isTimeout(err error) bool {
+	if errors.Is(err, ReadTimeoutError) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// 网络读超时归为读超时，同时保留原始错误
+func netReadError(err error) error {
+	if err != nil && !errors.Is(err, ReadTimeoutError) && isTimeout(err) {
+		return fmt.Errorf("%w: %w", ReadTimeoutError, err)
+	}
+	return err
+}
+
+// 串口读超时时底层返回EOF，转换为读超时
+func serialReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ReadTimeoutError, err)
+	}
+	return err
+}
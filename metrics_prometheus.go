@@ -0,0 +1,181 @@
+package go_modbus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets 默认的时延直方图分桶，单位秒
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+var _ Metrics = (*PrometheusMetrics)(nil)
+var _ http.Handler = (*PrometheusMetrics)(nil)
+
+// NewPrometheusMetrics 创建一个Prometheus文本格式的指标采集器
+// namespace 指标名前缀，为空时使用modbus
+// buckets 时延分桶(秒)，为空时使用DefaultLatencyBuckets
+func NewPrometheusMetrics(namespace string, buckets ...float64) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = "modbus"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &PrometheusMetrics{
+		namespace: namespace,
+		buckets:   buckets,
+		requests:  make(map[string]uint64),
+		responses: make(map[string]uint64),
+		timeouts:  make(map[string]uint64),
+		csErrors:  make(map[string]uint64),
+		errors:    make(map[string]uint64),
+		exception: make(map[string]uint64),
+		retries:   make(map[string]uint64),
+		latency:   make(map[string]*histogram),
+		slaves:    make(map[string]*histogram),
+	}
+}
+
+// PrometheusMetrics 按Prometheus文本格式暴露的指标采集器，可直接作为http.Handler挂载供抓取
+type PrometheusMetrics struct {
+	lock      sync.Mutex
+	namespace string
+	buckets   []float64
+	requests  map[string]uint64     //transport,slave,function
+	responses map[string]uint64     //transport,slave,function
+	timeouts  map[string]uint64     //transport,slave,function
+	csErrors  map[string]uint64     //transport,slave,function
+	errors    map[string]uint64     //transport,slave,function
+	exception map[string]uint64     //transport,slave,function,code
+	retries   map[string]uint64     //transport,slave,function
+	latency   map[string]*histogram //transport
+	slaves    map[string]*histogram //transport,slave
+}
+
+type histogram struct {
+	counts []uint64 //每个分桶的计数(非累计)
+	count  uint64
+	sum    float64
+}
+
+func (T *PrometheusMetrics) ObserveTransaction(stats *TransactionStats) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	key := labels("transport", stats.Transport, "slave", strconv.Itoa(int(stats.SlaveId)), "function", strconv.Itoa(int(stats.FuncCode)))
+	T.requests[key]++
+	if stats.Attempts > 1 {
+		T.retries[key] += uint64(stats.Attempts - 1)
+	}
+	switch stats.Result {
+	case ResultSuccess:
+		T.responses[key]++
+	case ResultException:
+		T.responses[key]++
+		T.exception[labels("transport", stats.Transport, "slave", strconv.Itoa(int(stats.SlaveId)), "function", strconv.Itoa(int(stats.FuncCode)), "code", strconv.Itoa(int(stats.ExceptionCode)))]++
+	case ResultTimeout:
+		T.timeouts[key]++
+	case ResultCsError:
+		T.csErrors[key]++
+	default:
+		T.errors[key]++
+	}
+	if stats.Result != ResultSuccess && stats.Result != ResultException {
+		return
+	}
+	seconds := stats.Latency.Seconds()
+	T.observe(T.latency, labels("transport", stats.Transport), seconds)
+	T.observe(T.slaves, labels("transport", stats.Transport, "slave", strconv.Itoa(int(stats.SlaveId))), seconds)
+}
+
+// 在key对应的直方图中记录一次时延
+func (T *PrometheusMetrics) observe(histograms map[string]*histogram, key string, seconds float64) {
+	h, ok := histograms[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(T.buckets))}
+		histograms[key] = h
+	}
+	for index, bucket := range T.buckets {
+		if seconds <= bucket {
+			h.counts[index]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ServeHTTP 输出Prometheus文本格式(0.0.4)
+func (T *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = T.WriteTo(w)
+}
+
+// WriteTo 将当前指标按Prometheus文本格式写入w
+func (T *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	var sb strings.Builder
+	T.writeCounter(&sb, "requests_total", "Modbus requests sent.", T.requests)
+	T.writeCounter(&sb, "responses_total", "Modbus responses received, including exception responses.", T.responses)
+	T.writeCounter(&sb, "timeouts_total", "Modbus requests that timed out.", T.timeouts)
+	T.writeCounter(&sb, "crc_errors_total", "Modbus responses with an invalid checksum.", T.csErrors)
+	T.writeCounter(&sb, "errors_total", "Modbus requests that failed for other reasons.", T.errors)
+	T.writeCounter(&sb, "exceptions_total", "Modbus exception responses by function and exception code.", T.exception)
+	T.writeCounter(&sb, "retries_total", "Modbus requests resent by the retry policy.", T.retries)
+	T.writeHistogram(&sb, "request_duration_seconds", "Modbus request latency by transport.", T.latency)
+	T.writeHistogram(&sb, "slave_request_duration_seconds", "Modbus request latency by slave.", T.slaves)
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func (T *PrometheusMetrics) writeCounter(sb *strings.Builder, name, help string, values map[string]uint64) {
+	name = T.namespace + "_" + name
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(sb, "%s{%s} %d\n", name, key, values[key])
+	}
+}
+
+func (T *PrometheusMetrics) writeHistogram(sb *strings.Builder, name, help string, histograms map[string]*histogram) {
+	name = T.namespace + "_" + name
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, key := range sortedKeys(histograms) {
+		h := histograms[key]
+		var cumulative uint64
+		for index, bucket := range T.buckets {
+			cumulative += h.counts[index]
+			fmt.Fprintf(sb, "%s_bucket{%s,le=\"%s\"} %d\n", name, key, strconv.FormatFloat(bucket, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(sb, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, key, h.count)
+		fmt.Fprintf(sb, "%s_sum{%s} %s\n", name, key, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(sb, "%s_count{%s} %d\n", name, key, h.count)
+	}
+}
+
+// Prometheus标签值只转义反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 生成标签字符串，参数为键值对
+func labels(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for index := 0; index+1 < len(kv); index += 2 {
+		parts = append(parts, kv[index]+`="`+labelEscaper.Replace(kv[index+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
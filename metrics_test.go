@@ -0,0 +1,192 @@
+package go_modbus
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// 记录所有请求统计的采集器
+type recordingMetrics struct {
+	lock  sync.Mutex
+	stats []*TransactionStats
+}
+
+func (m *recordingMetrics) ObserveTransaction(stats *TransactionStats) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.stats = append(m.stats, stats)
+}
+
+func TestClassifyResult(t *testing.T) {
+	tests := []struct {
+		err           error
+		result        TransactionResult
+		exceptionCode byte
+	}{
+		{nil, ResultSuccess, 0},
+		{fmt.Errorf("read: %w", &statute.ReturnedAbnormalFuncCode{}), ResultException, 0},
+		{fmt.Errorf("read: %w", statute.CsError), ResultCsError, 0},
+		{ReadTimeoutError, ResultTimeout, 0},
+		{os.ErrDeadlineExceeded, ResultTimeout, 0},
+		{errors.New("broken pipe"), ResultError, 0},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.err), func(t *testing.T) {
+			result, exceptionCode := classifyResult(test.err)
+			if result != test.result || exceptionCode != test.exceptionCode {
+				t.Fatalf("classifyResult = %s %d, want %s %d", result, exceptionCode, test.result, test.exceptionCode)
+			}
+		})
+	}
+}
+
+func TestObserveTransaction(t *testing.T) {
+	responses := map[string][]byte{
+		"success":   {0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B},
+		"exception": {0x01, 0x83, 0x02, 0xC0, 0xF1},
+		"crc_error": {0x01, 0x03, 0x02, 0x00, 0x2A, 0x00, 0x00},
+		"timeout":   nil,
+	}
+	var current []byte
+	var lock sync.Mutex
+	port := serveDevice(t, func([]byte) []byte {
+		lock.Lock()
+		defer lock.Unlock()
+		return current
+	})
+	packet, err := NewModbusTCPPacket("127.0.0.1", port, time.Second, 100*time.Millisecond, time.Second, time.Millisecond, ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = packet.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer packet.Close()
+	metrics := &recordingMetrics{}
+	packet.SetMetrics(metrics)
+	tests := []struct {
+		name          TransactionResult
+		exceptionCode byte
+	}{
+		{ResultSuccess, 0},
+		{ResultException, 0x02},
+		{ResultCsError, 0},
+		{ResultTimeout, 0},
+	}
+	for index, test := range tests {
+		t.Run(string(test.name), func(t *testing.T) {
+			lock.Lock()
+			current = responses[string(test.name)]
+			lock.Unlock()
+			_, _ = packet.ReadHoldingRegisters(1, 0, 1)
+			metrics.lock.Lock()
+			defer metrics.lock.Unlock()
+			if len(metrics.stats) != index+1 {
+				t.Fatalf("%d transactions observed, want %d", len(metrics.stats), index+1)
+			}
+			stats := metrics.stats[index]
+			if stats.Result != test.name || stats.ExceptionCode != test.exceptionCode {
+				t.Fatalf("stats = %+v", stats)
+			}
+			if stats.Transport != TransportTCP || stats.SlaveId != 1 || stats.FuncCode != statute.ReadHoldingRegisters || stats.Latency <= 0 {
+				t.Fatalf("stats = %+v", stats)
+			}
+		})
+		if test.name == ResultCsError || test.name == ResultTimeout {
+			_ = packet.Flush()
+		}
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := NewPrometheusMetrics("plc", 0.01, 0.1)
+	for _, stats := range []*TransactionStats{
+		{Transport: TransportTCP, SlaveId: 1, FuncCode: 3, Result: ResultSuccess, Latency: 5 * time.Millisecond},
+		{Transport: TransportTCP, SlaveId: 1, FuncCode: 3, Result: ResultSuccess, Latency: 50 * time.Millisecond},
+		{Transport: TransportTCP, SlaveId: 1, FuncCode: 3, Result: ResultException, ExceptionCode: 2, Latency: 500 * time.Millisecond},
+		{Transport: TransportTCP, SlaveId: 1, FuncCode: 6, Result: ResultTimeout, Latency: time.Second},
+		{Transport: TransportTCP, SlaveId: 3, FuncCode: 4, Result: ResultSuccess, Latency: 2 * time.Millisecond, Attempts: 2},
+		{Transport: TransportSerial, SlaveId: 2, FuncCode: 3, Result: ResultCsError, Latency: time.Millisecond},
+		{Transport: TransportSerial, SlaveId: 2, FuncCode: 3, Result: ResultError},
+	} {
+		metrics.ObserveTransaction(stats)
+	}
+	var sb strings.Builder
+	if _, err := metrics.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	output := sb.String()
+	for _, line := range []string{
+		"# TYPE plc_requests_total counter",
+		`plc_requests_total{transport="tcp",slave="1",function="3"} 3`,
+		`plc_requests_total{transport="tcp",slave="1",function="6"} 1`,
+		`plc_requests_total{transport="serial",slave="2",function="3"} 2`,
+		`plc_responses_total{transport="tcp",slave="1",function="3"} 3`,
+		`plc_timeouts_total{transport="tcp",slave="1",function="6"} 1`,
+		`plc_crc_errors_total{transport="serial",slave="2",function="3"} 1`,
+		`plc_errors_total{transport="serial",slave="2",function="3"} 1`,
+		`plc_exceptions_total{transport="tcp",slave="1",function="3",code="2"} 1`,
+		`plc_retries_total{transport="tcp",slave="3",function="4"} 1`,
+		"# TYPE plc_request_duration_seconds histogram",
+		`plc_request_duration_seconds_bucket{transport="tcp",le="0.01"} 2`,
+		`plc_request_duration_seconds_bucket{transport="tcp",le="0.1"} 3`,
+		`plc_request_duration_seconds_bucket{transport="tcp",le="+Inf"} 4`,
+		`plc_request_duration_seconds_sum{transport="tcp"} 0.557`,
+		`plc_request_duration_seconds_count{transport="tcp"} 4`,
+		"# TYPE plc_slave_request_duration_seconds histogram",
+		`plc_slave_request_duration_seconds_bucket{transport="tcp",slave="1",le="0.01"} 1`,
+		`plc_slave_request_duration_seconds_bucket{transport="tcp",slave="1",le="0.1"} 2`,
+		`plc_slave_request_duration_seconds_bucket{transport="tcp",slave="1",le="+Inf"} 3`,
+		`plc_slave_request_duration_seconds_sum{transport="tcp",slave="1"} 0.555`,
+		`plc_slave_request_duration_seconds_count{transport="tcp",slave="1"} 3`,
+		`plc_slave_request_duration_seconds_bucket{transport="tcp",slave="3",le="0.01"} 1`,
+		`plc_slave_request_duration_seconds_count{transport="tcp",slave="3"} 1`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, output)
+		}
+	}
+	//超时和错误不计入时延
+	if strings.Contains(output, `duration_seconds_count{transport="serial"`) {
+		t.Errorf("failed requests recorded in the latency histogram:\n%s", output)
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`tcp`, `transport="tcp"`},
+		{`a"b`, `transport="a\"b"`},
+		{`a\b`, `transport="a\\b"`},
+		{"a\nb", `transport="a\nb"`},
+		//其他字符原样输出，不使用Go的转义
+		{"a\tb", "transport=\"a\tb\""},
+		{"温度", `transport="温度"`},
+	}
+	for _, test := range tests {
+		if got := labels("transport", test.value); got != test.want {
+			t.Errorf("labels(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+	metrics := NewPrometheusMetrics("")
+	metrics.ObserveTransaction(&TransactionStats{Transport: `my "bus"`, SlaveId: 1, FuncCode: 3, Result: ResultSuccess})
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %s", contentType)
+	}
+	if want := `modbus_requests_total{transport="my \"bus\"",slave="1",function="3"} 1`; !strings.Contains(recorder.Body.String(), want+"\n") {
+		t.Fatalf("missing %q in\n%s", want, recorder.Body.String())
+	}
+}
@@ -0,0 +1,379 @@
+// Package mock 提供go_modbus.Client的模拟实现，用于业务代码的单元测试
+//
+//	client := mock.NewClient()
+//	client.ExpectReadHoldingRegisters(1, 100, 2).ReturnRegisters(7, 8)
+//	client.ExpectWriteSingleRegister(1, 10, 5).ReturnException(0x02)
+//	// 将client注入被测代码 ...
+//	if err := client.Verify(); err != nil {
+//		t.Fatal(err)
+//	}
+package mock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// UnexpectedCallError 调用没有匹配的预期
+var UnexpectedCallError = errors.New("unexpected call")
+
+var _ modbus.Client = (*Client)(nil)
+
+// Call 一次调用及其参数
+type Call struct {
+	Method    string
+	SlaveId   byte
+	FuncCode  byte                 //CustomRequest和Broadcast的功能码
+	Address   uint16               //起始地址
+	Quantity  uint16               //读取的数量
+	Registers []uint16             //写入的寄存器
+	Coils     []statute.CoilStatus //写入的线圈
+	Data      []byte               //CustomRequest和Broadcast的数据域
+}
+
+func (c *Call) String() string {
+	switch c.Method {
+	case "Connect", "Close", "Flush":
+		return c.Method + "()"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s(slave=%d", c.Method, c.SlaveId)
+	switch c.Method {
+	case "ReportServerId":
+	case "CustomRequest", "Broadcast":
+		fmt.Fprintf(&sb, " funcCode=0x%02X data=% x", c.FuncCode, c.Data)
+	default:
+		fmt.Fprintf(&sb, " address=%d", c.Address)
+		if c.Quantity > 0 {
+			fmt.Fprintf(&sb, " quantity=%d", c.Quantity)
+		}
+		if c.Registers != nil {
+			fmt.Fprintf(&sb, " registers=%v", c.Registers)
+		}
+		if c.Coils != nil {
+			fmt.Fprintf(&sb, " coils=%v", c.Coils)
+		}
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// Expectation 一个预期的调用及其返回
+// 未设置返回时读操作返回零值，写操作回显请求
+type Expectation struct {
+	call  *Call
+	data  []byte
+	coils []statute.CoilStatus
+	err   error
+	times int //预期次数，小于0表示不限
+	count int //实际次数
+}
+
+// Return 设置读寄存器、ReportServerId和CustomRequest返回的数据
+func (e *Expectation) Return(data []byte) *Expectation {
+	e.data = data
+	return e
+}
+
+// ReturnRegisters 以寄存器值设置读寄存器返回的数据
+func (e *Expectation) ReturnRegisters(values ...uint16) *Expectation {
+	e.data = make([]byte, 2*len(values))
+	for index, value := range values {
+		binary.BigEndian.PutUint16(e.data[2*index:], value)
+	}
+	return e
+}
+
+// ReturnCoils 设置读线圈和读离散输入返回的状态
+func (e *Expectation) ReturnCoils(status ...statute.CoilStatus) *Expectation {
+	e.coils = status
+	return e
+}
+
+// ReturnError 设置返回的错误
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// ReturnException 设置从站返回异常码
+func (e *Expectation) ReturnException(exceptionCode byte) *Expectation {
+	funcCode := e.call.FuncCode
+	e.err = statute.NewExceptionError(funcCode, exceptionCode)
+	return e
+}
+
+// Times 设置预期的调用次数，默认1次
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes 不限调用次数，也可以不调用
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+// NewClient 创建一个模拟客户端，Unit为1
+func NewClient() *Client {
+	return &Client{unit: 1}
+}
+
+// Client 模拟客户端，记录所有调用并按预期返回
+// Connect、Close和Flush没有预期时直接成功，其他调用没有匹配的预期时返回UnexpectedCallError
+type Client struct {
+	lock         sync.Mutex
+	expectations []*Expectation
+	calls        []*Call
+	unexpected   []*Call
+	unit         byte
+}
+
+// SetUnit 设置Unit返回的从站id
+func (m *Client) SetUnit(unit byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.unit = unit
+}
+
+// Unit 返回配置的从站id，不记录为调用
+func (m *Client) Unit() byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.unit
+}
+
+// Calls 返回所有调用的记录
+func (m *Client) Calls() []*Call {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*Call(nil), m.calls...)
+}
+
+// Reset 清除所有预期和调用记录
+func (m *Client) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expectations, m.calls, m.unexpected = nil, nil, nil
+}
+
+// Verify 检查所有预期是否都已满足，且没有意外的调用
+func (m *Client) Verify() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var errs []error
+	for _, e := range m.expectations {
+		if e.times >= 0 && e.count != e.times {
+			errs = append(errs, fmt.Errorf("expected %s %d times, called %d times", e.call, e.times, e.count))
+		}
+	}
+	for _, call := range m.unexpected {
+		errs = append(errs, fmt.Errorf("%w: %s", UnexpectedCallError, call))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Client) expect(call *Call) *Expectation {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	e := &Expectation{call: call, times: 1}
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// 记录调用并查找第一个匹配且次数未满的预期
+func (m *Client) invoke(call *Call) (*Expectation, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls = append(m.calls, call)
+	for _, e := range m.expectations {
+		if (e.times < 0 || e.count < e.times) && reflect.DeepEqual(e.call, call) {
+			e.count++
+			return e, e.err
+		}
+	}
+	switch call.Method {
+	case "Connect", "Close", "Flush":
+		return nil, nil
+	}
+	m.unexpected = append(m.unexpected, call)
+	return nil, fmt.Errorf("%w: %s", UnexpectedCallError, call)
+}
+
+// ExpectConnect 预期Connect
+func (m *Client) ExpectConnect() *Expectation {
+	return m.expect(&Call{Method: "Connect"})
+}
+
+// ExpectClose 预期Close
+func (m *Client) ExpectClose() *Expectation {
+	return m.expect(&Call{Method: "Close"})
+}
+
+// ExpectFlush 预期Flush
+func (m *Client) ExpectFlush() *Expectation {
+	return m.expect(&Call{Method: "Flush"})
+}
+
+// ExpectReadCoils 预期读线圈
+func (m *Client) ExpectReadCoils(slaveId byte, address, number uint16) *Expectation {
+	return m.expect(&Call{Method: "ReadCoils", SlaveId: slaveId, FuncCode: statute.ReadCoils, Address: address, Quantity: number})
+}
+
+// ExpectReadDiscreteInputs 预期读离散输入
+func (m *Client) ExpectReadDiscreteInputs(slaveId byte, address, number uint16) *Expectation {
+	return m.expect(&Call{Method: "ReadDiscreteInputs", SlaveId: slaveId, FuncCode: statute.ReadDiscreteInputs, Address: address, Quantity: number})
+}
+
+// ExpectReadHoldingRegisters 预期读保持寄存器
+func (m *Client) ExpectReadHoldingRegisters(slaveId byte, address, number uint16) *Expectation {
+	return m.expect(&Call{Method: "ReadHoldingRegisters", SlaveId: slaveId, FuncCode: statute.ReadHoldingRegisters, Address: address, Quantity: number})
+}
+
+// ExpectReadInputRegisters 预期读输入寄存器
+func (m *Client) ExpectReadInputRegisters(slaveId byte, address, number uint16) *Expectation {
+	return m.expect(&Call{Method: "ReadInputRegisters", SlaveId: slaveId, FuncCode: statute.ReadInputRegisters, Address: address, Quantity: number})
+}
+
+// ExpectWriteSingleCoil 预期写单个线圈
+func (m *Client) ExpectWriteSingleCoil(slaveId byte, address uint16, value statute.CoilStatus) *Expectation {
+	return m.expect(&Call{Method: "WriteSingleCoil", SlaveId: slaveId, FuncCode: statute.WriteSingleCoil, Address: address, Coils: []statute.CoilStatus{value}})
+}
+
+// ExpectWriteSingleRegister 预期写单个保持寄存器
+func (m *Client) ExpectWriteSingleRegister(slaveId byte, address uint16, value uint16) *Expectation {
+	return m.expect(&Call{Method: "WriteSingleRegister", SlaveId: slaveId, FuncCode: statute.WriteSingleRegister, Address: address, Registers: []uint16{value}})
+}
+
+// ExpectWriteMultipleCoils 预期写多个线圈
+func (m *Client) ExpectWriteMultipleCoils(slaveId byte, address uint16, status ...statute.CoilStatus) *Expectation {
+	return m.expect(&Call{Method: "WriteMultipleCoils", SlaveId: slaveId, FuncCode: statute.WriteMultipleCoils, Address: address, Coils: status})
+}
+
+// ExpectWriteMultipleRegisters 预期写多个保持寄存器
+func (m *Client) ExpectWriteMultipleRegisters(slaveId byte, address uint16, value ...uint16) *Expectation {
+	return m.expect(&Call{Method: "WriteMultipleRegisters", SlaveId: slaveId, FuncCode: statute.WriteMultipleRegisters, Address: address, Registers: value})
+}
+
+// ExpectReportServerId 预期报告从站id
+func (m *Client) ExpectReportServerId(slaveId byte) *Expectation {
+	return m.expect(&Call{Method: "ReportServerId", SlaveId: slaveId, FuncCode: statute.ReportServerId})
+}
+
+// ExpectCustomRequest 预期自定义请求
+func (m *Client) ExpectCustomRequest(slaveId, funcCode byte, data []byte) *Expectation {
+	return m.expect(&Call{Method: "CustomRequest", SlaveId: slaveId, FuncCode: funcCode, Data: data})
+}
+
+// ExpectBroadcast 预期广播
+func (m *Client) ExpectBroadcast(funcCode byte, data []byte) *Expectation {
+	return m.expect(&Call{Method: "Broadcast", SlaveId: modbus.BroadcastSlaveId, FuncCode: funcCode, Data: data})
+}
+
+func (m *Client) Connect() error {
+	_, err := m.invoke(&Call{Method: "Connect"})
+	return err
+}
+
+func (m *Client) Close() error {
+	_, err := m.invoke(&Call{Method: "Close"})
+	return err
+}
+
+func (m *Client) Flush() error {
+	_, err := m.invoke(&Call{Method: "Flush"})
+	return err
+}
+
+func (m *Client) ReadCoils(slaveId byte, address, number uint16) (uint16, []statute.CoilStatus, error) {
+	return m.readBits(&Call{Method: "ReadCoils", SlaveId: slaveId, FuncCode: statute.ReadCoils, Address: address, Quantity: number})
+}
+
+func (m *Client) ReadDiscreteInputs(slaveId byte, address, number uint16) (uint16, []statute.CoilStatus, error) {
+	return m.readBits(&Call{Method: "ReadDiscreteInputs", SlaveId: slaveId, FuncCode: statute.ReadDiscreteInputs, Address: address, Quantity: number})
+}
+
+func (m *Client) readBits(call *Call) (uint16, []statute.CoilStatus, error) {
+	e, err := m.invoke(call)
+	if err != nil {
+		return 0, nil, err
+	}
+	result := make([]statute.CoilStatus, call.Quantity)
+	copy(result, e.coils)
+	return uint16(len(result)), result, nil
+}
+
+func (m *Client) ReadHoldingRegisters(slaveId byte, address, number uint16) ([]byte, error) {
+	return m.readRegisters(&Call{Method: "ReadHoldingRegisters", SlaveId: slaveId, FuncCode: statute.ReadHoldingRegisters, Address: address, Quantity: number})
+}
+
+func (m *Client) ReadInputRegisters(slaveId byte, address, number uint16) ([]byte, error) {
+	return m.readRegisters(&Call{Method: "ReadInputRegisters", SlaveId: slaveId, FuncCode: statute.ReadInputRegisters, Address: address, Quantity: number})
+}
+
+func (m *Client) readRegisters(call *Call) ([]byte, error) {
+	e, err := m.invoke(call)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 2*int(call.Quantity))
+	copy(data, e.data)
+	return data, nil
+}
+
+func (m *Client) WriteSingleCoil(slaveId byte, address uint16, value statute.CoilStatus) (uint16, statute.CoilStatus, error) {
+	if _, err := m.invoke(&Call{Method: "WriteSingleCoil", SlaveId: slaveId, FuncCode: statute.WriteSingleCoil, Address: address, Coils: []statute.CoilStatus{value}}); err != nil {
+		return 0, statute.OFF, err
+	}
+	return address, value, nil
+}
+
+func (m *Client) WriteSingleRegister(slaveId byte, address uint16, value uint16) (uint16, uint16, error) {
+	if _, err := m.invoke(&Call{Method: "WriteSingleRegister", SlaveId: slaveId, FuncCode: statute.WriteSingleRegister, Address: address, Registers: []uint16{value}}); err != nil {
+		return 0, 0, err
+	}
+	return address, value, nil
+}
+
+func (m *Client) WriteMultipleCoils(slaveId byte, address uint16, status ...statute.CoilStatus) (uint16, uint16, error) {
+	if _, err := m.invoke(&Call{Method: "WriteMultipleCoils", SlaveId: slaveId, FuncCode: statute.WriteMultipleCoils, Address: address, Coils: status}); err != nil {
+		return 0, 0, err
+	}
+	return address, uint16(len(status)), nil
+}
+
+func (m *Client) WriteMultipleRegisters(slaveId byte, address uint16, value ...uint16) (uint16, uint16, error) {
+	if _, err := m.invoke(&Call{Method: "WriteMultipleRegisters", SlaveId: slaveId, FuncCode: statute.WriteMultipleRegisters, Address: address, Registers: value}); err != nil {
+		return 0, 0, err
+	}
+	return address, uint16(len(value)), nil
+}
+
+func (m *Client) ReportServerId(slaveId byte) ([]byte, error) {
+	e, err := m.invoke(&Call{Method: "ReportServerId", SlaveId: slaveId, FuncCode: statute.ReportServerId})
+	if err != nil {
+		return nil, err
+	}
+	return e.data, nil
+}
+
+func (m *Client) CustomRequest(slaveId, funcCode byte, data []byte) ([]byte, error) {
+	e, err := m.invoke(&Call{Method: "CustomRequest", SlaveId: slaveId, FuncCode: funcCode, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return e.data, nil
+}
+
+func (m *Client) Broadcast(funcCode byte, data []byte) error {
+	_, err := m.invoke(&Call{Method: "Broadcast", SlaveId: modbus.BroadcastSlaveId, FuncCode: funcCode, Data: data})
+	return err
+}
@@ -0,0 +1,196 @@
+package mock
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestClient(t *testing.T) {
+	failure := errors.New("link down")
+	tests := []struct {
+		name   string
+		setup  func(m *Client)
+		run    func(t *testing.T, m *Client)
+		verify string //Verify错误应包含的内容，为空表示通过
+	}{
+		{
+			name:  "registers",
+			setup: func(m *Client) { m.ExpectReadHoldingRegisters(1, 100, 2).ReturnRegisters(7, 8) },
+			run: func(t *testing.T, m *Client) {
+				data, err := m.ReadHoldingRegisters(1, 100, 2)
+				if err != nil || !bytes.Equal(data, []byte{0, 7, 0, 8}) {
+					t.Fatalf("ReadHoldingRegisters = % x, %v", data, err)
+				}
+			},
+		},
+		{
+			name:  "zero value without return",
+			setup: func(m *Client) { m.ExpectReadInputRegisters(1, 0, 1) },
+			run: func(t *testing.T, m *Client) {
+				data, err := m.ReadInputRegisters(1, 0, 1)
+				if err != nil || !bytes.Equal(data, []byte{0, 0}) {
+					t.Fatalf("ReadInputRegisters = % x, %v", data, err)
+				}
+			},
+		},
+		{
+			name:  "coils",
+			setup: func(m *Client) { m.ExpectReadCoils(1, 0, 3).ReturnCoils(statute.ON, statute.OFF, statute.ON) },
+			run: func(t *testing.T, m *Client) {
+				n, coils, err := m.ReadCoils(1, 0, 3)
+				if err != nil || n != 3 || !slices.Equal(coils, []statute.CoilStatus{statute.ON, statute.OFF, statute.ON}) {
+					t.Fatalf("ReadCoils = %d %v, %v", n, coils, err)
+				}
+			},
+		},
+		{
+			name:  "write echoes request",
+			setup: func(m *Client) { m.ExpectWriteMultipleRegisters(1, 10, 1, 2, 3) },
+			run: func(t *testing.T, m *Client) {
+				address, quantity, err := m.WriteMultipleRegisters(1, 10, 1, 2, 3)
+				if err != nil || address != 10 || quantity != 3 {
+					t.Fatalf("WriteMultipleRegisters = %d %d, %v", address, quantity, err)
+				}
+			},
+		},
+		{
+			name:  "exception",
+			setup: func(m *Client) { m.ExpectWriteSingleRegister(1, 10, 5).ReturnException(0x02) },
+			run: func(t *testing.T, m *Client) {
+				_, _, err := m.WriteSingleRegister(1, 10, 5)
+				if !errors.Is(err, statute.ErrIllegalDataAddress) {
+					t.Fatalf("error = %v, want illegal data address", err)
+				}
+			},
+		},
+		{
+			name:  "error",
+			setup: func(m *Client) { m.ExpectReportServerId(1).ReturnError(failure) },
+			run: func(t *testing.T, m *Client) {
+				if _, err := m.ReportServerId(1); !errors.Is(err, failure) {
+					t.Fatalf("error = %v, want %v", err, failure)
+				}
+			},
+		},
+		{
+			name:  "times",
+			setup: func(m *Client) { m.ExpectReadHoldingRegisters(1, 0, 1).Times(2) },
+			run: func(t *testing.T, m *Client) {
+				for range 2 {
+					if _, err := m.ReadHoldingRegisters(1, 0, 1); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+		},
+		{
+			name:   "called fewer times",
+			setup:  func(m *Client) { m.ExpectReadHoldingRegisters(1, 0, 1).Times(2) },
+			run:    func(t *testing.T, m *Client) { _, _ = m.ReadHoldingRegisters(1, 0, 1) },
+			verify: "expected ReadHoldingRegisters(slave=1 address=0 quantity=1) 2 times, called 1 times",
+		},
+		{
+			name:   "not called",
+			setup:  func(m *Client) { m.ExpectWriteSingleCoil(1, 3, statute.ON) },
+			run:    func(t *testing.T, m *Client) {},
+			verify: "called 0 times",
+		},
+		{
+			name:  "any times",
+			setup: func(m *Client) { m.ExpectReadCoils(1, 0, 1).AnyTimes() },
+			run: func(t *testing.T, m *Client) {
+				for range 3 {
+					if _, _, err := m.ReadCoils(1, 0, 1); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+		},
+		{
+			name:  "unexpected call",
+			setup: func(m *Client) { m.ExpectReadHoldingRegisters(1, 0, 1) },
+			run: func(t *testing.T, m *Client) {
+				_, _ = m.ReadHoldingRegisters(1, 0, 1)
+				if _, err := m.ReadHoldingRegisters(2, 0, 1); !errors.Is(err, UnexpectedCallError) {
+					t.Fatalf("error = %v, want UnexpectedCallError", err)
+				}
+			},
+			verify: "unexpected call: ReadHoldingRegisters(slave=2 address=0 quantity=1)",
+		},
+		{
+			name:  "connect without expectation",
+			setup: func(m *Client) {},
+			run: func(t *testing.T, m *Client) {
+				if err := m.Connect(); err != nil {
+					t.Fatal(err)
+				}
+				if err := m.Close(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:  "custom request",
+			setup: func(m *Client) { m.ExpectCustomRequest(1, 0x41, []byte{1, 2}).Return([]byte{9}) },
+			run: func(t *testing.T, m *Client) {
+				data, err := m.CustomRequest(1, 0x41, []byte{1, 2})
+				if err != nil || !bytes.Equal(data, []byte{9}) {
+					t.Fatalf("CustomRequest = % x, %v", data, err)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewClient()
+			test.setup(m)
+			test.run(t, m)
+			err := m.Verify()
+			if test.verify == "" {
+				if err != nil {
+					t.Fatalf("Verify = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.verify) {
+				t.Fatalf("Verify = %v, want %q", err, test.verify)
+			}
+		})
+	}
+}
+
+func TestCallsAndReset(t *testing.T) {
+	m := NewClient()
+	m.ExpectReadHoldingRegisters(1, 0, 1)
+	_, _ = m.ReadHoldingRegisters(1, 0, 1)
+	_ = m.Flush()
+	calls := m.Calls()
+	if len(calls) != 2 || calls[0].Method != "ReadHoldingRegisters" || calls[1].String() != "Flush()" {
+		t.Fatalf("Calls = %v", calls)
+	}
+	_, _ = m.ReadHoldingRegisters(1, 0, 1)
+	m.Reset()
+	if err := m.Verify(); err != nil {
+		t.Fatalf("Verify after Reset = %v", err)
+	}
+	if calls := m.Calls(); len(calls) != 0 {
+		t.Fatalf("Calls after Reset = %v", calls)
+	}
+}
+
+func TestUnit(t *testing.T) {
+	m := NewClient()
+	if m.Unit() != 1 {
+		t.Fatalf("Unit = %d, want 1", m.Unit())
+	}
+	m.SetUnit(7)
+	m.Reset()
+	if m.Unit() != 7 || len(m.Calls()) != 0 {
+		t.Fatalf("Unit = %d, calls = %v", m.Unit(), m.Calls())
+	}
+}
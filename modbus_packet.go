@@ -2,6 +2,7 @@ package go_modbus
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,20 +12,97 @@ import (
 type ModbusPacket struct {
 	lock sync.Mutex
 	statute.ModbusCodec
-	write      func([]byte) (int, error)       //写
-	rwInterval time.Duration                   //读写间隔
-	read       func() (data []byte, err error) //读
+	write       func([]byte) (int, error)       //写
+	rwInterval  time.Duration                   //读写间隔
+	read        func() (data []byte, err error) //读
+	flush       func() error                    //丢弃残留的数据，重试前调用
+	transport   string                          //传输方式
+	statuteType StatuteType                     //协议类型
+	metrics     Metrics                         //指标采集
+	tracer      Tracer                          //报文追踪
+	retry       *RetryPolicy                    //默认的重试策略
+	unit        byte                            //配置的从站id
 }
 
-// 读写
-func (T *ModbusPacket) wr(frame []byte) (data []byte, err error) {
+// SetUnit 设置配置的从站id，默认1，ClientConfig.Build按配置设置
+func (T *ModbusPacket) SetUnit(unit byte) {
 	T.lock.Lock()
 	defer T.lock.Unlock()
-	if _, err = T.write(frame); err != nil {
+	T.unit = unit
+}
+
+// Unit 配置的从站id，请求时作为slaveId传入
+func (T *ModbusPacket) Unit() byte {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	return T.unit
+}
+
+// 读写，调用方需持有锁，保证组帧、收发和解析期间编码器的快照不被其他请求修改
+// policy为nil时使用客户端默认的策略，重试时重新发送同一帧报文
+func (T *ModbusPacket) wr(policy *RetryPolicy, slaveId, funcCode byte, frame []byte) (data []byte, err error) {
+	if policy == nil {
+		policy = T.retry
+	}
+	start := time.Now()
+	attempt := 1
+	defer func() {
+		T.observe(slaveId, funcCode, start, attempt, err)
+	}()
+	for {
+		data, err = T.send(slaveId, funcCode, frame, attempt)
+		if !policy.retry(funcCode, attempt, err) {
+			return data, err
+		}
+		time.Sleep(policy.backoff(attempt))
+		if T.flush != nil {
+			_ = T.flush()
+		}
+		attempt++
+	}
+}
+
+// 发送一帧报文并读取响应
+func (T *ModbusPacket) send(slaveId, funcCode byte, frame []byte, attempt int) ([]byte, error) {
+	_, err := T.write(frame)
+	T.trace(DirectionOutbound, slaveId, funcCode, attempt, frame, err)
+	if err != nil {
 		return nil, err
 	}
 	time.Sleep(T.rwInterval)
-	return T.read()
+	data, err := T.read()
+	raw := T.ObtainIntermediary().ObtainRawResponse()
+	if len(raw) > 0 && isTimeout(err) && !errors.Is(err, statute.ErrShortFrame) {
+		//收到部分报文后超时
+		err = fmt.Errorf("%w: %w", statute.ErrShortFrame, err)
+	}
+	T.trace(DirectionInbound, slaveId, funcCode, attempt, raw, err)
+	return data, err
+}
+
+// 上报一次请求的指标
+func (T *ModbusPacket) observe(slaveId, funcCode byte, start time.Time, attempts int, err error) {
+	if T.metrics == nil {
+		return
+	}
+	result, exceptionCode := classifyResult(err)
+	T.metrics.ObserveTransaction(&TransactionStats{
+		Transport:     T.transport,
+		SlaveId:       slaveId,
+		FuncCode:      funcCode,
+		Result:        result,
+		ExceptionCode: exceptionCode,
+		Latency:       time.Since(start),
+		Attempts:      attempts,
+		Err:           err,
+	})
+}
+
+// 为请求的错误附加从站id、功能码和地址，address小于0表示没有地址
+func requestError(err *error, slaveId, funcCode byte, address int) {
+	if *err != nil {
+		*err = &statute.RequestError{SlaveId: slaveId, FuncCode: funcCode, Address: address, Err: *err}
+	}
 }
 
 // ReadCoils 读线圈
@@ -32,8 +110,15 @@ func (T *ModbusPacket) wr(frame []byte) (data []byte, err error) {
 // address 寄存器起始地址
 // number 寄存器数量
 func (T *ModbusPacket) ReadCoils(slaveId byte, address, number uint16) (length uint16, result []statute.CoilStatus, err error) {
+	return T.readCoils(nil, slaveId, address, number)
+}
+
+func (T *ModbusPacket) readCoils(policy *RetryPolicy, slaveId byte, address, number uint16) (length uint16, result []statute.CoilStatus, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.ReadCoils, int(address))
 	req := T.BuildReadCoils(slaveId, address, number)
-	data, err := T.wr(req)
+	data, err := T.wr(policy, slaveId, statute.ReadCoils, req)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -45,8 +130,15 @@ func (T *ModbusPacket) ReadCoils(slaveId byte, address, number uint16) (length u
 // address 寄存器起始地址
 // number 寄存器数量
 func (T *ModbusPacket) ReadDiscreteInputs(slaveId byte, address, number uint16) (length uint16, result []statute.CoilStatus, err error) {
+	return T.readDiscreteInputs(nil, slaveId, address, number)
+}
+
+func (T *ModbusPacket) readDiscreteInputs(policy *RetryPolicy, slaveId byte, address, number uint16) (length uint16, result []statute.CoilStatus, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.ReadDiscreteInputs, int(address))
 	req := T.BuildReadDiscreteInputs(slaveId, address, number)
-	data, err := T.wr(req)
+	data, err := T.wr(policy, slaveId, statute.ReadDiscreteInputs, req)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -57,14 +149,21 @@ func (T *ModbusPacket) ReadDiscreteInputs(slaveId byte, address, number uint16)
 // slaveId 从站id
 // addr 寄存器起始地址
 // number 寄存器数量
-func (T *ModbusPacket) ReadHoldingRegisters(slaveId byte, address, number uint16) ([]byte, error) {
+func (T *ModbusPacket) ReadHoldingRegisters(slaveId byte, address, number uint16) (data []byte, err error) {
+	return T.readHoldingRegisters(nil, slaveId, address, number)
+}
+
+func (T *ModbusPacket) readHoldingRegisters(policy *RetryPolicy, slaveId byte, address, number uint16) (data []byte, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.ReadHoldingRegisters, int(address))
 	req := T.BuildReadHoldingRegisters(slaveId, address, number)
-	data, err := T.wr(req)
+	data, err = T.wr(policy, slaveId, statute.ReadHoldingRegisters, req)
 	if err != nil {
 		return nil, err
 	}
 	if uint16(len(data)) != number*2 {
-		return nil, errors.New("ReadHoldingRegisters: length mismatch")
+		return nil, fmt.Errorf("%w: got %d bytes for %d registers", statute.ErrProtocolViolation, len(data), number)
 	}
 	return data, nil
 }
@@ -73,14 +172,21 @@ func (T *ModbusPacket) ReadHoldingRegisters(slaveId byte, address, number uint16
 // slaveId 从站id
 // addr 寄存器起始地址
 // number 寄存器数量
-func (T *ModbusPacket) ReadInputRegisters(slaveId byte, address, number uint16) ([]byte, error) {
+func (T *ModbusPacket) ReadInputRegisters(slaveId byte, address, number uint16) (data []byte, err error) {
+	return T.readInputRegisters(nil, slaveId, address, number)
+}
+
+func (T *ModbusPacket) readInputRegisters(policy *RetryPolicy, slaveId byte, address, number uint16) (data []byte, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.ReadInputRegisters, int(address))
 	req := T.BuildReadInputRegisters(slaveId, address, number)
-	data, err := T.wr(req)
+	data, err = T.wr(policy, slaveId, statute.ReadInputRegisters, req)
 	if err != nil {
 		return nil, err
 	}
 	if uint16(len(data)) != number*2 {
-		return nil, errors.New("ReadHoldingRegisters: length mismatch")
+		return nil, fmt.Errorf("%w: got %d bytes for %d registers", statute.ErrProtocolViolation, len(data), number)
 	}
 	return data, nil
 }
@@ -93,8 +199,15 @@ func (T *ModbusPacket) ReadInputRegisters(slaveId byte, address, number uint16)
 // addr 地址
 // status true-ON false-OFF
 func (T *ModbusPacket) WriteSingleCoil(slaveId byte, address uint16, value statute.CoilStatus) (addr uint16, status statute.CoilStatus, err error) {
+	return T.writeSingleCoil(nil, slaveId, address, value)
+}
+
+func (T *ModbusPacket) writeSingleCoil(policy *RetryPolicy, slaveId byte, address uint16, value statute.CoilStatus) (addr uint16, status statute.CoilStatus, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.WriteSingleCoil, int(address))
 	req := T.BuildWriteSingleCoil(slaveId, address, value)
-	data, err := T.wr(req)
+	data, err := T.wr(policy, slaveId, statute.WriteSingleCoil, req)
 	if err != nil {
 		return 0, statute.OFF, err
 	}
@@ -107,7 +220,7 @@ func (T *ModbusPacket) WriteSingleCoil(slaveId byte, address uint16, value statu
 	} else if statusValue == 0x0000 {
 		status = statute.OFF
 	} else {
-		return 0, false, errors.New("invalid status")
+		return 0, false, fmt.Errorf("%w: invalid coil value 0x%04X", statute.ErrProtocolViolation, statusValue)
 	}
 	return addrValue, status, nil
 }
@@ -117,8 +230,15 @@ func (T *ModbusPacket) WriteSingleCoil(slaveId byte, address uint16, value statu
 // addr 寄存器起始地址
 // value 设定值
 func (T *ModbusPacket) WriteSingleRegister(slaveId byte, address uint16, value uint16) (addr, status uint16, err error) {
+	return T.writeSingleRegister(nil, slaveId, address, value)
+}
+
+func (T *ModbusPacket) writeSingleRegister(policy *RetryPolicy, slaveId byte, address uint16, value uint16) (addr, status uint16, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.WriteSingleRegister, int(address))
 	req := T.BuildWriteSingleRegister(slaveId, address, value)
-	data, err := T.wr(req)
+	data, err := T.wr(policy, slaveId, statute.WriteSingleRegister, req)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -130,11 +250,18 @@ func (T *ModbusPacket) WriteSingleRegister(slaveId byte, address uint16, value u
 // addr 寄存器起始地址
 // status 线圈状态
 func (T *ModbusPacket) WriteMultipleCoils(slaveId byte, address uint16, status ...statute.CoilStatus) (addr, size uint16, err error) {
+	return T.writeMultipleCoils(nil, slaveId, address, status...)
+}
+
+func (T *ModbusPacket) writeMultipleCoils(policy *RetryPolicy, slaveId byte, address uint16, status ...statute.CoilStatus) (addr, size uint16, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.WriteMultipleCoils, int(address))
 	req, err := T.BuildWriteMultipleCoils(slaveId, address, status...)
 	if err != nil {
 		return 0, 0, err
 	}
-	data, err := T.wr(req)
+	data, err := T.wr(policy, slaveId, statute.WriteMultipleCoils, req)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -143,13 +270,68 @@ func (T *ModbusPacket) WriteMultipleCoils(slaveId byte, address uint16, status .
 
 // WriteMultipleRegisters 写多个保持寄存器
 func (T *ModbusPacket) WriteMultipleRegisters(slaveId byte, address uint16, value ...uint16) (addr, number uint16, err error) {
+	return T.writeMultipleRegisters(nil, slaveId, address, value...)
+}
+
+func (T *ModbusPacket) writeMultipleRegisters(policy *RetryPolicy, slaveId byte, address uint16, value ...uint16) (addr, number uint16, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.WriteMultipleRegisters, int(address))
 	req, err := T.BuildWriteMultipleRegisters(slaveId, address, value...)
 	if err != nil {
 		return 0, 0, err
 	}
-	resp, err := T.wr(req)
+	resp, err := T.wr(policy, slaveId, statute.WriteMultipleRegisters, req)
 	if err != nil {
 		return 0, 0, err
 	}
 	return T.ObtainIntermediary().PraseWriteMultipleRegisters(resp)
 }
+
+// ReportServerId 报告从站id
+// slaveId 从站id
+// 返回值为从站id、运行状态及附加数据，格式由设备定义
+func (T *ModbusPacket) ReportServerId(slaveId byte) (data []byte, err error) {
+	return T.reportServerId(nil, slaveId)
+}
+
+func (T *ModbusPacket) reportServerId(policy *RetryPolicy, slaveId byte) (data []byte, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, statute.ReportServerId, -1)
+	req := T.BuildReportServerId(slaveId)
+	return T.wr(policy, slaveId, statute.ReportServerId, req)
+}
+
+// CustomRequest 自定义请求，可用于库未封装的功能码
+// slaveId 从站id
+// funcCode 功能码
+// data 功能码之后的数据域
+// 返回值为响应中功能码之后的全部数据，从站返回异常时可以用errors.As取得*statute.ReturnedAbnormalFuncCode
+func (T *ModbusPacket) CustomRequest(slaveId, funcCode byte, data []byte) (result []byte, err error) {
+	return T.customRequest(nil, slaveId, funcCode, data)
+}
+
+func (T *ModbusPacket) customRequest(policy *RetryPolicy, slaveId, funcCode byte, data []byte) (result []byte, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, slaveId, funcCode, -1)
+	req := T.BuildCustom(slaveId, funcCode, data)
+	return T.wr(policy, slaveId, funcCode, req)
+}
+
+// Broadcast 广播，以从站id 0发送且不等待响应
+// funcCode 功能码
+// data 功能码之后的数据域
+func (T *ModbusPacket) Broadcast(funcCode byte, data []byte) (err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	defer requestError(&err, BroadcastSlaveId, funcCode, -1)
+	frame := T.BuildCustom(BroadcastSlaveId, funcCode, data)
+	_, err = T.write(frame)
+	T.trace(DirectionOutbound, BroadcastSlaveId, funcCode, 1, frame, err)
+	if err == nil {
+		time.Sleep(T.rwInterval)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package go_modbus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestRequestErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		modbusType StatuteType
+		respond    func(request []byte) []byte
+		want       []error
+	}{
+		{
+			name:       "timeout",
+			modbusType: ModbusTCP,
+			respond:    func([]byte) []byte { return nil },
+			want:       []error{statute.ErrTimeout, ReadTimeoutError},
+		},
+		{
+			name:       "short frame",
+			modbusType: ModbusTCP,
+			respond: func(request []byte) []byte {
+				return append(request[:2:2], 0x00, 0x00, 0x00, 0x05, 0x01, 0x03)
+			},
+			want: []error{statute.ErrShortFrame, statute.ErrTimeout},
+		},
+		{
+			name:       "exception",
+			modbusType: ModbusTCP,
+			respond: func(request []byte) []byte {
+				return append(request[:2:2], 0x00, 0x00, 0x00, 0x03, 0x01, 0x83, 0x02)
+			},
+			want: []error{statute.ErrException, statute.ErrIllegalDataAddress},
+		},
+		{
+			name:       "crc",
+			modbusType: ModbusRTU,
+			respond:    func([]byte) []byte { return []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x00} },
+			want:       []error{statute.ErrCRC, statute.CsError},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packet := dialPacket(t, serveDevice(t, test.respond), test.modbusType)
+			_, err := packet.ReadHoldingRegisters(1, 7, 1)
+			for _, want := range test.want {
+				if !errors.Is(err, want) {
+					t.Errorf("error %v is not %v", err, want)
+				}
+			}
+			var requestErr *statute.RequestError
+			if !errors.As(err, &requestErr) || requestErr.SlaveId != 1 || requestErr.FuncCode != statute.ReadHoldingRegisters || requestErr.Address != 7 {
+				t.Fatalf("error %v has no request context", err)
+			}
+		})
+	}
+}
+
+func TestRequestErrorWithoutAddress(t *testing.T) {
+	packet := dialPacket(t, serveDevice(t, func([]byte) []byte { return nil }), ModbusTCP)
+	_, err := packet.ReportServerId(4)
+	var requestErr *statute.RequestError
+	if !errors.As(err, &requestErr) || requestErr.Address != -1 || requestErr.SlaveId != 4 || !errors.Is(err, statute.ErrTimeout) {
+		t.Fatalf("error = %v", err)
+	}
+}
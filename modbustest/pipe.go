@@ -0,0 +1,59 @@
+// Package modbustest 提供在go test中运行完整请求/响应流程的工具，不需要网络和设备
+package modbustest
+
+import (
+	"net"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/simulator"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+const (
+	defaultReadTimeout = time.Second      //内存管道的读超时
+	defaultRwInterval  = time.Microsecond //内存管道不需要读写间隔
+)
+
+// Pipe 创建一对内存连接，在服务端一端用handler按kind的帧格式提供服务，返回客户端一端
+// handler为*simulator.Simulator时由模拟器提供服务，故障注入生效且模拟器Close时断开
+// 客户端一端关闭时服务结束
+func Pipe(handler simulator.Handler, kind statute.FrameKind) net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		if sim, ok := handler.(*simulator.Simulator); ok {
+			_ = sim.ServeConn(server, kind)
+			return
+		}
+		_ = simulator.ServeHandler(server, kind, handler)
+	}()
+	return client
+}
+
+// NewClient 创建一个通过内存管道连接到handler的客户端
+// modbusType为modbus.ModbusTCP时使用MBAP帧，为modbus.ModbusRTU时使用RTU帧
+func NewClient(handler simulator.Handler, modbusType modbus.StatuteType) (*modbus.ModbusRTUPacket, error) {
+	kind := statute.FrameTCP
+	if modbusType == modbus.ModbusRTU {
+		kind = statute.FrameRTU
+	}
+	conn := Pipe(handler, kind)
+	packet, err := modbus.NewModbusStreamPacket(conn, defaultReadTimeout, defaultRwInterval, modbusType)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return packet, nil
+}
+
+// NewSimulator 创建一个带有虚拟从站ids的模拟器和一个连接到它的客户端
+// 测试结束时需关闭客户端和模拟器
+func NewSimulator(modbusType modbus.StatuteType, ids ...byte) (*simulator.Simulator, *modbus.ModbusRTUPacket, error) {
+	sim := simulator.NewSimulator(ids...)
+	packet, err := NewClient(sim, modbusType)
+	if err != nil {
+		_ = sim.Close()
+		return nil, nil, err
+	}
+	return sim, packet, nil
+}
@@ -0,0 +1,200 @@
+package modbustest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/simulator"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestPipeRoundTrip(t *testing.T) {
+	for _, modbusType := range []modbus.StatuteType{modbus.ModbusTCP, modbus.ModbusRTU} {
+		t.Run(string(modbusType), func(t *testing.T) {
+			sim, client, err := NewSimulator(modbusType, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sim.Close()
+			defer client.Close()
+			if err = sim.Slave(1).SetHoldingRegisters(10, 0x1234, 0x5678); err != nil {
+				t.Fatal(err)
+			}
+			data, err := client.ReadHoldingRegisters(1, 10, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []byte{0x12, 0x34, 0x56, 0x78}; !bytes.Equal(data, want) {
+				t.Fatalf("ReadHoldingRegisters = % x, want % x", data, want)
+			}
+			if _, _, err = client.WriteMultipleRegisters(1, 20, 7, 8); err != nil {
+				t.Fatal(err)
+			}
+			registers, _ := sim.Slave(1).HoldingRegisters(20, 2)
+			if registers[0] != 7 || registers[1] != 8 {
+				t.Fatalf("holding registers = %v, want [7 8]", registers)
+			}
+			if _, _, err = client.WriteSingleCoil(1, 3, statute.ON); err != nil {
+				t.Fatal(err)
+			}
+			_, coils, err := client.ReadCoils(1, 0, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if coils[3] != statute.ON || coils[0] != statute.OFF {
+				t.Fatalf("coils = %v", coils)
+			}
+			_, err = client.ReadHoldingRegisters(1, 0xFFFF, 2)
+			var abnormal *statute.ReturnedAbnormalFuncCode
+			if !errors.As(err, &abnormal) || abnormal.GetExceptionCode() != statute.ExceptionIllegalDataAddress {
+				t.Fatalf("out of range read error = %v, want illegal data address", err)
+			}
+		})
+	}
+}
+
+func TestPipeHandler(t *testing.T) {
+	handler := simulator.HandlerFunc(func(slaveId byte, pdu []byte) []byte {
+		return []byte{pdu[0], 2, 0, slaveId}
+	})
+	client, err := NewClient(handler, modbus.ModbusTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	data, err := client.ReadInputRegisters(9, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, 9}) {
+		t.Fatalf("ReadInputRegisters = % x, want 00 09", data)
+	}
+}
+
+func TestPipeTimeout(t *testing.T) {
+	//从站2不存在，模拟器不应答
+	sim := simulator.NewSimulator(1)
+	defer sim.Close()
+	client, err := modbus.NewModbusStreamPacket(Pipe(sim, statute.FrameRTU), 50*time.Millisecond, 0, modbus.ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var netErr net.Error
+	if _, err = client.ReadHoldingRegisters(2, 0, 1); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("error = %v, want timeout", err)
+	}
+	if err = client.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.ReadHoldingRegisters(1, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Connect(); !errors.Is(err, modbus.NoConnectionError) {
+		t.Fatalf("Connect after Close = %v, want NoConnectionError", err)
+	}
+	if _, err = client.ReadHoldingRegisters(1, 0, 1); !errors.Is(err, modbus.NoConnectionError) {
+		t.Fatalf("read after Close = %v, want NoConnectionError", err)
+	}
+}
+
+// 扫描测试用的从站：2正常应答，5对读保持寄存器返回异常，其余不应答，记录每个从站收到的请求数
+type scanHandler struct {
+	lock     sync.Mutex
+	requests map[byte]int
+}
+
+func (h *scanHandler) Handle(slaveId byte, pdu []byte) []byte {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.requests == nil {
+		h.requests = map[byte]int{}
+	}
+	h.requests[slaveId]++
+	switch {
+	case slaveId != 2 && slaveId != 5:
+		return nil
+	case pdu[0] == statute.ReportServerId:
+		return []byte{pdu[0], 2, slaveId, 0xFF}
+	case slaveId == 5:
+		return []byte{pdu[0] | 0x80, 0x02}
+	}
+	return []byte{pdu[0], 2, 0, 1}
+}
+
+func (h *scanHandler) count(slaveId byte) int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.requests[slaveId]
+}
+
+// 检查扫描结果和每个从站的请求次数，探测和读取从站id都不重试
+func checkScan(t *testing.T, handler *scanHandler, results []*modbus.ScanResult, from, to byte) {
+	t.Helper()
+	if len(results) != 2 || results[0].SlaveId != 2 || results[1].SlaveId != 5 {
+		t.Fatalf("results = %v", results)
+	}
+	if results[0].ExceptionCode != 0 || results[1].ExceptionCode != 0x02 {
+		t.Fatalf("exception codes = %d, %d", results[0].ExceptionCode, results[1].ExceptionCode)
+	}
+	for _, result := range results {
+		if result.ServerIdErr != nil || !bytes.Equal(result.ServerId, []byte{result.SlaveId, 0xFF}) {
+			t.Fatalf("slave %d server id = % x, %v", result.SlaveId, result.ServerId, result.ServerIdErr)
+		}
+	}
+	for slaveId := from; slaveId <= to; slaveId++ {
+		want := 1
+		if slaveId == 2 || slaveId == 5 {
+			want = 2
+		}
+		if got := handler.count(slaveId); got != want {
+			t.Fatalf("slave %d received %d requests, want %d", slaveId, got, want)
+		}
+	}
+}
+
+func TestScanStream(t *testing.T) {
+	handler := &scanHandler{}
+	client, err := modbus.NewModbusStreamPacket(Pipe(handler, statute.FrameRTU), time.Second, 0, modbus.ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetRetryPolicy(&modbus.RetryPolicy{MaxAttempts: 3})
+	var found []byte
+	start := time.Now()
+	results, err := client.Scan(context.Background(), &modbus.ScanOptions{
+		From: 1, To: 6, Timeout: 30 * time.Millisecond, ReportServerId: true,
+		OnResult: func(result *modbus.ScanResult) { found = append(found, result.SlaveId) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("scan took %v, want the probe timeout per silent slave", elapsed)
+	}
+	checkScan(t, handler, results, 1, 6)
+	if !bytes.Equal(found, []byte{2, 5}) {
+		t.Fatalf("OnResult saw %v", found)
+	}
+	if data, err := client.ReadHoldingRegisters(2, 0, 1); err != nil || !bytes.Equal(data, []byte{0, 1}) {
+		t.Fatalf("read after scan = % x, %v", data, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = client.Scan(ctx, &modbus.ScanOptions{From: 1, To: 2}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Scan with a canceled context = %v", err)
+	}
+	if _, err = client.Scan(context.Background(), &modbus.ScanOptions{From: 5, To: 2}); err == nil {
+		t.Fatal("Scan accepted an empty range")
+	}
+}
@@ -0,0 +1,67 @@
+package modbustest
+
+import (
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/simulator"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// NewSerialPair 创建一对虚拟串口(伪终端)，仅支持Linux
+func NewSerialPair() (*SerialPair, error) {
+	pty, err := simulator.OpenPty()
+	if err != nil {
+		return nil, err
+	}
+	return &SerialPair{Path: pty.SlavePath, pty: pty}, nil
+}
+
+// SerialPair 一对虚拟串口
+// Path一端作为真实串口被ModbusRTUPacket打开，另一端由Device读写或由Serve运行从站
+type SerialPair struct {
+	Path string //串口路径
+	pty  *simulator.Pty
+}
+
+// Device 从站一端，测试可以直接读写以构造任意字节流
+func (p *SerialPair) Device() *simulator.Pty {
+	return p.pty
+}
+
+// Serve 在从站一端用handler运行RTU从站，直到Close
+// handler为*simulator.Simulator时由模拟器提供服务，故障注入生效
+func (p *SerialPair) Serve(handler simulator.Handler) {
+	go func() {
+		if sim, ok := handler.(*simulator.Simulator); ok {
+			_ = sim.ServeConn(p.pty.Master, statute.FrameRTU)
+			return
+		}
+		_ = simulator.ServeHandler(p.pty.Master, statute.FrameRTU, handler)
+	}()
+}
+
+// Close 关闭虚拟串口
+func (p *SerialPair) Close() error {
+	return p.pty.Close()
+}
+
+// NewSerialClient 创建一对虚拟串口并在一端运行handler，返回已经打开另一端的ModbusRTUPacket
+// 串口的打开、读写和读超时都走真实的串口代码，readTimeout的精度为100ms
+// 测试结束时需先关闭客户端再关闭SerialPair
+func NewSerialClient(handler simulator.Handler, readTimeout time.Duration) (*modbus.ModbusRTUPacket, *SerialPair, error) {
+	pair, err := NewSerialPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	pair.Serve(handler)
+	packet, err := modbus.NewModbusRTUPacket(pair.Path, 9600, 8, modbus.ParityNone, 1, readTimeout, defaultRwInterval, modbus.ModbusRTU)
+	if err == nil {
+		err = packet.Connect()
+	}
+	if err != nil {
+		_ = pair.Close()
+		return nil, nil, err
+	}
+	return packet, pair, nil
+}
@@ -0,0 +1,119 @@
+package modbustest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/simulator"
+)
+
+func newSerialClient(t *testing.T, handler simulator.Handler, readTimeout time.Duration) *modbus.ModbusRTUPacket {
+	t.Helper()
+	client, pair, err := NewSerialClient(handler, readTimeout)
+	if err != nil {
+		t.Skipf("virtual serial port not available: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = pair.Close()
+	})
+	return client
+}
+
+func TestSerialClient(t *testing.T) {
+	sim := simulator.NewSimulator(1)
+	defer sim.Close()
+	_ = sim.Slave(1).SetHoldingRegisters(0, 42)
+	client := newSerialClient(t, sim, 200*time.Millisecond)
+	tests := []struct {
+		name    string
+		slaveId byte
+		want    []byte
+		err     error
+	}{
+		{name: "existing slave", slaveId: 1, want: []byte{0, 42}},
+		{name: "silent slave", slaveId: 2, err: modbus.ReadTimeoutError},
+		{name: "recovers after timeout", slaveId: 1, want: []byte{0, 42}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			data, err := client.ReadHoldingRegisters(test.slaveId, 0, 1)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error = %v, want %v", err, test.err)
+				}
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Fatalf("timeout took %v, want about 200ms", elapsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, test.want) {
+				t.Fatalf("data = % x, want % x", data, test.want)
+			}
+		})
+	}
+}
+
+func TestSerialPairDevice(t *testing.T) {
+	pair, err := NewSerialPair()
+	if err != nil {
+		t.Skipf("virtual serial port not available: %v", err)
+	}
+	defer pair.Close()
+	client, err := modbus.NewModbusRTUPacket(pair.Path, 9600, 8, modbus.ParityNone, 1, 500*time.Millisecond, 0, modbus.ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go func() {
+		request := make([]byte, 8)
+		if _, err := pair.Device().Master.Read(request); err != nil {
+			return
+		}
+		//01 03 02 00 07 + CRC
+		_, _ = pair.Device().Master.Write([]byte{0x01, 0x03, 0x02, 0x00, 0x07, 0xF9, 0x86})
+	}()
+	data, err := client.ReadHoldingRegisters(1, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, 7}) {
+		t.Fatalf("data = % x, want 00 07", data)
+	}
+}
+
+func TestScanSerial(t *testing.T) {
+	handler := &scanHandler{}
+	client := newSerialClient(t, handler, 500*time.Millisecond)
+	client.SetRetryPolicy(&modbus.RetryPolicy{MaxAttempts: 3})
+	start := time.Now()
+	results, err := client.Scan(context.Background(), &modbus.ScanOptions{From: 1, To: 5, ReportServerId: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//3个不应答的从站，每个使用100ms的探测超时
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("scan took %v, want about 300ms", elapsed)
+	}
+	checkScan(t, handler, results, 1, 5)
+	//扫描结束后恢复原来的读超时
+	client.SetRetryPolicy(nil)
+	start = time.Now()
+	if _, err = client.ReadHoldingRegisters(3, 0, 1); !errors.Is(err, modbus.ReadTimeoutError) {
+		t.Fatalf("error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("timeout after scan took %v, want about 500ms", elapsed)
+	}
+}
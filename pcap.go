@@ -0,0 +1,328 @@
+package go_modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+const (
+	LinkTypeEthernet uint32 = 1   //以太网，TCP报文使用
+	LinkTypeUser0    uint32 = 147 //用户自定义，RTU报文使用
+)
+
+// InvalidPcapError 无效的pcap文件
+var InvalidPcapError = errors.New("invalid pcap file")
+
+const (
+	pcapMagic     = 0xa1b2c3d4
+	pcapNanoMagic = 0xa1b23c4d
+	pcapSnapLen   = 65535
+
+	rtuHeaderOutbound byte = 0x00 //主站->从站
+	rtuHeaderInbound  byte = 0x01 //从站->主站
+)
+
+// NewPcapWriter 创建一个pcap文件写入器，会立即写入文件头
+func NewPcapWriter(w io.Writer, linkType uint32) (*PcapWriter, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:24], linkType)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &PcapWriter{w: w, linkType: linkType}, nil
+}
+
+// PcapWriter pcap文件写入器
+type PcapWriter struct {
+	lock     sync.Mutex
+	w        io.Writer
+	linkType uint32
+}
+
+// LinkType 链路类型
+func (p *PcapWriter) LinkType() uint32 {
+	return p.linkType
+}
+
+// WritePacket 写入一条记录
+func (p *PcapWriter) WritePacket(ts time.Time, data []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(header[4:8], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(header[8:12], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(len(data)))
+	if _, err := p.w.Write(header); err != nil {
+		return err
+	}
+	_, err := p.w.Write(data)
+	return err
+}
+
+// RecordTCP 将TCP连接上的所有请求和响应写入pcap文件
+// 报文封装在合成的以太网/IPv4/TCP头中，服务端为连接的ip和端口，Wireshark可直接识别为Modbus/TCP
+// UDP传输同样封装为TCP报文段；IPv6地址替换为10.0.0.1(客户端)和10.0.0.2(服务端)，端口保持不变
+// 使用RTU帧格式(RTU over TCP)时没有MBAP头，按RecordRTU的USER0格式记录
+// 如果之前设置了Tracer，事件会继续转发给它
+func RecordTCP(packet *ModbusTCPPacket, w io.Writer) (*PcapRecorder, error) {
+	packet.lock.Lock()
+	statuteType := packet.statuteType
+	server := &net.TCPAddr{IP: net.ParseIP(packet.ip), Port: packet.port}
+	client := &net.TCPAddr{Port: 49152}
+	if packet.conn != nil {
+		client = tcpAddr(packet.conn.LocalAddr(), client)
+		server = tcpAddr(packet.conn.RemoteAddr(), server)
+	}
+	packet.lock.Unlock()
+	if statuteType != ModbusTCP {
+		return recordUser0(packet.ModbusPacket, w)
+	}
+	writer, err := NewPcapWriter(w, LinkTypeEthernet)
+	if err != nil {
+		return nil, err
+	}
+	recorder := &PcapRecorder{writer: writer, packet: packet.ModbusPacket, tcp: newTcpSynthesizer(client, server)}
+	recorder.install()
+	return recorder, nil
+}
+
+// 取TCP或UDP地址的ip和端口，其他类型返回def
+func tcpAddr(addr net.Addr, def *net.TCPAddr) *net.TCPAddr {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr
+	case *net.UDPAddr:
+		return &net.TCPAddr{IP: addr.IP, Port: addr.Port}
+	}
+	return def
+}
+
+// RecordRTU 将串口上的所有请求和响应写入pcap文件
+// 链路类型为USER0(147)，每条记录为1字节方向头(0x00主站到从站，0x01从站到主站)加完整的ADU
+// Wireshark中在 Preferences -> Protocols -> DLT_USER 里将 User 0 的 payload protocol 设为 mbrtu，header size 设为1即可解析
+func RecordRTU(packet *ModbusRTUPacket, w io.Writer) (*PcapRecorder, error) {
+	return recordUser0(packet.ModbusPacket, w)
+}
+
+func recordUser0(packet *ModbusPacket, w io.Writer) (*PcapRecorder, error) {
+	writer, err := NewPcapWriter(w, LinkTypeUser0)
+	if err != nil {
+		return nil, err
+	}
+	recorder := &PcapRecorder{writer: writer, packet: packet}
+	recorder.install()
+	return recorder, nil
+}
+
+var _ Tracer = (*PcapRecorder)(nil)
+
+// PcapRecorder 以Tracer的形式记录报文
+type PcapRecorder struct {
+	writer *PcapWriter
+	packet *ModbusPacket
+	next   Tracer //之前设置的Tracer
+	tcp    *tcpSynthesizer
+	err    error //第一次写入错误
+}
+
+func (p *PcapRecorder) install() {
+	p.packet.lock.Lock()
+	defer p.packet.lock.Unlock()
+	p.next = p.packet.tracer
+	p.packet.tracer = p
+}
+
+func (p *PcapRecorder) Trace(event *TraceEvent) {
+	if p.next != nil {
+		p.next.Trace(event)
+	}
+	if len(event.Frame) == 0 || p.err != nil || !onWire(event) {
+		return
+	}
+	var data []byte
+	if p.tcp != nil {
+		data = p.tcp.segment(event.Direction, event.Frame)
+	} else {
+		header := rtuHeaderOutbound
+		if event.Direction == DirectionInbound {
+			header = rtuHeaderInbound
+		}
+		data = append([]byte{header}, event.Frame...)
+	}
+	p.err = p.writer.WritePacket(event.Time, data)
+}
+
+// 报文是否完整地出现在线路上
+// 发送失败的请求不记录；解码失败的响应只有已读取的部分，除异常响应和校验错误外都不记录，回放时视为没有响应
+func onWire(event *TraceEvent) bool {
+	if event.Err == nil {
+		return true
+	}
+	if event.Direction == DirectionOutbound {
+		return false
+	}
+	var abnormal *statute.ReturnedAbnormalFuncCode
+	return errors.As(event.Err, &abnormal) || errors.Is(event.Err, statute.ErrCRC) || errors.Is(event.Err, statute.ErrLRC)
+}
+
+// Stop 停止记录并恢复之前的Tracer，返回记录过程中的第一个写入错误
+func (p *PcapRecorder) Stop() error {
+	p.packet.lock.Lock()
+	defer p.packet.lock.Unlock()
+	if p.packet.tracer == p {
+		p.packet.tracer = p.next
+	}
+	return p.err
+}
+
+// 合成以太网/IPv4/TCP头
+func newTcpSynthesizer(client, server *net.TCPAddr) *tcpSynthesizer {
+	t := &tcpSynthesizer{clientPort: uint16(client.Port), serverPort: uint16(server.Port), clientSeq: 1, serverSeq: 1}
+	copy(t.clientIp[:], ipv4OrDefault(client.IP, net.IPv4(10, 0, 0, 1)))
+	copy(t.serverIp[:], ipv4OrDefault(server.IP, net.IPv4(10, 0, 0, 2)))
+	return t
+}
+
+type tcpSynthesizer struct {
+	clientIp, serverIp     [4]byte
+	clientPort, serverPort uint16
+	clientSeq, serverSeq   uint32
+	ipId                   uint16
+}
+
+var (
+	clientMac = []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	serverMac = []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+func ipv4OrDefault(ip net.IP, def net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil && !ip4.IsUnspecified() {
+		return ip4
+	}
+	return def.To4()
+}
+
+func (t *tcpSynthesizer) segment(direction Direction, payload []byte) []byte {
+	srcMac, dstMac := clientMac, serverMac
+	srcIp, dstIp := t.clientIp, t.serverIp
+	srcPort, dstPort := t.clientPort, t.serverPort
+	seq, ack := &t.clientSeq, t.serverSeq
+	if direction == DirectionInbound {
+		srcMac, dstMac = serverMac, clientMac
+		srcIp, dstIp = t.serverIp, t.clientIp
+		srcPort, dstPort = t.serverPort, t.clientPort
+		seq, ack = &t.serverSeq, t.clientSeq
+	}
+	frame := make([]byte, 14+20+20+len(payload))
+	//以太网头
+	copy(frame[0:6], dstMac)
+	copy(frame[6:12], srcMac)
+	binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+	//IPv4头
+	ip := frame[14:34]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+20+len(payload)))
+	t.ipId++
+	binary.BigEndian.PutUint16(ip[4:6], t.ipId)
+	ip[6] = 0x40 //DF
+	ip[8] = 64
+	ip[9] = 6 //TCP
+	copy(ip[12:16], srcIp[:])
+	copy(ip[16:20], dstIp[:])
+	binary.BigEndian.PutUint16(ip[10:12], checksum(ip, 0))
+	//TCP头
+	tcp := frame[34:]
+	binary.BigEndian.PutUint16(tcp[0:2], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:4], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:8], *seq)
+	binary.BigEndian.PutUint32(tcp[8:12], ack)
+	tcp[12] = 5 << 4
+	tcp[13] = 0x18 //PSH|ACK
+	binary.BigEndian.PutUint16(tcp[14:16], 65535)
+	copy(tcp[20:], payload)
+	//伪首部
+	var pseudo uint32
+	pseudo += uint32(binary.BigEndian.Uint16(srcIp[0:2])) + uint32(binary.BigEndian.Uint16(srcIp[2:4]))
+	pseudo += uint32(binary.BigEndian.Uint16(dstIp[0:2])) + uint32(binary.BigEndian.Uint16(dstIp[2:4]))
+	pseudo += 6 + uint32(len(tcp))
+	binary.BigEndian.PutUint16(tcp[16:18], checksum(tcp, pseudo))
+	*seq += uint32(len(payload))
+	return frame
+}
+
+// 互联网校验和
+func checksum(data []byte, initial uint32) uint16 {
+	sum := initial
+	for index := 0; index+1 < len(data); index += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[index : index+2]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// PcapRecord pcap文件中的一条记录
+type PcapRecord struct {
+	Time time.Time
+	Data []byte
+}
+
+// ReadPcap 读取pcap文件，支持微秒和纳秒精度及两种字节序
+func ReadPcap(r io.Reader) (linkType uint32, records []*PcapRecord, err error) {
+	header := make([]byte, 24)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	var order binary.ByteOrder
+	var nano bool
+	switch {
+	case binary.LittleEndian.Uint32(header[0:4]) == pcapMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header[0:4]) == pcapMagic:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header[0:4]) == pcapNanoMagic:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header[0:4]) == pcapNanoMagic:
+		order, nano = binary.BigEndian, true
+	default:
+		return 0, nil, InvalidPcapError
+	}
+	linkType = order.Uint32(header[20:24])
+	recordHeader := make([]byte, 16)
+	for {
+		if _, err = io.ReadFull(r, recordHeader); err != nil {
+			if errors.Is(err, io.EOF) {
+				return linkType, records, nil
+			}
+			return 0, nil, err
+		}
+		sec, frac := int64(order.Uint32(recordHeader[0:4])), int64(order.Uint32(recordHeader[4:8]))
+		if !nano {
+			frac *= 1000
+		}
+		length := order.Uint32(recordHeader[8:12])
+		if length > pcapSnapLen {
+			return 0, nil, InvalidPcapError
+		}
+		data := make([]byte, length)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return 0, nil, err
+		}
+		records = append(records, &PcapRecord{Time: time.Unix(sec, frac), Data: data})
+	}
+}
@@ -0,0 +1,294 @@
+package go_modbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// 测试中解析的一条pcap记录
+type pcapRecord struct {
+	ts   time.Time
+	data []byte
+}
+
+// 解析pcap文件，返回链路类型和所有记录
+func parsePcap(t *testing.T, file []byte) (uint32, []pcapRecord) {
+	t.Helper()
+	if len(file) < 24 || binary.LittleEndian.Uint32(file[0:4]) != pcapMagic {
+		t.Fatalf("invalid pcap header % x", file[:min(len(file), 24)])
+	}
+	if major, minor := binary.LittleEndian.Uint16(file[4:6]), binary.LittleEndian.Uint16(file[6:8]); major != 2 || minor != 4 {
+		t.Fatalf("pcap version %d.%d", major, minor)
+	}
+	linkType := binary.LittleEndian.Uint32(file[20:24])
+	var records []pcapRecord
+	for offset := 24; offset < len(file); {
+		if offset+16 > len(file) {
+			t.Fatalf("truncated record header at %d", offset)
+		}
+		header := file[offset : offset+16]
+		length := int(binary.LittleEndian.Uint32(header[8:12]))
+		if original := int(binary.LittleEndian.Uint32(header[12:16])); original != length {
+			t.Fatalf("captured length %d, original length %d", length, original)
+		}
+		ts := time.Unix(int64(binary.LittleEndian.Uint32(header[0:4])), int64(binary.LittleEndian.Uint32(header[4:8]))*1000)
+		offset += 16
+		if offset+length > len(file) {
+			t.Fatalf("truncated record at %d", offset)
+		}
+		records = append(records, pcapRecord{ts: ts, data: file[offset : offset+length]})
+		offset += length
+	}
+	return linkType, records
+}
+
+func TestPcapWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewPcapWriter(&buf, LinkTypeUser0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(1700000000, 123456000)
+	if err = writer.WritePacket(ts, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	linkType, records := parsePcap(t, buf.Bytes())
+	if linkType != LinkTypeUser0 || writer.LinkType() != LinkTypeUser0 {
+		t.Fatalf("link type = %d", linkType)
+	}
+	if len(records) != 1 || !records[0].ts.Equal(ts) || !bytes.Equal(records[0].data, []byte{1, 2, 3}) {
+		t.Fatalf("records = %+v", records)
+	}
+}
+
+func TestRecordTCP(t *testing.T) {
+	port := serveDevice(t, func(request []byte) []byte {
+		return []byte{request[0], request[1], 0x00, 0x00, 0x00, 0x05, 0x01, 0x03, 0x02, 0x00, 0x2A}
+	})
+	packet, err := NewModbusTCPPacket("127.0.0.1", port, time.Second, time.Second, time.Second, time.Millisecond, ModbusTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = packet.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer packet.Close()
+	previous := &recordingTracer{}
+	packet.SetTracer(previous)
+	var buf bytes.Buffer
+	recorder, err := RecordTCP(packet, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err = packet.ReadHoldingRegisters(1, 0, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	//停止后不再记录，之前的Tracer继续生效
+	_, _ = packet.ReadHoldingRegisters(1, 0, 1)
+	if events := previous.take(); len(events) != 6 {
+		t.Fatalf("previous tracer got %d events, want 6", len(events))
+	}
+	linkType, records := parsePcap(t, buf.Bytes())
+	if linkType != LinkTypeEthernet || len(records) != 4 {
+		t.Fatalf("link type %d, %d records", linkType, len(records))
+	}
+	local := packet.conn.LocalAddr().(*net.TCPAddr)
+	seq := map[uint16]uint32{}
+	for index, record := range records {
+		frame := record.data
+		if binary.BigEndian.Uint16(frame[12:14]) != 0x0800 {
+			t.Fatalf("record %d: ether type % x", index, frame[12:14])
+		}
+		ip, tcp := frame[14:34], frame[34:54]
+		if checksum(ip, 0) != 0 {
+			t.Fatalf("record %d: bad ip checksum", index)
+		}
+		if int(binary.BigEndian.Uint16(ip[2:4])) != len(frame)-14 || ip[9] != 6 {
+			t.Fatalf("record %d: ip header % x", index, ip)
+		}
+		srcPort, dstPort := binary.BigEndian.Uint16(tcp[0:2]), binary.BigEndian.Uint16(tcp[2:4])
+		src, dst := net.IP(ip[12:16]), net.IP(ip[16:20])
+		payload := frame[54:]
+		if index%2 == 0 {
+			if srcPort != uint16(local.Port) || dstPort != uint16(port) || !src.Equal(local.IP) || !dst.Equal(net.IPv4(127, 0, 0, 1)) {
+				t.Fatalf("request %d: %s:%d -> %s:%d", index, src, srcPort, dst, dstPort)
+			}
+			if len(payload) != 12 || payload[7] != 0x03 {
+				t.Fatalf("request %d: payload % x", index, payload)
+			}
+		} else {
+			if srcPort != uint16(port) || dstPort != uint16(local.Port) {
+				t.Fatalf("response %d: port %d -> %d", index, srcPort, dstPort)
+			}
+			if !bytes.Equal(payload[6:], []byte{0x01, 0x03, 0x02, 0x00, 0x2A}) {
+				t.Fatalf("response %d: payload % x", index, payload)
+			}
+		}
+		//序号按负载长度递增
+		if want, ok := seq[srcPort]; ok && binary.BigEndian.Uint32(tcp[4:8]) != want {
+			t.Fatalf("record %d: seq %d, want %d", index, binary.BigEndian.Uint32(tcp[4:8]), want)
+		}
+		seq[srcPort] = binary.BigEndian.Uint32(tcp[4:8]) + uint32(len(payload))
+		var pseudo uint32
+		pseudo += uint32(binary.BigEndian.Uint16(ip[12:14])) + uint32(binary.BigEndian.Uint16(ip[14:16]))
+		pseudo += uint32(binary.BigEndian.Uint16(ip[16:18])) + uint32(binary.BigEndian.Uint16(ip[18:20]))
+		pseudo += 6 + uint32(len(frame)-34)
+		if checksum(frame[34:], pseudo) != 0 {
+			t.Fatalf("record %d: bad tcp checksum", index)
+		}
+	}
+}
+
+func TestRecordTCPWithRTUFraming(t *testing.T) {
+	device := &registerDevice{rtu: true, registers: []uint16{42}}
+	port := serveDevice(t, device.respond)
+	packet := dialPacket(t, port, ModbusRTU)
+	var buf bytes.Buffer
+	//请求进行中时开始记录，连接的地址在锁内读取
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 5 {
+			_, _ = packet.ReadHoldingRegisters(1, 0, 1)
+		}
+	}()
+	recorder, err := RecordTCP(packet, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if err = recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	linkType, records := parsePcap(t, buf.Bytes())
+	if linkType != LinkTypeUser0 || len(records) == 0 || len(records)%2 != 0 {
+		t.Fatalf("link type %d, %d records", linkType, len(records))
+	}
+	request := []byte{rtuHeaderOutbound, 0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	response := []byte{rtuHeaderInbound, 0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}
+	for index, record := range records {
+		want := request
+		if index%2 == 1 {
+			want = response
+		}
+		if !bytes.Equal(record.data, want) {
+			t.Fatalf("record %d = % x, want % x", index, record.data, want)
+		}
+	}
+	session, err := LoadSession(bytes.NewReader(buf.Bytes()))
+	if err != nil || session.StatuteType != ModbusRTU {
+		t.Fatalf("LoadSession = %v, %v", session, err)
+	}
+}
+
+func TestTcpSynthesizerAddresses(t *testing.T) {
+	tests := []struct {
+		name           string
+		client, server net.Addr
+		clientIp       net.IP
+		serverIp       net.IP
+	}{
+		{
+			name:     "udp",
+			client:   &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 40000},
+			server:   &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 502},
+			clientIp: net.IPv4(192, 168, 1, 10),
+			serverIp: net.IPv4(192, 168, 1, 20),
+		},
+		{
+			name:     "ipv6",
+			client:   &net.TCPAddr{IP: net.IPv6loopback, Port: 40000},
+			server:   &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 502},
+			clientIp: net.IPv4(10, 0, 0, 1),
+			serverIp: net.IPv4(10, 0, 0, 2),
+		},
+		{
+			name:     "unknown",
+			client:   &net.UnixAddr{Name: "client"},
+			server:   &net.UnixAddr{Name: "server"},
+			clientIp: net.IPv4(10, 0, 0, 1),
+			serverIp: net.IPv4(10, 0, 0, 2),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := tcpAddr(test.client, &net.TCPAddr{Port: 49152})
+			server := tcpAddr(test.server, &net.TCPAddr{Port: 1502})
+			frame := newTcpSynthesizer(client, server).segment(DirectionOutbound, []byte{0x00, 0x01})
+			ip, tcp := frame[14:34], frame[34:54]
+			if !net.IP(ip[12:16]).Equal(test.clientIp) || !net.IP(ip[16:20]).Equal(test.serverIp) {
+				t.Fatalf("ip %s -> %s", net.IP(ip[12:16]), net.IP(ip[16:20]))
+			}
+			if binary.BigEndian.Uint16(tcp[0:2]) != uint16(client.Port) || binary.BigEndian.Uint16(tcp[2:4]) != uint16(server.Port) {
+				t.Fatalf("port %d -> %d", binary.BigEndian.Uint16(tcp[0:2]), binary.BigEndian.Uint16(tcp[2:4]))
+			}
+		})
+	}
+}
+
+func TestRecordRTU(t *testing.T) {
+	packet, err := NewModbusRTUPacket("/dev/null", 9600, 8, 'N', 1, time.Second, 0, ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	recorder, err := RecordRTU(packet, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	response := []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}
+	packet.trace(DirectionOutbound, 1, 3, 1, request, nil)
+	packet.trace(DirectionInbound, 1, 3, 1, response, nil)
+	packet.trace(DirectionInbound, 1, 3, 1, nil, ReadTimeoutError)
+	if err = recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	linkType, records := parsePcap(t, buf.Bytes())
+	if linkType != LinkTypeUser0 || len(records) != 2 {
+		t.Fatalf("link type %d, %d records", linkType, len(records))
+	}
+	if !bytes.Equal(records[0].data, append([]byte{rtuHeaderOutbound}, request...)) || !bytes.Equal(records[1].data, append([]byte{rtuHeaderInbound}, response...)) {
+		t.Fatalf("records = % x, % x", records[0].data, records[1].data)
+	}
+}
+
+func TestRecordSkipsIncompleteFrames(t *testing.T) {
+	packet, err := NewModbusRTUPacket("/dev/null", 9600, 8, 'N', 1, time.Second, 0, ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	recorder, err := RecordRTU(packet, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	exception := []byte{0x01, 0x83, 0x02, 0xC0, 0xF1}
+	badCrc := []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x00, 0x00}
+	packet.trace(DirectionOutbound, 1, 3, 1, request, errors.New("write failed"))
+	packet.trace(DirectionInbound, 1, 3, 1, []byte{0x01, 0x03}, ReadTimeoutError)
+	packet.trace(DirectionInbound, 1, 3, 1, exception, &statute.ReturnedAbnormalFuncCode{})
+	packet.trace(DirectionInbound, 1, 3, 1, badCrc, statute.ErrCRC)
+	if err = recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	_, records := parsePcap(t, buf.Bytes())
+	if len(records) != 2 {
+		t.Fatalf("%d records, want the exception and the crc error", len(records))
+	}
+	if !bytes.Equal(records[0].data[1:], exception) || !bytes.Equal(records[1].data[1:], badCrc) {
+		t.Fatalf("records = % x, % x", records[0].data, records[1].data)
+	}
+}
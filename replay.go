@@ -0,0 +1,357 @@
+package go_modbus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// RecordedTransaction 录制的一次请求和响应
+type RecordedTransaction struct {
+	Time     time.Time //请求时间
+	Request  []byte    //请求ADU
+	Response []byte    //响应ADU，没有收到响应时为nil
+}
+
+// Session 录制的会话
+type Session struct {
+	StatuteType  StatuteType //协议类型
+	Transactions []*RecordedTransaction
+}
+
+// LoadSession 从RecordTCP或RecordRTU生成的pcap文件中加载会话
+// 超时等原因留下的不完整响应被丢弃，对应的请求视为没有响应
+func LoadSession(r io.Reader) (*Session, error) {
+	linkType, records, err := ReadPcap(r)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{}
+	var pending []*RecordedTransaction //等待响应的请求
+	var serverPort uint16
+	var serverKnown bool
+	for _, record := range records {
+		var direction Direction
+		var payload []byte
+		switch linkType {
+		case LinkTypeUser0:
+			if len(record.Data) < 1 {
+				continue
+			}
+			direction, payload = DirectionOutbound, record.Data[1:]
+			if record.Data[0] == rtuHeaderInbound {
+				direction = DirectionInbound
+			}
+			session.StatuteType = ModbusRTU
+		case LinkTypeEthernet:
+			srcPort, dstPort, data, ok := tcpPayload(record.Data)
+			if !ok || len(data) == 0 {
+				continue
+			}
+			if !serverKnown {
+				//第一个有数据的报文视为请求
+				serverPort, serverKnown = dstPort, true
+				session.StatuteType = detectStatuteType(data)
+			}
+			direction, payload = DirectionOutbound, data
+			if srcPort == serverPort {
+				direction = DirectionInbound
+			}
+		default:
+			return nil, InvalidPcapError
+		}
+		for _, frame := range splitFrames(session.StatuteType, direction, payload) {
+			if direction == DirectionOutbound {
+				transaction := &RecordedTransaction{Time: record.Time, Request: frame}
+				session.Transactions = append(session.Transactions, transaction)
+				if session.StatuteType == ModbusRTU {
+					pending = pending[:0]
+				}
+				pending = append(pending, transaction)
+				continue
+			}
+			for index, transaction := range pending {
+				if session.StatuteType == ModbusRTU || bytes.Equal(transaction.Request[:2], frame[:2]) {
+					transaction.Response = frame
+					pending = append(pending[:index], pending[index+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return session, nil
+}
+
+// 解析以太网/IP/TCP头，返回TCP负载
+func tcpPayload(data []byte) (srcPort, dstPort uint16, payload []byte, ok bool) {
+	if len(data) < 14 {
+		return 0, 0, nil, false
+	}
+	var segment []byte
+	switch binary.BigEndian.Uint16(data[12:14]) {
+	case 0x0800:
+		ip := data[14:]
+		if len(ip) < 20 || ip[9] != 6 {
+			return 0, 0, nil, false
+		}
+		headerLength := int(ip[0]&0x0F) * 4
+		totalLength := int(binary.BigEndian.Uint16(ip[2:4]))
+		if headerLength < 20 || totalLength < headerLength || totalLength > len(ip) {
+			return 0, 0, nil, false
+		}
+		segment = ip[headerLength:totalLength]
+	case 0x86DD:
+		ip := data[14:]
+		if len(ip) < 40 || ip[6] != 6 {
+			return 0, 0, nil, false
+		}
+		payloadLength := int(binary.BigEndian.Uint16(ip[4:6]))
+		if 40+payloadLength > len(ip) {
+			return 0, 0, nil, false
+		}
+		segment = ip[40 : 40+payloadLength]
+	default:
+		return 0, 0, nil, false
+	}
+	if len(segment) < 20 {
+		return 0, 0, nil, false
+	}
+	offset := int(segment[12]>>4) * 4
+	if offset < 20 || offset > len(segment) {
+		return 0, 0, nil, false
+	}
+	return binary.BigEndian.Uint16(segment[0:2]), binary.BigEndian.Uint16(segment[2:4]), segment[offset:], true
+}
+
+// 根据第一个请求判断TCP负载是MBAP还是RTU
+func detectStatuteType(data []byte) StatuteType {
+	if len(data) >= 8 && data[2] == 0 && data[3] == 0 && int(binary.BigEndian.Uint16(data[4:6])) == len(data)-6 {
+		return ModbusTCP
+	}
+	return ModbusRTU
+}
+
+// 将一段负载拆分为完整的ADU，末尾不完整的部分丢弃
+func splitFrames(statuteType StatuteType, direction Direction, payload []byte) [][]byte {
+	var frames [][]byte
+	reader := bytes.NewReader(payload)
+	for reader.Len() > 0 {
+		frame, err := readFrame(reader, statuteType, direction)
+		if err != nil && !errors.Is(err, statute.CsError) {
+			//末尾不完整的报文，如超时时收到的部分响应，丢弃后对应的请求视为没有响应
+			break
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// 从流中读取一帧ADU
+func readFrame(r io.Reader, statuteType StatuteType, direction Direction) ([]byte, error) {
+	switch {
+	case statuteType == ModbusTCP:
+		return statute.ReadTCPFrame(r)
+	case direction == DirectionOutbound:
+		return statute.ReadRTURequest(r)
+	default:
+		return statute.ReadRTUResponse(r)
+	}
+}
+
+// NewReplayServer 创建一个按录制会话应答的假设备
+// 收到的请求会依次匹配会话中尚未使用的相同请求，全部用过后重复使用最后一次匹配的响应
+// Modbus TCP按单元id、功能码和数据匹配，响应的事务标识会改写为请求的事务标识；RTU按整帧匹配
+// 没有匹配或录制时没有响应的请求不做应答，无法解析的请求被丢弃，连接保持
+func NewReplayServer(session *Session) *ReplayServer {
+	return &ReplayServer{session: session, used: make([]bool, len(session.Transactions)), conns: make(map[io.Closer]struct{})}
+}
+
+// ReplayServer 回放录制会话的假设备
+type ReplayServer struct {
+	lock     sync.Mutex
+	session  *Session
+	used     []bool
+	listener net.Listener
+	conns    map[io.Closer]struct{}
+	closed   bool
+}
+
+// ListenAndServe 监听addr并提供服务
+func (s *ReplayServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve 在listener上提供服务，直到Close
+func (s *ReplayServer) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return net.ErrClosed
+	}
+	s.listener = listener
+	s.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if s.closed {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			_ = s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn 在一个连接上提供服务，直到连接读写出错或关闭
+func (s *ReplayServer) ServeConn(conn io.ReadWriteCloser) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return conn.Close()
+	}
+	s.conns[conn] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := readFrame(reader, s.session.StatuteType, DirectionOutbound)
+		if err != nil {
+			if errors.Is(err, statute.CsError) {
+				continue
+			}
+			if errors.Is(err, statute.ErrProtocolViolation) {
+				//无法解析的帧丢弃缓存中剩余的字节，重新同步后继续服务
+				_, _ = reader.Discard(reader.Buffered())
+				continue
+			}
+			return err
+		}
+		response := s.match(request)
+		if response == nil {
+			continue
+		}
+		if _, err = conn.Write(response); err != nil {
+			return err
+		}
+	}
+}
+
+// Close 停止服务并关闭所有连接
+func (s *ReplayServer) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// 查找请求对应的录制响应
+func (s *ReplayServer) match(request []byte) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	last := -1
+	for index, transaction := range s.session.Transactions {
+		if !s.sameRequest(transaction.Request, request) {
+			continue
+		}
+		last = index
+		if !s.used[index] {
+			s.used[index] = true
+			return s.rewrite(transaction.Response, request)
+		}
+	}
+	if last < 0 {
+		return nil
+	}
+	return s.rewrite(s.session.Transactions[last].Response, request)
+}
+
+func (s *ReplayServer) sameRequest(recorded, request []byte) bool {
+	if s.session.StatuteType == ModbusTCP {
+		return len(recorded) > 6 && len(request) > 6 && bytes.Equal(recorded[6:], request[6:])
+	}
+	return bytes.Equal(recorded, request)
+}
+
+// 改写响应的事务标识
+func (s *ReplayServer) rewrite(response, request []byte) []byte {
+	if response == nil {
+		return nil
+	}
+	response = bytes.Clone(response)
+	if s.session.StatuteType == ModbusTCP {
+		copy(response[0:2], request[0:2])
+	}
+	return response
+}
+
+// ReplayDiff 重发一条录制请求的结果
+type ReplayDiff struct {
+	Index    int    //在会话中的序号
+	Request  []byte //请求ADU
+	Expected []byte //录制的响应
+	Actual   []byte //实际的响应
+	Err      error  //读取响应的错误
+}
+
+// Match 实际响应是否与录制的一致，两者都没有响应也视为一致
+func (d *ReplayDiff) Match() bool {
+	if d.Expected == nil {
+		return d.Actual == nil
+	}
+	return d.Err == nil && bytes.Equal(d.Expected, d.Actual)
+}
+
+// Resend 将会话中的请求依次发送到rw，并与录制的响应比较
+// rw实现了SetReadDeadline时使用timeout作为每条响应的读超时
+func (s *Session) Resend(rw io.ReadWriter, timeout time.Duration) ([]*ReplayDiff, error) {
+	if timeout <= 0 {
+		timeout = defaultReadTimeout
+	}
+	deadliner, _ := rw.(interface{ SetReadDeadline(time.Time) error })
+	reader := bufio.NewReader(rw)
+	diffs := make([]*ReplayDiff, 0, len(s.Transactions))
+	for index, transaction := range s.Transactions {
+		if _, err := rw.Write(transaction.Request); err != nil {
+			return diffs, err
+		}
+		if deadliner != nil {
+			if err := deadliner.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				return diffs, err
+			}
+		}
+		diff := &ReplayDiff{Index: index, Request: transaction.Request, Expected: transaction.Response}
+		diff.Actual, diff.Err = readFrame(reader, s.StatuteType, DirectionInbound)
+		if diff.Err != nil && !errors.Is(diff.Err, statute.CsError) {
+			diff.Actual = nil
+			reader.Reset(rw)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
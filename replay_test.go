@@ -0,0 +1,365 @@
+package go_modbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+const replayTimeout = 200 * time.Millisecond
+
+// 测试用的保持寄存器设备，只应答从站1的功能码03和06
+type registerDevice struct {
+	lock      sync.Mutex
+	rtu       bool
+	registers []uint16
+}
+
+func (d *registerDevice) set(address int, value uint16) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.registers[address] = value
+}
+
+func (d *registerDevice) respond(request []byte) []byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var slaveId byte
+	var pdu []byte
+	if d.rtu {
+		slaveId, pdu = request[0], request[1:len(request)-2]
+	} else {
+		slaveId, pdu = request[6], request[7:]
+	}
+	if slaveId != 1 {
+		return nil
+	}
+	address, value := int(binary.BigEndian.Uint16(pdu[1:3])), binary.BigEndian.Uint16(pdu[3:5])
+	var response []byte
+	switch {
+	case pdu[0] == statute.ReadHoldingRegisters && address+int(value) <= len(d.registers):
+		response = []byte{pdu[0], byte(value * 2)}
+		for _, register := range d.registers[address : address+int(value)] {
+			response = binary.BigEndian.AppendUint16(response, register)
+		}
+	case pdu[0] == statute.WriteSingleRegister && address < len(d.registers):
+		d.registers[address] = value
+		response = pdu
+	case pdu[0] == statute.ReadHoldingRegisters || pdu[0] == statute.WriteSingleRegister:
+		response = []byte{pdu[0] | 0x80, 0x02}
+	default:
+		response = []byte{pdu[0] | 0x80, 0x01}
+	}
+	if d.rtu {
+		frame := append([]byte{slaveId}, response...)
+		return append(frame, statute.Crc16(frame)...)
+	}
+	frame := []byte{request[0], request[1], 0x00, 0x00}
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(response)+1))
+	return append(append(frame, slaveId), response...)
+}
+
+// 连接到port的客户端
+func dialPacket(t *testing.T, port int, modbusType StatuteType) *ModbusTCPPacket {
+	t.Helper()
+	packet, err := NewModbusTCPPacket("127.0.0.1", port, time.Second, replayTimeout, time.Second, time.Microsecond, modbusType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = packet.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = packet.Close() })
+	return packet
+}
+
+// 启动回放服务，返回监听端口
+func serveReplay(t *testing.T, server *ReplayServer) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func isException(err error, code byte) bool {
+	var abnormal *statute.ReturnedAbnormalFuncCode
+	return errors.As(err, &abnormal) && abnormal.GetExceptionCode() == code
+}
+
+func TestReplaySession(t *testing.T) {
+	for _, modbusType := range []StatuteType{ModbusTCP, ModbusRTU} {
+		t.Run(string(modbusType), func(t *testing.T) {
+			device := &registerDevice{rtu: modbusType == ModbusRTU, registers: []uint16{1, 2, 3}}
+			client := dialPacket(t, serveDevice(t, device.respond), modbusType)
+			var pcap bytes.Buffer
+			if _, err := RecordTCP(client, &pcap); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.ReadHoldingRegisters(1, 0, 3); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := client.WriteSingleRegister(1, 1, 20); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.ReadHoldingRegisters(1, 0, 3); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.ReadHoldingRegisters(1, 0xFFFF, 2); !isException(err, 0x02) {
+				t.Fatalf("exception error = %v", err)
+			}
+			if _, err := client.ReadHoldingRegisters(5, 0, 1); !isTimeout(err) {
+				t.Fatalf("unanswered error = %v", err)
+			}
+
+			session, err := LoadSession(bytes.NewReader(pcap.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.StatuteType != modbusType {
+				t.Fatalf("StatuteType = %s, want %s", session.StatuteType, modbusType)
+			}
+			if len(session.Transactions) != 5 {
+				t.Fatalf("%d transactions, want 5", len(session.Transactions))
+			}
+			for index, transaction := range session.Transactions {
+				if answered := transaction.Response != nil; answered != (index < 4) {
+					t.Fatalf("transaction %d answered = %v", index, answered)
+				}
+			}
+
+			replay := dialPacket(t, serveReplay(t, NewReplayServer(session)), modbusType)
+			tests := []struct {
+				name      string
+				run       func() ([]byte, error)
+				want      []byte
+				exception byte
+				timeout   bool
+			}{
+				{name: "first read", run: func() ([]byte, error) { return replay.ReadHoldingRegisters(1, 0, 3) }, want: []byte{0, 1, 0, 2, 0, 3}},
+				{name: "second read", run: func() ([]byte, error) { return replay.ReadHoldingRegisters(1, 0, 3) }, want: []byte{0, 1, 0, 20, 0, 3}},
+				{name: "last response repeated", run: func() ([]byte, error) { return replay.ReadHoldingRegisters(1, 0, 3) }, want: []byte{0, 1, 0, 20, 0, 3}},
+				{name: "exception", run: func() ([]byte, error) { return replay.ReadHoldingRegisters(1, 0xFFFF, 2) }, exception: 0x02},
+				{name: "unanswered", run: func() ([]byte, error) { return replay.ReadHoldingRegisters(5, 0, 1) }, timeout: true},
+				{name: "not recorded", run: func() ([]byte, error) { return replay.ReadInputRegisters(1, 0, 1) }, timeout: true},
+			}
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					data, err := test.run()
+					switch {
+					case test.exception != 0:
+						if !isException(err, test.exception) {
+							t.Fatalf("error = %v, want exception %d", err, test.exception)
+						}
+					case test.timeout:
+						if !isTimeout(err) {
+							t.Fatalf("error = %v, want timeout", err)
+						}
+					case err != nil:
+						t.Fatal(err)
+					case !bytes.Equal(data, test.want):
+						t.Fatalf("data = % x, want % x", data, test.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestLoadSessionRTU(t *testing.T) {
+	var pcap bytes.Buffer
+	writer, err := NewPcapWriter(&pcap, LinkTypeUser0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	response := []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}
+	write := []byte{0x01, 0x06, 0x00, 0x0A, 0x00, 0x05, 0x69, 0xCB}
+	for _, record := range [][]byte{
+		append([]byte{rtuHeaderOutbound}, request...),
+		append([]byte{rtuHeaderInbound}, response...),
+		append([]byte{rtuHeaderOutbound}, write...),
+		append([]byte{rtuHeaderOutbound}, request...),
+		append([]byte{rtuHeaderInbound}, response...),
+	} {
+		if err = writer.WritePacket(time.Now(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session, err := LoadSession(&pcap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.StatuteType != ModbusRTU || len(session.Transactions) != 3 {
+		t.Fatalf("session = %s with %d transactions", session.StatuteType, len(session.Transactions))
+	}
+	for index, want := range [][]byte{response, nil, response} {
+		if transaction := session.Transactions[index]; !bytes.Equal(transaction.Response, want) {
+			t.Fatalf("transaction %d response = % x, want % x", index, transaction.Response, want)
+		}
+	}
+}
+
+func TestLoadSessionPartialResponse(t *testing.T) {
+	var pcap bytes.Buffer
+	writer, err := NewPcapWriter(&pcap, LinkTypeUser0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	response := []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}
+	for _, record := range [][]byte{
+		append([]byte{rtuHeaderOutbound}, request...),
+		append([]byte{rtuHeaderInbound}, response[:3]...),
+		append([]byte{rtuHeaderOutbound}, request...),
+		append([]byte{rtuHeaderInbound}, response...),
+	} {
+		if err = writer.WritePacket(time.Now(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session, err := LoadSession(&pcap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Transactions) != 2 {
+		t.Fatalf("%d transactions, want 2", len(session.Transactions))
+	}
+	if session.Transactions[0].Response != nil || !bytes.Equal(session.Transactions[1].Response, response) {
+		t.Fatalf("responses = % x, % x", session.Transactions[0].Response, session.Transactions[1].Response)
+	}
+}
+
+func TestReadPcap(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		record []byte
+		nanos  int64
+		err    error
+	}{
+		{
+			name:   "little endian micro",
+			header: []byte{0xd4, 0xc3, 0xb2, 0xa1, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0, 0, 147, 0, 0, 0},
+			record: []byte{1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0xAA},
+			nanos:  2000,
+		},
+		{
+			name:   "big endian nano",
+			header: []byte{0xa1, 0xb2, 0x3c, 0x4d, 0, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0, 0, 0, 147},
+			record: []byte{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 1, 0xAA},
+			nanos:  2,
+		},
+		{
+			name:   "bad magic",
+			header: make([]byte, 24),
+			err:    InvalidPcapError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			linkType, records, err := ReadPcap(bytes.NewReader(append(test.header, test.record...)))
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error = %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linkType != LinkTypeUser0 || len(records) != 1 {
+				t.Fatalf("link type %d, %d records", linkType, len(records))
+			}
+			if !records[0].Time.Equal(time.Unix(1, test.nanos)) || !bytes.Equal(records[0].Data, []byte{0xAA}) {
+				t.Fatalf("record = %v % x", records[0].Time, records[0].Data)
+			}
+		})
+	}
+}
+
+func TestResend(t *testing.T) {
+	device := &registerDevice{registers: []uint16{1, 2}}
+	port := serveDevice(t, device.respond)
+	client := dialPacket(t, port, ModbusTCP)
+	var pcap bytes.Buffer
+	if _, err := RecordTCP(client, &pcap); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = client.ReadHoldingRegisters(1, 0, 1)
+	_, _ = client.ReadHoldingRegisters(1, 1, 1)
+	_, _ = client.ReadHoldingRegisters(1, 0xFFFF, 1)
+	session, err := LoadSession(&pcap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//设备上的寄存器1已改变
+	device.set(1, 9)
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	diffs, err := session.Resend(conn, replayTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("%d diffs, want 3", len(diffs))
+	}
+	for index, want := range []bool{true, false, true} {
+		if diffs[index].Match() != want {
+			t.Fatalf("diff %d: Match = %v, want %v (expected % x, actual % x, err %v)", index, !want, want, diffs[index].Expected, diffs[index].Actual, diffs[index].Err)
+		}
+	}
+}
+
+func TestReplaySkipsMalformedRequests(t *testing.T) {
+	tests := []struct {
+		modbusType StatuteType
+		malformed  []byte
+		request    []byte
+		response   []byte
+	}{
+		{ModbusTCP, []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x00}, []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x05, 0x01, 0x03, 0x02, 0x00, 0x2A}},
+		{ModbusRTU, []byte{0x01, 0x42, 0x00}, []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}, []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.modbusType), func(t *testing.T) {
+			server := NewReplayServer(&Session{StatuteType: test.modbusType, Transactions: []*RecordedTransaction{{Request: test.request, Response: test.response}}})
+			client, conn := net.Pipe()
+			done := make(chan error, 1)
+			go func() { done <- server.ServeConn(conn) }()
+			defer func() {
+				_ = server.Close()
+				<-done
+			}()
+			_ = client.SetDeadline(time.Now().Add(time.Second))
+			//net.Pipe的写入在服务端读走后才返回，所以请求不会与错误帧一起被丢弃
+			for _, frame := range [][]byte{test.malformed, test.request} {
+				if _, err := client.Write(frame); err != nil {
+					t.Fatal(err)
+				}
+			}
+			response := make([]byte, len(test.response))
+			if _, err := io.ReadFull(client, response); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(response, test.response) {
+				t.Fatalf("response = % x, want % x", response, test.response)
+			}
+		})
+	}
+}
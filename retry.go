@@ -0,0 +1,145 @@
+package go_modbus
+
+import (
+	"errors"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+const defaultRetryMultiplier = 2
+
+// 不重试，用于扫描、探测等没有应答属于正常情况的请求
+var noRetry = &RetryPolicy{}
+
+// RetryPolicy 重试策略
+// 每次重试前等待退避时间并丢弃连接上残留的数据，再重新发送同一帧报文
+type RetryPolicy struct {
+	MaxAttempts int                  //最多尝试次数，包含第一次，小于等于1表示不重试
+	Backoff     time.Duration        //第一次重试前的等待时间
+	MaxBackoff  time.Duration        //等待时间上限，0表示不限制
+	Multiplier  float64              //每次重试后等待时间的倍数，小于1时使用2
+	Retryable   func(err error) bool //判断错误是否可以重试，为nil时使用DefaultRetryable
+	RetryWrites bool                 //是否重试非幂等的请求，如写线圈、写寄存器和自定义功能码
+}
+
+// DefaultRetryable 超时、CRC/LRC校验错误和不完整的报文可以重试，从站返回的异常不重试
+func DefaultRetryable(err error) bool {
+	if err == nil || errors.Is(err, statute.ErrException) {
+		return false
+	}
+	return isTimeout(err) || errors.Is(err, statute.ErrCRC) || errors.Is(err, statute.ErrLRC) || errors.Is(err, statute.ErrShortFrame)
+}
+
+// 幂等的功能码，重复执行不会改变从站状态
+// 0x2B的MEI类型0x0D(CANopen)可能有副作用，不视为幂等
+func idempotent(funcCode byte) bool {
+	switch funcCode {
+	case statute.ReadCoils, statute.ReadDiscreteInputs, statute.ReadHoldingRegisters, statute.ReadInputRegisters, statute.ReportServerId, 0x14:
+		return true
+	}
+	return false
+}
+
+// 第attempt次尝试失败后是否重试
+func (r *RetryPolicy) retry(funcCode byte, attempt int, err error) bool {
+	if r == nil || attempt >= r.MaxAttempts || err == nil {
+		return false
+	}
+	if !r.RetryWrites && !idempotent(funcCode) {
+		return false
+	}
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// 第attempt次尝试失败后的等待时间
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultRetryMultiplier
+	}
+	backoff := float64(r.Backoff)
+	for index := 1; index < attempt; index++ {
+		backoff *= multiplier
+		if r.MaxBackoff > 0 && backoff >= float64(r.MaxBackoff) {
+			return r.MaxBackoff
+		}
+	}
+	return time.Duration(backoff)
+}
+
+// SetRetryPolicy 设置客户端默认的重试策略，传nil关闭重试
+// 广播没有响应，不会重试
+func (T *ModbusPacket) SetRetryPolicy(policy *RetryPolicy) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.retry = policy
+}
+
+// WithRetry 返回使用指定重试策略发送请求的视图，不影响客户端默认的策略
+// 传nil表示这些请求不重试，客户端默认的策略在请求时持有锁读取
+func (T *ModbusPacket) WithRetry(policy *RetryPolicy) *RetryScope {
+	if policy == nil {
+		policy = noRetry
+	}
+	return &RetryScope{packet: T, policy: policy}
+}
+
+// RetryScope 以指定重试策略发送请求
+type RetryScope struct {
+	packet *ModbusPacket
+	policy *RetryPolicy
+}
+
+// ReadCoils 读线圈
+func (s *RetryScope) ReadCoils(slaveId byte, address, number uint16) (uint16, []statute.CoilStatus, error) {
+	return s.packet.readCoils(s.policy, slaveId, address, number)
+}
+
+// ReadDiscreteInputs 读离散输入寄存器
+func (s *RetryScope) ReadDiscreteInputs(slaveId byte, address, number uint16) (uint16, []statute.CoilStatus, error) {
+	return s.packet.readDiscreteInputs(s.policy, slaveId, address, number)
+}
+
+// ReadHoldingRegisters 读保持寄存器
+func (s *RetryScope) ReadHoldingRegisters(slaveId byte, address, number uint16) ([]byte, error) {
+	return s.packet.readHoldingRegisters(s.policy, slaveId, address, number)
+}
+
+// ReadInputRegisters 读输入寄存器
+func (s *RetryScope) ReadInputRegisters(slaveId byte, address, number uint16) ([]byte, error) {
+	return s.packet.readInputRegisters(s.policy, slaveId, address, number)
+}
+
+// WriteSingleCoil 写单个线圈
+func (s *RetryScope) WriteSingleCoil(slaveId byte, address uint16, value statute.CoilStatus) (uint16, statute.CoilStatus, error) {
+	return s.packet.writeSingleCoil(s.policy, slaveId, address, value)
+}
+
+// WriteSingleRegister 写单个保持寄存器
+func (s *RetryScope) WriteSingleRegister(slaveId byte, address uint16, value uint16) (uint16, uint16, error) {
+	return s.packet.writeSingleRegister(s.policy, slaveId, address, value)
+}
+
+// WriteMultipleCoils 写多个线圈的请求
+func (s *RetryScope) WriteMultipleCoils(slaveId byte, address uint16, status ...statute.CoilStatus) (uint16, uint16, error) {
+	return s.packet.writeMultipleCoils(s.policy, slaveId, address, status...)
+}
+
+// WriteMultipleRegisters 写多个保持寄存器
+func (s *RetryScope) WriteMultipleRegisters(slaveId byte, address uint16, value ...uint16) (uint16, uint16, error) {
+	return s.packet.writeMultipleRegisters(s.policy, slaveId, address, value...)
+}
+
+// ReportServerId 报告从站id
+func (s *RetryScope) ReportServerId(slaveId byte) ([]byte, error) {
+	return s.packet.reportServerId(s.policy, slaveId)
+}
+
+// CustomRequest 自定义请求
+func (s *RetryScope) CustomRequest(slaveId, funcCode byte, data []byte) ([]byte, error) {
+	return s.packet.customRequest(s.policy, slaveId, funcCode, data)
+}
@@ -0,0 +1,212 @@
+package go_modbus
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		policy *RetryPolicy
+		want   []time.Duration //第1、2、3、4次尝试失败后的等待时间
+	}{
+		{&RetryPolicy{Backoff: 10 * time.Millisecond}, []time.Duration{10, 20, 40, 80}},
+		{&RetryPolicy{Backoff: 10 * time.Millisecond, Multiplier: 3}, []time.Duration{10, 30, 90, 270}},
+		{&RetryPolicy{Backoff: 10 * time.Millisecond, Multiplier: 0.5}, []time.Duration{10, 20, 40, 80}},
+		{&RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 25 * time.Millisecond}, []time.Duration{10, 20, 25, 25}},
+		{&RetryPolicy{}, []time.Duration{0, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%+v", *test.policy), func(t *testing.T) {
+			for index, want := range test.want {
+				if got := test.policy.backoff(index + 1); got != want*time.Millisecond {
+					t.Fatalf("backoff(%d) = %s, want %s", index+1, got, want*time.Millisecond)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDecision(t *testing.T) {
+	timeout := &statute.RequestError{Err: ReadTimeoutError}
+	exception := statute.NewExceptionError(statute.ReadHoldingRegisters, 0x02)
+	policy := &RetryPolicy{MaxAttempts: 3}
+	tests := []struct {
+		name     string
+		policy   *RetryPolicy
+		funcCode byte
+		attempt  int
+		err      error
+		want     bool
+	}{
+		{"read timeout", policy, statute.ReadHoldingRegisters, 1, timeout, true},
+		{"read coils crc", policy, statute.ReadCoils, 2, statute.ErrCRC, true},
+		{"input registers lrc", policy, statute.ReadInputRegisters, 1, statute.ErrLRC, true},
+		{"discrete inputs short frame", policy, statute.ReadDiscreteInputs, 1, fmt.Errorf("%w: %w", statute.ErrShortFrame, ReadTimeoutError), true},
+		{"report server id", policy, statute.ReportServerId, 1, timeout, true},
+		{"attempts exhausted", policy, statute.ReadHoldingRegisters, 3, timeout, false},
+		{"success", policy, statute.ReadHoldingRegisters, 1, nil, false},
+		{"exception", policy, statute.ReadHoldingRegisters, 1, exception, false},
+		{"other error", policy, statute.ReadHoldingRegisters, 1, NoConnectionError, false},
+		{"no policy", nil, statute.ReadHoldingRegisters, 1, timeout, false},
+		{"single attempt", &RetryPolicy{MaxAttempts: 1}, statute.ReadHoldingRegisters, 1, timeout, false},
+		{"write single register", policy, statute.WriteSingleRegister, 1, timeout, false},
+		{"write single coil", policy, statute.WriteSingleCoil, 1, timeout, false},
+		{"write multiple registers", policy, statute.WriteMultipleRegisters, 1, timeout, false},
+		{"custom function", policy, 0x41, 1, timeout, false},
+		{"encapsulated interface", policy, 0x2B, 1, timeout, false},
+		{"encapsulated interface with RetryWrites", &RetryPolicy{MaxAttempts: 3, RetryWrites: true}, 0x2B, 1, timeout, true},
+		{"general reference", policy, 0x14, 1, timeout, true},
+		{"write with RetryWrites", &RetryPolicy{MaxAttempts: 3, RetryWrites: true}, statute.WriteMultipleCoils, 1, timeout, true},
+		{"custom retryable", &RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool { return errors.Is(err, NoConnectionError) }}, statute.ReadCoils, 1, NoConnectionError, true},
+		{"custom retryable rejects timeout", &RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return false }}, statute.ReadCoils, 1, timeout, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.retry(test.funcCode, test.attempt, test.err); got != test.want {
+				t.Fatalf("retry = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// 前drop个请求不应答的设备，返回监听端口和收到的请求数
+func flakyDevice(t *testing.T, drop int32) (int, *atomic.Int32) {
+	device := &registerDevice{registers: []uint16{1, 2}}
+	var requests atomic.Int32
+	port := serveDevice(t, func(request []byte) []byte {
+		if requests.Add(1) <= drop {
+			return nil
+		}
+		return device.respond(request)
+	})
+	return port, &requests
+}
+
+func TestRetryRequests(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	tests := []struct {
+		name     string
+		drop     int32
+		request  func(packet *ModbusTCPPacket) error
+		requests int32
+		err      bool
+	}{
+		{
+			name: "read retried",
+			drop: 2,
+			request: func(packet *ModbusTCPPacket) error {
+				_, err := packet.ReadHoldingRegisters(1, 0, 2)
+				return err
+			},
+			requests: 3,
+		},
+		{
+			name: "attempts exhausted",
+			drop: 3,
+			request: func(packet *ModbusTCPPacket) error {
+				_, err := packet.ReadHoldingRegisters(1, 0, 2)
+				return err
+			},
+			requests: 3,
+			err:      true,
+		},
+		{
+			name: "write not retried",
+			drop: 1,
+			request: func(packet *ModbusTCPPacket) error {
+				_, _, err := packet.WriteSingleRegister(1, 0, 5)
+				return err
+			},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name: "per-call write retry",
+			drop: 1,
+			request: func(packet *ModbusTCPPacket) error {
+				_, _, err := packet.WithRetry(&RetryPolicy{MaxAttempts: 2, RetryWrites: true}).WriteSingleRegister(1, 0, 5)
+				return err
+			},
+			requests: 2,
+		},
+		{
+			name: "per-call no retry",
+			drop: 1,
+			request: func(packet *ModbusTCPPacket) error {
+				_, err := packet.WithRetry(nil).ReadHoldingRegisters(1, 0, 2)
+				return err
+			},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name: "exception not retried",
+			request: func(packet *ModbusTCPPacket) error {
+				_, err := packet.ReadHoldingRegisters(1, 5, 1)
+				return err
+			},
+			requests: 1,
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			port, requests := flakyDevice(t, test.drop)
+			packet := dialPacket(t, port, ModbusTCP)
+			packet.SetRetryPolicy(policy)
+			if err := test.request(packet); (err != nil) != test.err {
+				t.Fatalf("error = %v, want error %v", err, test.err)
+			}
+			if n := requests.Load(); n != test.requests {
+				t.Fatalf("%d requests sent, want %d", n, test.requests)
+			}
+		})
+	}
+}
+
+func TestRetryObserved(t *testing.T) {
+	port, _ := flakyDevice(t, 1)
+	packet := dialPacket(t, port, ModbusTCP)
+	packet.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2})
+	metrics, tracer := &recordingMetrics{}, &recordingTracer{}
+	packet.SetMetrics(metrics)
+	packet.SetTracer(tracer)
+	if _, err := packet.ReadHoldingRegisters(1, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	//一次请求只统计一次，记录尝试次数
+	if len(metrics.stats) != 1 || metrics.stats[0].Attempts != 2 || metrics.stats[0].Result != ResultSuccess {
+		t.Fatalf("stats = %+v", metrics.stats)
+	}
+	var attempts []int
+	for _, event := range tracer.take() {
+		attempts = append(attempts, event.Attempt)
+	}
+	if fmt.Sprint(attempts) != "[1 1 2 2]" {
+		t.Fatalf("traced attempts = %v", attempts)
+	}
+}
+
+func TestSetRetryPolicyConcurrent(t *testing.T) {
+	port, _ := flakyDevice(t, 0)
+	packet := dialPacket(t, port, ModbusTCP)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for index := range 50 {
+			packet.SetRetryPolicy(&RetryPolicy{MaxAttempts: index%3 + 1})
+		}
+	}()
+	for range 50 {
+		if _, err := packet.ReadHoldingRegisters(1, 0, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
@@ -3,14 +3,22 @@ package go_modbus
 import (
 	"bufio"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/VaccariaSeed/go-modbus/statute"
 	"github.com/tarm/serial"
 )
 
+// Parity 校验位
 type Parity byte
 
+const (
+	ParityNone Parity = 'N' //无校验
+	ParityEven Parity = 'E' //偶校验
+	ParityOdd  Parity = 'O' //奇校验
+)
+
 // NewModbusRTUPacket 创建一个RTU连接
 func NewModbusRTUPacket(port string, baud int, dataBit byte, parity Parity, stopBit byte, readTimeout, rwInterval time.Duration, modbusType StatuteType) (*ModbusRTUPacket, error) {
 	if readTimeout <= 0 {
@@ -20,7 +28,7 @@ func NewModbusRTUPacket(port string, baud int, dataBit byte, parity Parity, stop
 		rwInterval = defaultRwTimeout
 	}
 	tc := &ModbusRTUPacket{
-		ModbusPacket: &ModbusPacket{rwInterval: rwInterval},
+		ModbusPacket: &ModbusPacket{rwInterval: rwInterval, transport: TransportSerial, unit: defaultUnit},
 		port:         port,
 		baud:         baud,
 		dataBit:      dataBit,
@@ -36,8 +44,10 @@ func NewModbusRTUPacket(port string, baud int, dataBit byte, parity Parity, stop
 	default:
 		return nil, errors.New("modbus type not supported")
 	}
+	tc.statuteType = modbusType
 	tc.ModbusPacket.read = tc.read
 	tc.ModbusPacket.write = tc.write
+	tc.ModbusPacket.flush = tc.flush
 	return tc, nil
 }
 
@@ -52,53 +62,151 @@ type ModbusRTUPacket struct {
 	readTimeout time.Duration //读超时
 
 	serialPort *serial.Port
+	given      *givenStream                                //创建时传入的字节流，为nil时打开串口
+	stream     io.ReadWriteCloser                          //实际读写的字节流
+	wrap       func(io.ReadWriteCloser) io.ReadWriteCloser //串口包装
 
 	reader *bufio.Reader
 }
 
+// WrapPort 设置串口包装函数，Connect时对打开的串口调用，可用于故障注入等
+// NewModbusStreamPacket传入的字节流立即重新包装
+func (T *ModbusRTUPacket) WrapPort(wrap func(io.ReadWriteCloser) io.ReadWriteCloser) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.wrap = wrap
+	if T.given != nil && T.stream != nil {
+		T.attach(T.given)
+	}
+}
+
 func (T *ModbusRTUPacket) Connect() error {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	return T.connect()
+}
+
+func (T *ModbusRTUPacket) connect() error {
+	if T.given != nil {
+		if T.given.closed.Load() {
+			return NoConnectionError
+		}
+		if T.stream == nil {
+			T.attach(T.given)
+		}
+		return nil
+	}
 	config := &serial.Config{Name: T.port, Baud: T.baud, Size: T.dataBit, Parity: serial.Parity(T.parity), StopBits: serial.StopBits(T.stopBit), ReadTimeout: T.readTimeout}
 	port, err := serial.OpenPort(config)
 	if err != nil {
 		return err
 	}
 	T.serialPort = port
-	T.reader = bufio.NewReader(port)
+	T.attach(port)
 	return nil
 }
 
+func (T *ModbusRTUPacket) attach(rwc io.ReadWriteCloser) {
+	T.stream = rwc
+	if T.wrap != nil {
+		T.stream = T.wrap(rwc)
+	}
+	T.reader = bufio.NewReader(T.stream)
+}
+
+// Close 关闭串口或传入的字节流
+// 字节流不支持读超时时，进行中的读取持有锁并一直阻塞，所以先在锁外关闭字节流使读取返回，再持有锁清理状态
 func (T *ModbusRTUPacket) Close() error {
+	var err error
+	if T.given != nil {
+		//givenStream只关闭一次，与锁内的关闭不冲突
+		err = T.given.Close()
+	}
 	T.lock.Lock()
-	defer func() {
-		T.reader = nil
-		T.serialPort = nil
-		T.lock.Unlock()
-	}()
-	if T.serialPort != nil {
-		return T.serialPort.Close()
+	defer T.lock.Unlock()
+	if closeErr := T.close(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
+
+func (T *ModbusRTUPacket) close() error {
+	stream := T.stream
+	T.reader = nil
+	T.serialPort = nil
+	T.stream = nil
+	if stream != nil {
+		return stream.Close()
 	}
 	return nil
 }
 
 func (T *ModbusRTUPacket) write(frame []byte) (int, error) {
-	if T.serialPort == nil {
+	if T.stream == nil {
 		return 0, NoConnectionError
 	}
-	return T.serialPort.Write(frame)
+	if d, ok := T.deadliner(); ok {
+		if err := d.SetWriteDeadline(time.Now().Add(T.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return T.stream.Write(frame)
 }
 
 func (T *ModbusRTUPacket) read() ([]byte, error) {
-	if T.serialPort == nil {
+	if T.stream == nil {
 		return nil, NoConnectionError
 	}
-	return T.ModbusCodec.Decode(T.reader)
+	d, ok := T.deadliner()
+	if ok {
+		if err := d.SetReadDeadline(time.Now().Add(T.readTimeout)); err != nil {
+			return nil, err
+		}
+	}
+	data, err := T.ModbusCodec.Decode(T.reader)
+	if err != nil {
+		if ok {
+			return nil, netReadError(err)
+		}
+		return nil, serialReadError(err)
+	}
+	return data, nil
+}
+
+// 传入的字节流支持读写超时时返回它，串口的读超时在打开时设置
+func (T *ModbusRTUPacket) deadliner() (deadliner, bool) {
+	if T.given == nil {
+		return nil, false
+	}
+	d, ok := T.given.ReadWriteCloser.(deadliner)
+	return d, ok
 }
 
 func (T *ModbusRTUPacket) Flush() error {
 	T.lock.Lock()
 	defer T.lock.Unlock()
-	if T.serialPort == nil {
+	return T.flush()
+}
+
+func (T *ModbusRTUPacket) flush() error {
+	if T.stream == nil {
 		return NoConnectionError
 	}
-	return T.serialPort.Flush()
+	if T.serialPort != nil {
+		T.reader.Reset(T.stream)
+		return T.serialPort.Flush()
+	}
+	_, _ = T.reader.Discard(T.reader.Buffered())
+	d, ok := T.deadliner()
+	if !ok {
+		return nil
+	}
+	if err := d.SetReadDeadline(time.Now().Add(flushTimeout)); err != nil {
+		return err
+	}
+	_, err := io.Copy(io.Discard, T.reader)
+	if isTimeout(err) {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,137 @@
+package go_modbus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+const (
+	defaultScanTimeout = 100 * time.Millisecond
+	maxSlaveId         = 247
+)
+
+// ScanOptions 总线扫描参数
+type ScanOptions struct {
+	From           byte                     //起始从站id，默认1
+	To             byte                     //结束从站id(包含)，默认247
+	Timeout        time.Duration            //每次探测的读超时，默认100ms，串口的超时精度为100ms
+	ReportServerId bool                     //是否对应答的从站读取从站id(0x11)
+	OnResult       func(result *ScanResult) //每发现一个从站回调一次，可为nil
+}
+
+// ScanResult 一个应答的从站
+type ScanResult struct {
+	SlaveId       byte          //从站id
+	Latency       time.Duration //探测耗时
+	ExceptionCode byte          //探测请求返回的异常码，正常响应为0
+	ServerId      []byte        //报告从站id的响应，未读取或读取失败时为nil
+	ServerIdErr   error         //读取从站id的错误
+}
+
+// Scan 逐个探测从站id，返回所有应答的从站
+// 探测请求为读1个地址为0的保持寄存器，返回异常响应的从站同样视为存在
+// 扫描期间会以探测超时重新打开串口，结束后恢复原来的读超时，扫描前已连接的会重新连接
+func (T *ModbusRTUPacket) Scan(ctx context.Context, options *ScanOptions) (results []*ScanResult, err error) {
+	if options == nil {
+		options = &ScanOptions{}
+	}
+	from, to := options.From, options.To
+	if from == 0 {
+		from = 1
+	}
+	if to == 0 || to > maxSlaveId {
+		to = maxSlaveId
+	}
+	if from > to {
+		return nil, errors.New("invalid scan range")
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	restore, err := T.reopen(timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr := restore(); err == nil {
+			err = rerr
+		}
+	}()
+	for slaveId := int(from); slaveId <= int(to); slaveId++ {
+		if err = ctx.Err(); err != nil {
+			return results, err
+		}
+		result := T.probe(byte(slaveId), options.ReportServerId)
+		if result == nil {
+			continue
+		}
+		results = append(results, result)
+		if options.OnResult != nil {
+			options.OnResult(result)
+		}
+	}
+	return results, nil
+}
+
+// 探测一个从站，没有应答时返回nil
+func (T *ModbusRTUPacket) probe(slaveId byte, reportServerId bool) *ScanResult {
+	start := time.Now()
+	_, err := T.readHoldingRegisters(noRetry, slaveId, 0, 1)
+	result := &ScanResult{SlaveId: slaveId, Latency: time.Since(start)}
+	var abnormal *statute.ReturnedAbnormalFuncCode
+	switch {
+	case err == nil:
+	case errors.As(err, &abnormal):
+		result.ExceptionCode = abnormal.GetExceptionCode()
+	default:
+		//丢弃残留的字节，避免影响下一次探测
+		_ = T.Flush()
+		return nil
+	}
+	if reportServerId {
+		result.ServerId, result.ServerIdErr = T.reportServerId(noRetry, slaveId)
+		if result.ServerIdErr != nil {
+			_ = T.Flush()
+		}
+	}
+	return result
+}
+
+// 以指定的读超时重新打开串口，返回恢复原状态的函数
+// 传入的字节流每次读取时设置超时，不需要重新打开
+func (T *ModbusRTUPacket) reopen(readTimeout time.Duration) (restore func() error, err error) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	connected := T.stream != nil
+	original := T.readTimeout
+	restore = func() error {
+		T.lock.Lock()
+		defer T.lock.Unlock()
+		return T.switchTimeout(original, connected)
+	}
+	if err = T.switchTimeout(readTimeout, true); err != nil {
+		_ = T.switchTimeout(original, connected)
+		return nil, err
+	}
+	return restore, nil
+}
+
+// 修改读超时，串口需要重新打开才能生效，调用方需持有锁
+func (T *ModbusRTUPacket) switchTimeout(readTimeout time.Duration, connect bool) error {
+	T.readTimeout = readTimeout
+	if T.given != nil {
+		if connect && T.stream == nil {
+			return T.connect()
+		}
+		return nil
+	}
+	_ = T.close()
+	if connect {
+		return T.connect()
+	}
+	return nil
+}
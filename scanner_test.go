@@ -0,0 +1,50 @@
+package go_modbus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReportServerId(t *testing.T) {
+	tests := []struct {
+		modbusType StatuteType
+		request    []byte
+		response   []byte
+	}{
+		{
+			modbusType: ModbusRTU,
+			request:    []byte{0x01, 0x11, 0xC0, 0x2C},
+			response:   []byte{0x01, 0x11, 0x03, 0x2A, 0xFF, 0x01, 0x5C, 0x75},
+		},
+		{
+			modbusType: ModbusTCP,
+			request:    []byte{0x00, 0x00, 0x00, 0x02, 0x01, 0x11},
+			response:   []byte{0x00, 0x00, 0x00, 0x06, 0x01, 0x11, 0x03, 0x2A, 0xFF, 0x01},
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.modbusType), func(t *testing.T) {
+			port := serveDevice(t, func(request []byte) []byte {
+				if test.modbusType == ModbusTCP {
+					//事务标识按请求回填
+					if !bytes.Equal(request[2:], test.request) {
+						return nil
+					}
+					return append(request[:2:2], test.response...)
+				}
+				if !bytes.Equal(request, test.request) {
+					return nil
+				}
+				return test.response
+			})
+			packet := dialPacket(t, port, test.modbusType)
+			serverId, err := packet.ReportServerId(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(serverId, []byte{0x2A, 0xFF, 0x01}) {
+				t.Fatalf("ReportServerId = % x", serverId)
+			}
+		})
+	}
+}
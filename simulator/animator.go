@@ -0,0 +1,217 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// Table 寄存器表
+type Table int
+
+const (
+	CoilTable            Table = iota //线圈，0xxxx
+	DiscreteInputTable                //离散输入，1xxxx
+	InputRegisterTable                //输入寄存器，3xxxx
+	HoldingRegisterTable              //保持寄存器，4xxxx
+)
+
+// ParseReference 解析Modbus传统地址，如40100表示保持寄存器表中的地址99
+// 支持5位(40001-49999)和6位(400001-465536)两种写法
+func ParseReference(reference string) (Table, uint16, error) {
+	if len(reference) != 5 && len(reference) != 6 {
+		return 0, 0, fmt.Errorf("invalid reference:%s", reference)
+	}
+	number, err := strconv.Atoi(reference[1:])
+	if err != nil || number < 1 || number > 0x10000 {
+		return 0, 0, fmt.Errorf("invalid reference:%s", reference)
+	}
+	var table Table
+	switch reference[0] {
+	case '0':
+		table = CoilTable
+	case '1':
+		table = DiscreteInputTable
+	case '3':
+		table = InputRegisterTable
+	case '4':
+		table = HoldingRegisterTable
+	default:
+		return 0, 0, fmt.Errorf("invalid reference:%s", reference)
+	}
+	return table, uint16(number - 1), nil
+}
+
+// Binding 将生成器绑定到寄存器
+type Binding struct {
+	Table     Table
+	Address   uint16            //协议地址(从0开始)
+	Type      statute.ValueType //寄存器表的数值类型，默认Uint16
+	Order     statute.ByteOrder //多寄存器数值的字节序，默认ABCD
+	Generator Generator         //线圈和离散输入取非0为ON
+}
+
+// Bind 按传统地址创建绑定，如 Bind("40100", statute.Float32, statute.CDAB, Sine(20, 5, time.Minute))
+func Bind(reference string, valueType statute.ValueType, order statute.ByteOrder, generator Generator) (*Binding, error) {
+	table, address, err := ParseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	return &Binding{Table: table, Address: address, Type: valueType, Order: order, Generator: generator}, nil
+}
+
+// 计算当前值并写入寄存器组
+func (b *Binding) apply(bank *RegisterBank, elapsed time.Duration) error {
+	value := b.Generator.Value(elapsed)
+	switch b.Table {
+	case CoilTable:
+		return bank.SetCoils(b.Address, value != 0)
+	case DiscreteInputTable:
+		return bank.SetDiscreteInputs(b.Address, value != 0)
+	}
+	valueType, order := b.Type, b.Order
+	if valueType == "" {
+		valueType = statute.Uint16
+	}
+	if order == "" {
+		order = statute.ABCD
+	}
+	registers, err := statute.EncodeValue(value, valueType, order)
+	if err != nil {
+		return err
+	}
+	if b.Table == InputRegisterTable {
+		return bank.SetInputRegisters(b.Address, registers...)
+	}
+	if b.Table == HoldingRegisterTable {
+		return bank.SetHoldingRegisters(b.Address, registers...)
+	}
+	return errors.New("invalid table")
+}
+
+// NewAnimator 创建一个按interval驱动生成器写入bank的动画
+func NewAnimator(bank *RegisterBank, interval time.Duration, bindings ...*Binding) *Animator {
+	return &Animator{bank: bank, interval: interval, bindings: bindings}
+}
+
+// Animator 按固定间隔驱动生成器并写入寄存器组，写入失败时停止动画并记录错误
+type Animator struct {
+	lock     sync.Mutex
+	bank     *RegisterBank
+	interval time.Duration
+	bindings []*Binding
+	stop     chan struct{}
+	done     chan struct{}
+	errLock  sync.Mutex
+	err      error //导致动画停止的错误
+}
+
+// Update 以elapsed计算所有绑定的值并写入寄存器组，可在测试中直接调用以获得确定的结果
+func (a *Animator) Update(elapsed time.Duration) error {
+	var errs []error
+	for _, binding := range a.bindings {
+		if err := binding.apply(a.bank, elapsed); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start 开始动画，立即写入一次初始值
+func (a *Animator) Start() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.stop != nil {
+		return errors.New("animator already started")
+	}
+	if a.interval <= 0 {
+		return errors.New("invalid interval")
+	}
+	if err := a.Update(0); err != nil {
+		return err
+	}
+	a.stop, a.done = make(chan struct{}), make(chan struct{})
+	go a.run(time.Now(), a.stop, a.done)
+	return nil
+}
+
+func (a *Animator) run(start time.Time, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := a.Update(now.Sub(start)); err != nil {
+				a.errLock.Lock()
+				a.err = err
+				a.errLock.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// Err 返回导致动画停止的写入错误，动画正常运行或已被Stop时返回nil
+func (a *Animator) Err() error {
+	a.errLock.Lock()
+	defer a.errLock.Unlock()
+	return a.err
+}
+
+// Stop 停止动画，返回动画运行期间导致其停止的写入错误
+func (a *Animator) Stop() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.stop == nil {
+		return nil
+	}
+	close(a.stop)
+	<-a.done
+	a.stop, a.done = nil, nil
+	a.errLock.Lock()
+	defer a.errLock.Unlock()
+	err := a.err
+	a.err = nil
+	return err
+}
+
+// Animate 为虚拟从站创建并启动动画，Close时停止
+func (s *Simulator) Animate(slaveId byte, interval time.Duration, bindings ...*Binding) (*Animator, error) {
+	bank := s.Slave(slaveId)
+	if bank == nil {
+		return nil, fmt.Errorf("slave %d not found", slaveId)
+	}
+	for _, binding := range bindings {
+		if binding == nil || binding.Generator == nil {
+			return nil, errors.New("binding without generator")
+		}
+		if binding.Table != CoilTable && binding.Table != DiscreteInputTable {
+			valueType := binding.Type
+			if valueType == "" {
+				valueType = statute.Uint16
+			}
+			if valueType.Registers() == 0 {
+				return nil, fmt.Errorf("invalid value type:%s", binding.Type)
+			}
+		}
+	}
+	animator := NewAnimator(bank, interval, bindings...)
+	if err := animator.Start(); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		_ = animator.Stop()
+		return nil, errors.New("simulator closed")
+	}
+	s.closers = append(s.closers, animator.Stop)
+	return animator, nil
+}
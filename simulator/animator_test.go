@@ -0,0 +1,201 @@
+package simulator
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestGenerators(t *testing.T) {
+	series, err := CSVSeries(strings.NewReader("offset,value\n0,1\n1s,2\n2.5,3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		generator Generator
+		elapsed   time.Duration
+		want      float64
+	}{
+		{"ramp start", Ramp(0, 100, 10*time.Second), 0, 0},
+		{"ramp middle", Ramp(0, 100, 10*time.Second), 2500 * time.Millisecond, 25},
+		{"ramp repeats", Ramp(0, 100, 10*time.Second), 12 * time.Second, 20},
+		{"ramp without period", Ramp(0, 100, 0), time.Second, 100},
+		{"sine quarter", Sine(20, 5, 4*time.Second), time.Second, 25},
+		{"sine three quarters", Sine(20, 5, 4*time.Second), 3 * time.Second, 15},
+		{"sine without period", Sine(20, 5, 0), time.Second, 20},
+		{"steps first", Steps(time.Second, 1, 2, 3), 500 * time.Millisecond, 1},
+		{"steps third", Steps(time.Second, 1, 2, 3), 2 * time.Second, 3},
+		{"steps wrap", Steps(time.Second, 1, 2, 3), 3 * time.Second, 1},
+		{"steps empty", Steps(time.Second), time.Second, 0},
+		{"counter", Counter(10, 1, 13, time.Second), 2 * time.Second, 12},
+		{"counter wrap", Counter(10, 1, 13, time.Second), 3 * time.Second, 10},
+		{"counter without wrap", Counter(10, 2, 0, time.Second), 5 * time.Second, 20},
+		{"csv first point", series, 500 * time.Millisecond, 1},
+		{"csv holds previous point", series, 2 * time.Second, 2},
+		{"csv repeats", series, 3500 * time.Millisecond, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.generator.Value(test.elapsed); math.Abs(got-test.want) > 1e-9 {
+				t.Fatalf("Value(%s) = %v, want %v", test.elapsed, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRandomWalk(t *testing.T) {
+	first, second := RandomWalk(50, 5, 0, 52, 7), RandomWalk(50, 5, 0, 52, 7)
+	previous := 50.0
+	for range 100 {
+		value := first.Value(0)
+		if value != second.Value(0) {
+			t.Fatal("same seed produced different sequences")
+		}
+		if value < 0 || value > 52 || math.Abs(value-previous) > 5 {
+			t.Fatalf("value %v out of bounds after %v", value, previous)
+		}
+		previous = value
+	}
+}
+
+func TestCSVSeriesErrors(t *testing.T) {
+	for _, input := range []string{"", "offset,value\n", "0,1\n1s,x\n", "0,1,2\n"} {
+		if _, err := CSVSeries(strings.NewReader(input)); err == nil {
+			t.Errorf("CSVSeries(%q) succeeded", input)
+		}
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		table     Table
+		address   uint16
+		err       bool
+	}{
+		{reference: "00001", table: CoilTable, address: 0},
+		{reference: "10010", table: DiscreteInputTable, address: 9},
+		{reference: "30001", table: InputRegisterTable, address: 0},
+		{reference: "40100", table: HoldingRegisterTable, address: 99},
+		{reference: "465536", table: HoldingRegisterTable, address: 0xFFFF},
+		{reference: "40000", err: true},
+		{reference: "465537", err: true},
+		{reference: "20001", err: true},
+		{reference: "4001", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.reference, func(t *testing.T) {
+			table, address, err := ParseReference(test.reference)
+			if test.err {
+				if err == nil {
+					t.Fatalf("ParseReference = %d %d, want error", table, address)
+				}
+				return
+			}
+			if err != nil || table != test.table || address != test.address {
+				t.Fatalf("ParseReference = %d %d %v", table, address, err)
+			}
+		})
+	}
+}
+
+func TestAnimatorUpdate(t *testing.T) {
+	bank := NewRegisterBank()
+	temperature, _ := Bind("40100", statute.Float32, statute.CDAB, Steps(time.Second, 1.5, 2.5))
+	alarm, _ := Bind("00001", "", "", Steps(time.Second, 0, 1))
+	counter, _ := Bind("30001", "", "", Counter(0, 1, 0, time.Second))
+	animator := NewAnimator(bank, time.Second, temperature, alarm, counter)
+	if err := animator.Update(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if registers, _ := bank.HoldingRegisters(99, 2); !slices.Equal(registers, []uint16{0x0000, 0x4020}) {
+		t.Fatalf("holding registers = %04x", registers)
+	}
+	if coils, _ := bank.Coils(0, 1); !coils[0] {
+		t.Fatal("coil not set")
+	}
+	if registers, _ := bank.InputRegisters(0, 1); registers[0] != 1 {
+		t.Fatalf("input registers = %v", registers)
+	}
+	//超出地址范围的绑定返回错误，其余绑定照常写入
+	overflow := &Binding{Table: HoldingRegisterTable, Address: 0xFFFF, Type: statute.Uint32, Generator: Steps(0, 1)}
+	if err := NewAnimator(bank, time.Second, overflow, counter).Update(2 * time.Second); err == nil {
+		t.Fatal("Update past the end succeeded")
+	}
+	if registers, _ := bank.InputRegisters(0, 1); registers[0] != 2 {
+		t.Fatalf("input registers = %v", registers)
+	}
+}
+
+func TestAnimate(t *testing.T) {
+	sim := NewSimulator(1)
+	defer sim.Close()
+	if _, err := sim.Animate(2, time.Millisecond, &Binding{Generator: Steps(0, 1)}); err == nil {
+		t.Fatal("Animate on a missing slave succeeded")
+	}
+	if _, err := sim.Animate(1, time.Millisecond, &Binding{Table: HoldingRegisterTable}); err == nil {
+		t.Fatal("Animate without generator succeeded")
+	}
+	if _, err := sim.Animate(1, time.Millisecond, &Binding{Table: HoldingRegisterTable, Type: "int8", Generator: Steps(0, 1)}); err == nil {
+		t.Fatal("Animate with an invalid type succeeded")
+	}
+	animator, err := sim.Animate(1, time.Millisecond, &Binding{Table: HoldingRegisterTable, Generator: Counter(0, 1, 0, time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = animator.Start(); err == nil {
+		t.Fatal("second Start succeeded")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if registers, _ := sim.Slave(1).HoldingRegisters(0, 1); registers[0] >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("animator did not update the register")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err = animator.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	registers, _ := sim.Slave(1).HoldingRegisters(0, 1)
+	time.Sleep(10 * time.Millisecond)
+	if after, _ := sim.Slave(1).HoldingRegisters(0, 1); after[0] != registers[0] {
+		t.Fatalf("register changed after Stop: %d -> %d", registers[0], after[0])
+	}
+}
+
+func TestAnimatorStopsOnError(t *testing.T) {
+	sim := NewSimulator(1)
+	//第二个值超出Uint16范围，写入失败后动画停止
+	animator, err := sim.Animate(1, time.Millisecond, &Binding{Table: HoldingRegisterTable, Generator: Steps(5*time.Millisecond, 1, 70000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for animator.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("animator kept running after a failed update")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !errors.Is(animator.Err(), statute.ValueRangeError) {
+		t.Fatalf("Err = %v, want ValueRangeError", animator.Err())
+	}
+	if registers, _ := sim.Slave(1).HoldingRegisters(0, 1); registers[0] != 1 {
+		t.Fatalf("register = %d, want 1", registers[0])
+	}
+	if err = sim.Close(); !errors.Is(err, statute.ValueRangeError) {
+		t.Fatalf("Close = %v, want ValueRangeError", err)
+	}
+	if err = animator.Stop(); err != nil {
+		t.Fatalf("second Stop = %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package simulator
+
+import (
+	"errors"
+	"sync"
+)
+
+// OutOfRangeError 地址越界
+var OutOfRangeError = errors.New("address out of range")
+
+const bankSize = 0x10000
+
+// NewRegisterBank 创建一个地址空间为0-65535的寄存器组，初始值全部为0
+func NewRegisterBank() *RegisterBank {
+	return &RegisterBank{
+		coils:            make([]bool, bankSize),
+		discreteInputs:   make([]bool, bankSize),
+		holdingRegisters: make([]uint16, bankSize),
+		inputRegisters:   make([]uint16, bankSize),
+	}
+}
+
+// RegisterBank 一个虚拟从站的线圈、离散输入、保持寄存器和输入寄存器，可并发读写
+type RegisterBank struct {
+	lock             sync.RWMutex
+	coils            []bool
+	discreteInputs   []bool
+	holdingRegisters []uint16
+	inputRegisters   []uint16
+}
+
+// Coils 读线圈
+func (b *RegisterBank) Coils(address, number uint16) ([]bool, error) {
+	return readRange(&b.lock, b.coils, address, number)
+}
+
+// SetCoils 从address开始写线圈
+func (b *RegisterBank) SetCoils(address uint16, values ...bool) error {
+	return writeRange(&b.lock, b.coils, address, values)
+}
+
+// DiscreteInputs 读离散输入
+func (b *RegisterBank) DiscreteInputs(address, number uint16) ([]bool, error) {
+	return readRange(&b.lock, b.discreteInputs, address, number)
+}
+
+// SetDiscreteInputs 从address开始写离散输入
+func (b *RegisterBank) SetDiscreteInputs(address uint16, values ...bool) error {
+	return writeRange(&b.lock, b.discreteInputs, address, values)
+}
+
+// HoldingRegisters 读保持寄存器
+func (b *RegisterBank) HoldingRegisters(address, number uint16) ([]uint16, error) {
+	return readRange(&b.lock, b.holdingRegisters, address, number)
+}
+
+// SetHoldingRegisters 从address开始写保持寄存器
+func (b *RegisterBank) SetHoldingRegisters(address uint16, values ...uint16) error {
+	return writeRange(&b.lock, b.holdingRegisters, address, values)
+}
+
+// InputRegisters 读输入寄存器
+func (b *RegisterBank) InputRegisters(address, number uint16) ([]uint16, error) {
+	return readRange(&b.lock, b.inputRegisters, address, number)
+}
+
+// SetInputRegisters 从address开始写输入寄存器
+func (b *RegisterBank) SetInputRegisters(address uint16, values ...uint16) error {
+	return writeRange(&b.lock, b.inputRegisters, address, values)
+}
+
+func readRange[E any](lock *sync.RWMutex, table []E, address, number uint16) ([]E, error) {
+	if int(address)+int(number) > len(table) {
+		return nil, OutOfRangeError
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	return append([]E(nil), table[address:int(address)+int(number)]...), nil
+}
+
+func writeRange[E any](lock *sync.RWMutex, table []E, address uint16, values []E) error {
+	if int(address)+len(values) > len(table) {
+		return OutOfRangeError
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	copy(table[address:], values)
+	return nil
+}
@@ -0,0 +1,149 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generator 随时间变化的数值
+// elapsed 为动画开始以来经过的时间
+type Generator interface {
+	Value(elapsed time.Duration) float64
+}
+
+// GeneratorFunc 函数形式的Generator
+type GeneratorFunc func(elapsed time.Duration) float64
+
+func (f GeneratorFunc) Value(elapsed time.Duration) float64 {
+	return f(elapsed)
+}
+
+// Ramp 在period内从from线性变化到to，然后从头重复
+func Ramp(from, to float64, period time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		if period <= 0 {
+			return to
+		}
+		phase := float64(elapsed%period) / float64(period)
+		return from + (to-from)*phase
+	})
+}
+
+// Sine 正弦波，值为 offset + amplitude*sin(2π*t/period)
+func Sine(offset, amplitude float64, period time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		if period <= 0 {
+			return offset
+		}
+		return offset + amplitude*math.Sin(2*math.Pi*float64(elapsed)/float64(period))
+	})
+}
+
+// Steps 每隔interval切换到下一个值，循环往复
+func Steps(interval time.Duration, values ...float64) Generator {
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		if len(values) == 0 {
+			return 0
+		}
+		if interval <= 0 {
+			return values[0]
+		}
+		return values[int(elapsed/interval)%len(values)]
+	})
+}
+
+// Counter 从start开始每隔interval增加step，达到wrap时回到start，wrap不大于start时不回绕
+func Counter(start, step, wrap float64, interval time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		if interval <= 0 {
+			return start
+		}
+		value := float64(elapsed/interval) * step
+		if wrap > start {
+			value = math.Mod(value, wrap-start)
+		}
+		return start + value
+	})
+}
+
+// RandomWalk 随机游走，每次取值在上一次的基础上随机变化不超过step，并限制在[min,max]之间
+// seed相同时序列相同
+func RandomWalk(start, step, min, max float64, seed uint64) Generator {
+	random := rand.New(rand.NewPCG(seed, seed))
+	var lock sync.Mutex
+	value := start
+	return GeneratorFunc(func(time.Duration) float64 {
+		lock.Lock()
+		defer lock.Unlock()
+		value += (random.Float64()*2 - 1) * step
+		value = math.Max(min, math.Min(max, value))
+		return value
+	})
+}
+
+// CSVSeries 按CSV时间序列回放，每行为"时间偏移,值"，到达末尾后从头重复
+// 时间偏移可以是秒数(如1.5)或Go的时间格式(如1500ms)，无法解析的首行视为表头
+// 两行之间保持前一行的值
+func CSVSeries(r io.Reader) (Generator, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	type point struct {
+		offset time.Duration
+		value  float64
+	}
+	var points []point
+	for index, record := range records {
+		offset, err := parseOffset(record[0])
+		if err == nil {
+			var value float64
+			if value, err = strconv.ParseFloat(strings.TrimSpace(record[1]), 64); err == nil {
+				points = append(points, point{offset: offset, value: value})
+				continue
+			}
+		}
+		if index == 0 {
+			continue
+		}
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, errors.New("empty time series")
+	}
+	slices.SortStableFunc(points, func(a, b point) int {
+		return int(a.offset - b.offset)
+	})
+	period := points[len(points)-1].offset
+	return GeneratorFunc(func(elapsed time.Duration) float64 {
+		if period > 0 {
+			elapsed %= period
+		}
+		index, found := slices.BinarySearchFunc(points, elapsed, func(p point, t time.Duration) int {
+			return int(p.offset - t)
+		})
+		if !found {
+			index--
+		}
+		return points[max(index, 0)].value
+	}), nil
+}
+
+func parseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
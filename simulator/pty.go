@@ -0,0 +1,22 @@
+package simulator
+
+import (
+	"errors"
+	"os"
+)
+
+// Pty 一对伪终端
+type Pty struct {
+	Master    *os.File //主设备，模拟从站的一端
+	SlavePath string   //从设备路径，作为串口被客户端打开
+	slave     *os.File //保持从设备打开，避免客户端重新打开串口期间主设备读到EIO
+}
+
+// Close 关闭伪终端，主设备已被关闭时忽略
+func (p *Pty) Close() error {
+	err := p.Master.Close()
+	if errors.Is(err, os.ErrClosed) {
+		err = nil
+	}
+	return errors.Join(err, p.slave.Close())
+}
@@ -0,0 +1,63 @@
+package simulator
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenPty 创建一对原始模式的伪终端
+func OpenPty() (*Pty, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	pty, err := setupPty(master)
+	if err != nil {
+		_ = master.Close()
+		return nil, err
+	}
+	return pty, nil
+}
+
+func setupPty(master *os.File) (*Pty, error) {
+	rawConn, err := master.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var number int
+	var ctlErr error
+	err = rawConn.Control(func(fd uintptr) {
+		//解锁从设备并获取编号
+		if ctlErr = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); ctlErr != nil {
+			return
+		}
+		if number, ctlErr = unix.IoctlGetInt(int(fd), unix.TIOCGPTN); ctlErr != nil {
+			return
+		}
+		//设置为原始模式，相当于cfmakeraw
+		var termios *unix.Termios
+		if termios, ctlErr = unix.IoctlGetTermios(int(fd), unix.TCGETS); ctlErr != nil {
+			return
+		}
+		termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		termios.Oflag &^= unix.OPOST
+		termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		termios.Cflag &^= unix.CSIZE | unix.PARENB
+		termios.Cflag |= unix.CS8
+		ctlErr = unix.IoctlSetTermios(int(fd), unix.TCSETS, termios)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ctlErr != nil {
+		return nil, ctlErr
+	}
+	slavePath := fmt.Sprintf("/dev/pts/%d", number)
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Pty{Master: master, SlavePath: slavePath, slave: slave}, nil
+}
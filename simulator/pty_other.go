@@ -0,0 +1,10 @@
+//go:build !linux
+
+package simulator
+
+import "errors"
+
+// OpenPty 创建一对原始模式的伪终端，仅支持Linux
+func OpenPty() (*Pty, error) {
+	return nil, errors.New("pty is only supported on linux")
+}
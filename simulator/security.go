@@ -0,0 +1,187 @@
+package simulator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// RoleOID Modbus/TCP Security规定的角色扩展，值为UTF8String
+var RoleOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 50316, 802, 1}
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+// Role 读取证书中的角色扩展，没有时返回空字符串
+func Role(certificate *x509.Certificate) (string, error) {
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(RoleOID) {
+			continue
+		}
+		var role string
+		if _, err := asn1.Unmarshal(extension.Value, &role); err != nil {
+			return "", err
+		}
+		return role, nil
+	}
+	return "", nil
+}
+
+// AddressRange 地址范围，包含From和To
+type AddressRange struct {
+	From uint16
+	To   uint16
+}
+
+// Permission 角色允许的操作
+type Permission struct {
+	FuncCodes []byte         //允许的功能码，为空表示全部
+	Addresses []AddressRange //允许访问的地址范围，为空表示全部，请求的地址区间必须完全落在某个范围内
+}
+
+// Authorizer 按客户端证书中的角色对请求授权
+// 功能码不允许时返回异常码0x01，地址不允许时返回异常码0x02，拒绝的请求以Warn级别记录
+type Authorizer struct {
+	Roles   map[string]*Permission //角色对应的权限
+	Default *Permission            //证书中没有角色或角色未配置时使用，nil表示拒绝
+	Logger  *slog.Logger           //为nil时使用slog.Default()
+}
+
+// Authorize 对一个请求PDU授权，允许时返回0，否则返回异常码
+func (a *Authorizer) Authorize(role string, pdu []byte) byte {
+	permission, ok := a.Roles[role]
+	if !ok {
+		permission = a.Default
+	}
+	if permission == nil {
+		return statute.ExceptionIllegalFunction
+	}
+	if len(permission.FuncCodes) > 0 && !slices.Contains(permission.FuncCodes, pdu[0]) {
+		return statute.ExceptionIllegalFunction
+	}
+	if len(permission.Addresses) == 0 {
+		return 0
+	}
+	for _, r := range requestRanges(pdu) {
+		if !slices.ContainsFunc(permission.Addresses, func(allowed AddressRange) bool {
+			return uint32(allowed.From) <= r[0] && r[1] <= uint32(allowed.To)
+		}) {
+			return statute.ExceptionIllegalDataAddress
+		}
+	}
+	return 0
+}
+
+// 授权并记录被拒绝的请求
+func (a *Authorizer) check(remote net.Addr, role string, slaveId byte, pdu []byte) byte {
+	exceptionCode := a.Authorize(role, pdu)
+	if exceptionCode != 0 {
+		attrs := []any{
+			slog.String("remote", remote.String()),
+			slog.String("role", role),
+			slog.Int("slave", int(slaveId)),
+			slog.String("function", statute.FuncCodeName(pdu[0])),
+		}
+		if ranges := requestRanges(pdu); len(ranges) > 0 && ranges[0][0] <= 0xFFFF {
+			attrs = append(attrs, slog.Int("address", int(ranges[0][0])), slog.Int("quantity", int(ranges[0][1]-ranges[0][0]+1)))
+		}
+		attrs = append(attrs, slog.String("exception", statute.ExceptionName(exceptionCode)))
+		a.logger().Warn("modbus request denied", attrs...)
+	}
+	return exceptionCode
+}
+
+func (a *Authorizer) logger() *slog.Logger {
+	if a.Logger != nil {
+		return a.Logger
+	}
+	return slog.Default()
+}
+
+// 请求访问的地址区间[起始, 结束]，没有地址的功能码返回nil
+// 无法解析的请求返回一个超出范围的区间，使其被拒绝
+func requestRanges(pdu []byte) [][2]uint32 {
+	invalid := [][2]uint32{{1 << 16, 1 << 16}}
+	span := func(offset int, quantity uint16) [2]uint32 {
+		address := uint32(binary.BigEndian.Uint16(pdu[offset:]))
+		return [2]uint32{address, address + uint32(max(quantity, 1)) - 1}
+	}
+	switch pdu[0] {
+	case statute.ReadCoils, statute.ReadDiscreteInputs, statute.ReadHoldingRegisters, statute.ReadInputRegisters, statute.WriteMultipleCoils, statute.WriteMultipleRegisters:
+		if len(pdu) < 5 {
+			return invalid
+		}
+		return [][2]uint32{span(1, binary.BigEndian.Uint16(pdu[3:]))}
+	case statute.WriteSingleCoil, statute.WriteSingleRegister, 0x16:
+		if len(pdu) < 3 {
+			return invalid
+		}
+		return [][2]uint32{span(1, 1)}
+	case 0x17:
+		//读写多个寄存器
+		if len(pdu) < 9 {
+			return invalid
+		}
+		return [][2]uint32{span(1, binary.BigEndian.Uint16(pdu[3:])), span(5, binary.BigEndian.Uint16(pdu[7:]))}
+	}
+	return nil
+}
+
+// ListenAndServeTLS 监听addr并以Modbus/TCP Security(MBAP over TLS)提供服务
+func (s *Simulator) ListenAndServeTLS(addr string, config *tls.Config, authorizer *Authorizer) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(listener, config, authorizer)
+}
+
+// ServeTLS 在listener上以Modbus/TCP Security提供服务，直到Close
+// config中的Certificates为服务端证书，ClientCAs为校验客户端证书的CA
+// 版本低于TLS 1.2时强制为TLS 1.2，未设置ClientAuth时要求并校验客户端证书
+// authorizer为nil时不做授权，否则客户端证书的角色扩展无法解析时记录并断开连接
+func (s *Simulator) ServeTLS(listener net.Listener, config *tls.Config, authorizer *Authorizer) error {
+	config = config.Clone()
+	if config.MinVersion < tls.VersionTLS12 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if config.ClientAuth == tls.NoClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return s.accept(listener, func(conn net.Conn) {
+		tlsConn := tls.Server(conn, config)
+		ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			_ = conn.Close()
+			return
+		}
+		if authorizer == nil {
+			_ = s.ServeConn(tlsConn, statute.FrameTCP)
+			return
+		}
+		var role string
+		if certificates := tlsConn.ConnectionState().PeerCertificates; len(certificates) > 0 {
+			if role, err = Role(certificates[0]); err != nil {
+				//角色扩展无法解析时断开连接，不使用Default权限
+				authorizer.logger().Warn("modbus connection denied", slog.String("remote", conn.RemoteAddr().String()), slog.String("subject", certificates[0].Subject.String()), slog.Any("error", err))
+				_ = tlsConn.Close()
+				return
+			}
+		}
+		_ = s.serveConn(tlsConn, statute.FrameTCP, HandlerFunc(func(slaveId byte, pdu []byte) []byte {
+			if exceptionCode := authorizer.check(conn.RemoteAddr(), role, slaveId, pdu); exceptionCode != 0 {
+				return []byte{pdu[0] | 0x80, exceptionCode}
+			}
+			return s.Handle(slaveId, pdu)
+		}))
+	})
+}
@@ -0,0 +1,275 @@
+package simulator
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestAuthorize(t *testing.T) {
+	authorizer := &Authorizer{
+		Roles: map[string]*Permission{
+			"operator": {FuncCodes: []byte{0x03, 0x06, 0x10, 0x17}, Addresses: []AddressRange{{From: 0, To: 9}, {From: 100, To: 199}}},
+			"viewer":   {FuncCodes: []byte{0x01, 0x03}},
+		},
+		Default: &Permission{FuncCodes: []byte{0x11}},
+	}
+	tests := []struct {
+		name string
+		role string
+		pdu  []byte
+		want byte
+	}{
+		{"read allowed", "operator", []byte{0x03, 0x00, 0x00, 0x00, 0x0A}, 0},
+		{"read past range", "operator", []byte{0x03, 0x00, 0x05, 0x00, 0x06}, statute.ExceptionIllegalDataAddress},
+		{"read across ranges", "operator", []byte{0x03, 0x00, 0x09, 0x00, 0x5C}, statute.ExceptionIllegalDataAddress},
+		{"write single in second range", "operator", []byte{0x06, 0x00, 0xC7, 0x00, 0x01}, 0},
+		{"write single outside", "operator", []byte{0x06, 0x00, 0xC8, 0x00, 0x01}, statute.ExceptionIllegalDataAddress},
+		{"write multiple", "operator", []byte{0x10, 0x00, 0x64, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02}, 0},
+		{"read write both allowed", "operator", []byte{0x17, 0x00, 0x00, 0x00, 0x02, 0x00, 0x64, 0x00, 0x01, 0x02, 0x00, 0x01}, 0},
+		{"read write target denied", "operator", []byte{0x17, 0x00, 0x00, 0x00, 0x02, 0x00, 0x0A, 0x00, 0x01, 0x02, 0x00, 0x01}, statute.ExceptionIllegalDataAddress},
+		{"malformed request", "operator", []byte{0x03, 0x00}, statute.ExceptionIllegalDataAddress},
+		{"function denied", "operator", []byte{0x05, 0x00, 0x00, 0xFF, 0x00}, statute.ExceptionIllegalFunction},
+		{"viewer any address", "viewer", []byte{0x01, 0xFF, 0x00, 0x00, 0x10}, 0},
+		{"viewer cannot write", "viewer", []byte{0x06, 0x00, 0x00, 0x00, 0x01}, statute.ExceptionIllegalFunction},
+		{"default role", "", []byte{0x11}, 0},
+		{"unknown role uses default", "admin", []byte{0x03, 0x00, 0x00, 0x00, 0x01}, statute.ExceptionIllegalFunction},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := authorizer.Authorize(test.role, test.pdu); got != test.want {
+				t.Fatalf("Authorize(%q, % x) = %d, want %d", test.role, test.pdu, got, test.want)
+			}
+		})
+	}
+	//没有默认权限时拒绝
+	if got := (&Authorizer{}).Authorize("", []byte{0x11}); got != statute.ExceptionIllegalFunction {
+		t.Fatalf("Authorize without default = %d", got)
+	}
+}
+
+// 测试用的证书颁发机构
+type authority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pool        *x509.CertPool
+}
+
+func newAuthority(t *testing.T) *authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	return &authority{certificate: certificate, key: key, pool: pool}
+}
+
+// 签发证书，role不为空时加入角色扩展
+func (a *authority) issue(t *testing.T, name, role string) tls.Certificate {
+	t.Helper()
+	if role == "" {
+		return a.sign(t, name, nil)
+	}
+	value, err := asn1.MarshalWithParams(role, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.sign(t, name, value)
+}
+
+// 签发证书，roleValue不为nil时作为角色扩展的原始内容
+func (a *authority) sign(t *testing.T, name string, roleValue []byte) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if roleValue != nil {
+		template.ExtraExtensions = []pkix.Extension{{Id: RoleOID, Value: roleValue}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.certificate, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestRole(t *testing.T) {
+	ca := newAuthority(t)
+	for _, role := range []string{"operator", ""} {
+		certificate, err := x509.ParseCertificate(ca.issue(t, "client", role).Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := Role(certificate); err != nil || got != role {
+			t.Fatalf("Role = %q %v, want %q", got, err, role)
+		}
+	}
+}
+
+func TestRoleMalformed(t *testing.T) {
+	ca := newAuthority(t)
+	certificate, err := x509.ParseCertificate(ca.sign(t, "client", []byte{0x02, 0x01, 0x07}).Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role, err := Role(certificate); err == nil {
+		t.Fatalf("Role = %q, want an error for an integer role", role)
+	}
+}
+
+func isException(err error, code byte) bool {
+	var abnormal *statute.ReturnedAbnormalFuncCode
+	return errors.As(err, &abnormal) && abnormal.GetExceptionCode() == code
+}
+
+// 日志在服务端协程中写入
+type lockedWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.w.Write(p)
+}
+
+func TestServeTLSRoles(t *testing.T) {
+	ca := newAuthority(t)
+	sim := NewSimulator(1)
+	defer sim.Close()
+	_ = sim.Slave(1).SetHoldingRegisters(0, 42)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	writer := &lockedWriter{w: &logs}
+	authorizer := &Authorizer{
+		Roles:  map[string]*Permission{"operator": {FuncCodes: []byte{0x03, 0x06}, Addresses: []AddressRange{{From: 0, To: 9}}}},
+		Logger: slog.New(slog.NewTextHandler(writer, nil)),
+	}
+	go func() {
+		_ = sim.ServeTLS(listener, &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "127.0.0.1", "")}, ClientCAs: ca.pool}, authorizer)
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+	dial := func(role string) *modbus.ModbusTCPPacket {
+		client, err := modbus.NewModbusTCPPacket("127.0.0.1", port, time.Second, time.Second, time.Second, 0, modbus.ModbusTCP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SetTLS(&tls.Config{Certificates: []tls.Certificate{ca.issue(t, "client", role)}, RootCAs: ca.pool})
+		if err = client.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+	operator := dial("operator")
+	if data, err := operator.ReadHoldingRegisters(1, 0, 1); err != nil || !bytes.Equal(data, []byte{0, 42}) {
+		t.Fatalf("ReadHoldingRegisters = % x %v", data, err)
+	}
+	if _, _, err = operator.WriteSingleRegister(1, 10, 1); !isException(err, statute.ExceptionIllegalDataAddress) {
+		t.Fatalf("write outside range = %v", err)
+	}
+	if _, _, err = operator.WriteSingleCoil(1, 0, true); !isException(err, statute.ExceptionIllegalFunction) {
+		t.Fatalf("write coil = %v", err)
+	}
+	//证书中没有角色，也没有默认权限
+	if _, err = dial("").ReadHoldingRegisters(1, 0, 1); !isException(err, statute.ExceptionIllegalFunction) {
+		t.Fatalf("read without role = %v", err)
+	}
+	if registers, _ := sim.Slave(1).HoldingRegisters(10, 1); registers[0] != 0 {
+		t.Fatal("denied write was applied")
+	}
+	writer.lock.Lock()
+	text := logs.String()
+	writer.lock.Unlock()
+	for _, want := range []string{"modbus request denied", "role=operator", "address=10", "exception=IllegalDataAddress", "function=WriteSingleCoil"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("log missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestServeTLSMalformedRole(t *testing.T) {
+	ca := newAuthority(t)
+	sim := NewSimulator(1)
+	defer sim.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	writer := &lockedWriter{w: &logs}
+	//默认权限允许全部请求，无法解析的角色也不能使用它
+	authorizer := &Authorizer{Default: &Permission{}, Logger: slog.New(slog.NewTextHandler(writer, nil))}
+	go func() {
+		_ = sim.ServeTLS(listener, &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "127.0.0.1", "")}, ClientCAs: ca.pool}, authorizer)
+	}()
+	client, err := modbus.NewModbusTCPPacket("127.0.0.1", listener.Addr().(*net.TCPAddr).Port, time.Second, time.Second, time.Second, 0, modbus.ModbusTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetTLS(&tls.Config{Certificates: []tls.Certificate{ca.sign(t, "client", []byte{0x02, 0x01, 0x07})}, RootCAs: ca.pool})
+	//TLS 1.3的客户端在服务端校验证书前完成握手，连接在之后的读写中断开
+	if err = client.Connect(); err == nil {
+		_, err = client.ReadHoldingRegisters(1, 0, 1)
+	}
+	if err == nil || isException(err, statute.ExceptionIllegalFunction) {
+		t.Fatalf("request with a malformed role = %v, want the connection closed", err)
+	}
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	if text := logs.String(); !strings.Contains(text, "modbus connection denied") || !strings.Contains(text, `subject="CN=client"`) {
+		t.Fatalf("log = %s", text)
+	}
+}
@@ -0,0 +1,82 @@
+package simulator
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Seed 寄存器组的JSON种子，键为从站id和起始地址，例如：
+//
+//	{
+//	  "slaves": {
+//	    "1": {
+//	      "coils": {"0": [true, false, true]},
+//	      "discreteInputs": {"0": [true]},
+//	      "holdingRegisters": {"100": [1, 2, 3]},
+//	      "inputRegisters": {"0": [42]}
+//	    }
+//	  }
+//	}
+type Seed struct {
+	Slaves map[byte]*SlaveSeed `json:"slaves"`
+}
+
+// SlaveSeed 一个虚拟从站的种子
+type SlaveSeed struct {
+	Coils            map[uint16][]bool   `json:"coils,omitempty"`
+	DiscreteInputs   map[uint16][]bool   `json:"discreteInputs,omitempty"`
+	HoldingRegisters map[uint16][]uint16 `json:"holdingRegisters,omitempty"`
+	InputRegisters   map[uint16][]uint16 `json:"inputRegisters,omitempty"`
+}
+
+// LoadJSONFile 从JSON文件加载种子
+func (s *Simulator) LoadJSONFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.LoadJSON(f)
+}
+
+// LoadJSON 从JSON加载种子，不存在的从站会被创建
+func (s *Simulator) LoadJSON(r io.Reader) error {
+	var seed Seed
+	if err := json.NewDecoder(r).Decode(&seed); err != nil {
+		return err
+	}
+	return s.Apply(&seed)
+}
+
+// Apply 应用种子，不存在的从站会被创建
+func (s *Simulator) Apply(seed *Seed) error {
+	for slaveId, slave := range seed.Slaves {
+		if slave == nil {
+			s.AddSlave(slaveId)
+			continue
+		}
+		bank := s.AddSlave(slaveId)
+		for address, values := range slave.Coils {
+			if err := bank.SetCoils(address, values...); err != nil {
+				return err
+			}
+		}
+		for address, values := range slave.DiscreteInputs {
+			if err := bank.SetDiscreteInputs(address, values...); err != nil {
+				return err
+			}
+		}
+		for address, values := range slave.HoldingRegisters {
+			if err := bank.SetHoldingRegisters(address, values...); err != nil {
+				return err
+			}
+		}
+		for address, values := range slave.InputRegisters {
+			if err := bank.SetInputRegisters(address, values...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package simulator
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/fault"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// ListenAndServe 监听addr并按kind的帧格式提供服务
+// kind为statute.FrameTCP时为Modbus TCP，为statute.FrameRTU时为RTU over TCP，为statute.FrameASCII时为ASCII over TCP
+func (s *Simulator) ListenAndServe(addr string, kind statute.FrameKind) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener, kind)
+}
+
+// Serve 在listener上按kind的帧格式提供服务，直到Close
+func (s *Simulator) Serve(listener net.Listener, kind statute.FrameKind) error {
+	return s.accept(listener, func(conn net.Conn) {
+		_ = s.ServeConn(conn, kind)
+	})
+}
+
+// 接受listener上的连接并交给handle，直到Close
+func (s *Simulator) accept(listener net.Listener, handle func(conn net.Conn)) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return net.ErrClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.lock.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			if s.closed {
+				return nil
+			}
+			return err
+		}
+		go handle(conn)
+	}
+}
+
+// ServeConn 在一个字节流上按kind的帧格式提供服务，直到出错或关闭
+// conn可以是网络连接、串口或伪终端
+func (s *Simulator) ServeConn(conn io.ReadWriteCloser, kind statute.FrameKind) error {
+	return s.serveConn(conn, kind, s)
+}
+
+// 跟踪连接并用handler提供服务
+func (s *Simulator) serveConn(conn io.ReadWriteCloser, kind statute.FrameKind, handler Handler) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return conn.Close()
+	}
+	s.conns[conn] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+	}()
+	return serve(conn, kind, handler, func() *fault.Injector {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		return s.injector
+	})
+}
+
+// ServeHandler 在一个字节流上按kind的帧格式用handler提供服务，直到出错或关闭
+func ServeHandler(conn io.ReadWriteCloser, kind statute.FrameKind, handler Handler) error {
+	return serve(conn, kind, handler, nil)
+}
+
+func serve(conn io.ReadWriteCloser, kind statute.FrameKind, handler Handler, injector func() *fault.Injector) error {
+	defer func() {
+		_ = conn.Close()
+	}()
+	framer, err := statute.NewFramer(kind)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := statute.ReadRequest(reader, kind)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, os.ErrClosed) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			switch kind {
+			case statute.FrameRTU:
+				//RTU帧错误时丢弃缓存重新同步
+				_, _ = reader.Discard(reader.Buffered())
+				continue
+			case statute.FrameASCII:
+				//ASCII帧以':'和换行自行同步
+				continue
+			}
+			return err
+		}
+		response := respond(handler, request, framer)
+		if injector != nil {
+			if i := injector(); i != nil {
+				action := i.Apply(kind, request, response)
+				time.Sleep(action.Delay)
+				if action.Reset {
+					return nil
+				}
+				if action.Drop {
+					continue
+				}
+				response = action.Response
+			}
+		}
+		if len(response) == 0 {
+			continue
+		}
+		if _, err = conn.Write(response); err != nil {
+			return err
+		}
+	}
+}
+
+// 处理一帧请求，返回响应帧
+// 串口帧格式下未知从站不应答，TCP下返回网关目标设备无响应
+func respond(handler Handler, request []byte, framer statute.Framer) []byte {
+	adu, err := framer.Decode(request)
+	if err != nil {
+		return nil
+	}
+	serial := framer.Kind() != statute.FrameTCP
+	response := handler.Handle(adu.SlaveId, adu.PDU)
+	if serial && (response == nil || adu.SlaveId == 0) {
+		//广播不应答
+		return nil
+	}
+	if response == nil {
+		response = []byte{adu.PDU[0] | 0x80, statute.ExceptionGatewayTargetFailed}
+	}
+	frame, _ := framer.Encode(&statute.ADU{TransactionId: adu.TransactionId, SlaveId: adu.SlaveId, PDU: response})
+	return frame
+}
+
+// ServePty 创建一对伪终端并在主设备上以RTU帧格式提供服务，返回从设备路径
+// 从设备可以作为串口被ModbusRTUPacket打开，Close时关闭伪终端
+func (s *Simulator) ServePty() (string, error) {
+	pty, err := OpenPty()
+	if err != nil {
+		return "", err
+	}
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		_ = pty.Close()
+		return "", net.ErrClosed
+	}
+	s.closers = append(s.closers, pty.Close)
+	s.lock.Unlock()
+	go func() {
+		_ = s.ServeConn(pty.Master, statute.FrameRTU)
+	}()
+	return pty.SlavePath, nil
+}
+
+// Close 停止所有服务并关闭所有连接
+func (s *Simulator) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	var errs []error
+	for _, listener := range s.listeners {
+		errs = append(errs, listener.Close())
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	for _, closer := range s.closers {
+		errs = append(errs, closer())
+	}
+	return errors.Join(errs...)
+}
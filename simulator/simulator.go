@@ -0,0 +1,172 @@
+package simulator
+
+import (
+	"io"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/VaccariaSeed/go-modbus/fault"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// Handler 处理一个请求PDU
+// 返回响应PDU，返回nil表示不应答
+type Handler interface {
+	Handle(slaveId byte, pdu []byte) []byte
+}
+
+// HandlerFunc 函数形式的Handler
+type HandlerFunc func(slaveId byte, pdu []byte) []byte
+
+func (f HandlerFunc) Handle(slaveId byte, pdu []byte) []byte {
+	return f(slaveId, pdu)
+}
+
+var _ Handler = (*Simulator)(nil)
+
+// NewSimulator 创建一个模拟器，ids为要创建的虚拟从站id
+func NewSimulator(ids ...byte) *Simulator {
+	s := &Simulator{slaves: make(map[byte]*RegisterBank), conns: make(map[io.Closer]struct{})}
+	for _, id := range ids {
+		s.AddSlave(id)
+	}
+	return s
+}
+
+// Simulator 托管一个或多个虚拟从站的模拟器
+type Simulator struct {
+	lock      sync.RWMutex
+	slaves    map[byte]*RegisterBank
+	listeners []net.Listener
+	conns     map[io.Closer]struct{}
+	closers   []func() error
+	closed    bool
+	injector  *fault.Injector
+}
+
+// SetFaults 设置故障注入器，对之后的每帧响应注入故障，nil表示关闭
+func (s *Simulator) SetFaults(injector *fault.Injector) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.injector = injector
+}
+
+// AddSlave 添加一个虚拟从站，已存在时返回原有的寄存器组
+func (s *Simulator) AddSlave(slaveId byte) *RegisterBank {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if bank, ok := s.slaves[slaveId]; ok {
+		return bank
+	}
+	bank := NewRegisterBank()
+	s.slaves[slaveId] = bank
+	return bank
+}
+
+// Slave 获取虚拟从站的寄存器组，不存在时返回nil
+func (s *Simulator) Slave(slaveId byte) *RegisterBank {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.slaves[slaveId]
+}
+
+// SlaveIds 所有虚拟从站的id，从小到大排列
+func (s *Simulator) SlaveIds() []byte {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ids := make([]byte, 0, len(s.slaves))
+	for id := range s.slaves {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Handle 处理一个请求PDU，不存在的从站不应答
+func (s *Simulator) Handle(slaveId byte, pdu []byte) []byte {
+	bank := s.Slave(slaveId)
+	if bank == nil || len(pdu) == 0 {
+		return nil
+	}
+	return bank.Handle(pdu)
+}
+
+// Handle 以该寄存器组作为从站处理一个请求PDU
+func (b *RegisterBank) Handle(pdu []byte) []byte {
+	request, err := statute.ParseRequest(pdu)
+	if err != nil {
+		return exception(pdu[0], statute.ExceptionIllegalDataValue)
+	}
+	response, exceptionCode := b.handle(request)
+	if exceptionCode != 0 {
+		return exception(pdu[0], exceptionCode)
+	}
+	data, err := response.MarshalBinary()
+	if err != nil {
+		return exception(pdu[0], statute.ExceptionServerDeviceFailure)
+	}
+	return data
+}
+
+// 执行请求，失败时返回异常码
+func (b *RegisterBank) handle(request statute.PDU) (statute.PDU, byte) {
+	switch r := request.(type) {
+	case *statute.ReadCoilsRequest:
+		values, exceptionCode := read(b.Coils, r.Address, r.Quantity, statute.MaxReadBits)
+		return &statute.ReadCoilsResponse{Values: values}, exceptionCode
+	case *statute.ReadDiscreteInputsRequest:
+		values, exceptionCode := read(b.DiscreteInputs, r.Address, r.Quantity, statute.MaxReadBits)
+		return &statute.ReadDiscreteInputsResponse{Values: values}, exceptionCode
+	case *statute.ReadHoldingRegistersRequest:
+		values, exceptionCode := read(b.HoldingRegisters, r.Address, r.Quantity, statute.MaxReadRegisters)
+		return &statute.ReadHoldingRegistersResponse{Values: values}, exceptionCode
+	case *statute.ReadInputRegistersRequest:
+		values, exceptionCode := read(b.InputRegisters, r.Address, r.Quantity, statute.MaxReadRegisters)
+		return &statute.ReadInputRegistersResponse{Values: values}, exceptionCode
+	case *statute.WriteSingleCoilRequest:
+		if err := b.SetCoils(r.Address, r.Value); err != nil {
+			return nil, statute.ExceptionIllegalDataAddress
+		}
+		return (*statute.WriteSingleCoilResponse)(r), 0
+	case *statute.WriteSingleRegisterRequest:
+		if err := b.SetHoldingRegisters(r.Address, r.Value); err != nil {
+			return nil, statute.ExceptionIllegalDataAddress
+		}
+		return (*statute.WriteSingleRegisterResponse)(r), 0
+	case *statute.WriteMultipleCoilsRequest:
+		if len(r.Values) > statute.MaxWriteBits {
+			return nil, statute.ExceptionIllegalDataValue
+		}
+		if err := b.SetCoils(r.Address, r.Values...); err != nil {
+			return nil, statute.ExceptionIllegalDataAddress
+		}
+		return &statute.WriteMultipleCoilsResponse{Address: r.Address, Quantity: uint16(len(r.Values))}, 0
+	case *statute.WriteMultipleRegistersRequest:
+		if len(r.Values) > statute.MaxWriteRegisters {
+			return nil, statute.ExceptionIllegalDataValue
+		}
+		if err := b.SetHoldingRegisters(r.Address, r.Values...); err != nil {
+			return nil, statute.ExceptionIllegalDataAddress
+		}
+		return &statute.WriteMultipleRegistersResponse{Address: r.Address, Quantity: uint16(len(r.Values))}, 0
+	}
+	return nil, statute.ExceptionIllegalFunction
+}
+
+// 读取number个值，数量需在1~limit之间
+func read[T any](get func(address, number uint16) ([]T, error), address, number, limit uint16) ([]T, byte) {
+	if number == 0 || number > limit {
+		return nil, statute.ExceptionIllegalDataValue
+	}
+	values, err := get(address, number)
+	if err != nil {
+		return nil, statute.ExceptionIllegalDataAddress
+	}
+	return values, 0
+}
+
+func exception(funcCode, exceptionCode byte) []byte {
+	data, _ := (&statute.ExceptionResponse{Function: funcCode, ExceptionCode: exceptionCode}).MarshalBinary()
+	return data
+}
@@ -0,0 +1,197 @@
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+func TestRegisterBank(t *testing.T) {
+	bank := NewRegisterBank()
+	if err := bank.SetHoldingRegisters(0xFFFE, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if values, err := bank.HoldingRegisters(0xFFFE, 2); err != nil || !slices.Equal(values, []uint16{1, 2}) {
+		t.Fatalf("HoldingRegisters = %v, %v", values, err)
+	}
+	if err := bank.SetHoldingRegisters(0xFFFF, 1, 2); !errors.Is(err, OutOfRangeError) {
+		t.Fatalf("write past the end = %v, want OutOfRangeError", err)
+	}
+	if _, err := bank.InputRegisters(0xFFFF, 2); !errors.Is(err, OutOfRangeError) {
+		t.Fatalf("read past the end = %v, want OutOfRangeError", err)
+	}
+	if err := bank.SetCoils(7, true, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := bank.Coils(6, 4); !slices.Equal(values, []bool{false, true, false, true}) {
+		t.Fatalf("Coils = %v", values)
+	}
+	if values, _ := bank.DiscreteInputs(7, 1); values[0] {
+		t.Fatal("coils and discrete inputs share storage")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	sim := NewSimulator(1)
+	defer sim.Close()
+	_ = sim.Slave(1).SetHoldingRegisters(0, 0x1234, 0x5678)
+	_ = sim.Slave(1).SetInputRegisters(3, 9)
+	_ = sim.Slave(1).SetDiscreteInputs(0, true, false, true)
+	tests := []struct {
+		name    string
+		slaveId byte
+		pdu     []byte
+		want    []byte
+	}{
+		{"read holding registers", 1, []byte{0x03, 0x00, 0x00, 0x00, 0x02}, []byte{0x03, 0x04, 0x12, 0x34, 0x56, 0x78}},
+		{"read input registers", 1, []byte{0x04, 0x00, 0x03, 0x00, 0x01}, []byte{0x04, 0x02, 0x00, 0x09}},
+		{"read discrete inputs", 1, []byte{0x02, 0x00, 0x00, 0x00, 0x03}, []byte{0x02, 0x01, 0x05}},
+		{"write single coil", 1, []byte{0x05, 0x00, 0x02, 0xFF, 0x00}, []byte{0x05, 0x00, 0x02, 0xFF, 0x00}},
+		{"write single register", 1, []byte{0x06, 0x00, 0x05, 0x00, 0x07}, []byte{0x06, 0x00, 0x05, 0x00, 0x07}},
+		{"write multiple coils", 1, []byte{0x0F, 0x00, 0x10, 0x00, 0x09, 0x02, 0xFF, 0x01}, []byte{0x0F, 0x00, 0x10, 0x00, 0x09}},
+		{"write multiple registers", 1, []byte{0x10, 0x00, 0x20, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02}, []byte{0x10, 0x00, 0x20, 0x00, 0x02}},
+		{"illegal function", 1, []byte{0x2B, 0x0E, 0x01, 0x00}, []byte{0xAB, statute.ExceptionIllegalFunction}},
+		{"illegal data address", 1, []byte{0x03, 0xFF, 0xFF, 0x00, 0x02}, []byte{0x83, statute.ExceptionIllegalDataAddress}},
+		{"quantity too large", 1, []byte{0x03, 0x00, 0x00, 0x00, 0x7E}, []byte{0x83, statute.ExceptionIllegalDataValue}},
+		{"invalid coil value", 1, []byte{0x05, 0x00, 0x00, 0x12, 0x34}, []byte{0x85, statute.ExceptionIllegalDataValue}},
+		{"byte count mismatch", 1, []byte{0x10, 0x00, 0x00, 0x00, 0x02, 0x02, 0x00, 0x01}, []byte{0x90, statute.ExceptionIllegalDataValue}},
+		{"zero quantity", 1, []byte{0x01, 0x00, 0x00, 0x00, 0x00}, []byte{0x81, statute.ExceptionIllegalDataValue}},
+		{"too many coils", 1, append([]byte{0x0F, 0x00, 0x00, 0x07, 0xB1, 0xF7}, make([]byte, 0xF7)...), []byte{0x8F, statute.ExceptionIllegalDataValue}},
+		{"coils out of range", 1, []byte{0x0F, 0xFF, 0xFF, 0x00, 0x02, 0x01, 0x03}, []byte{0x8F, statute.ExceptionIllegalDataAddress}},
+		{"report server id", 1, []byte{0x11}, []byte{0x91, statute.ExceptionIllegalFunction}},
+		{"exception function code", 1, []byte{0x83, 0x02}, []byte{0x83, statute.ExceptionIllegalFunction}},
+		{"unknown slave", 2, []byte{0x03, 0x00, 0x00, 0x00, 0x01}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sim.Handle(test.slaveId, test.pdu); !bytes.Equal(got, test.want) {
+				t.Fatalf("Handle = % x, want % x", got, test.want)
+			}
+		})
+	}
+	coils, _ := sim.Slave(1).Coils(16, 9)
+	if !slices.Equal(coils, []bool{true, true, true, true, true, true, true, true, true}) {
+		t.Fatalf("coils after write = %v", coils)
+	}
+	registers, _ := sim.Slave(1).HoldingRegisters(32, 2)
+	if !slices.Equal(registers, []uint16{1, 2}) {
+		t.Fatalf("registers after write = %v", registers)
+	}
+}
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		kind       statute.FrameKind
+		modbusType modbus.StatuteType
+	}{
+		{statute.FrameTCP, modbus.ModbusTCP},
+		{statute.FrameRTU, modbus.ModbusRTU},
+	}
+	for _, test := range tests {
+		t.Run(string(test.modbusType), func(t *testing.T) {
+			sim := NewSimulator(1, 2)
+			_ = sim.Slave(2).SetHoldingRegisters(100, 42)
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() { done <- sim.Serve(listener, test.kind) }()
+			client, err := modbus.NewModbusTCPPacket("127.0.0.1", listener.Addr().(*net.TCPAddr).Port, time.Second, 200*time.Millisecond, time.Second, 0, test.modbusType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = client.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			data, err := client.ReadHoldingRegisters(2, 100, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, []byte{0, 42}) {
+				t.Fatalf("data = % x, want 00 2a", data)
+			}
+			if _, _, err = client.WriteMultipleRegisters(1, 0, 5, 6); err != nil {
+				t.Fatal(err)
+			}
+			if registers, _ := sim.Slave(1).HoldingRegisters(0, 2); !slices.Equal(registers, []uint16{5, 6}) {
+				t.Fatalf("registers = %v, want [5 6]", registers)
+			}
+			if err = sim.Close(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err = <-done:
+				if err != nil {
+					t.Fatalf("Serve = %v, want nil after Close", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Serve did not return after Close")
+			}
+			if _, err = client.ReadHoldingRegisters(2, 100, 1); err == nil {
+				t.Fatal("read succeeded after Close")
+			}
+		})
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	sim := NewSimulator()
+	defer sim.Close()
+	seed := `{"slaves": {"3": {"coils": {"1": [true]}, "holdingRegisters": {"100": [1, 2]}, "inputRegisters": {"0": [42]}}, "4": null}}`
+	if err := sim.LoadJSON(strings.NewReader(seed)); err != nil {
+		t.Fatal(err)
+	}
+	if ids := sim.SlaveIds(); !slices.Equal(ids, []byte{3, 4}) {
+		t.Fatalf("SlaveIds = %v", ids)
+	}
+	if registers, _ := sim.Slave(3).HoldingRegisters(100, 2); !slices.Equal(registers, []uint16{1, 2}) {
+		t.Fatalf("holding registers = %v", registers)
+	}
+	if registers, _ := sim.Slave(3).InputRegisters(0, 1); registers[0] != 42 {
+		t.Fatalf("input registers = %v", registers)
+	}
+	if coils, _ := sim.Slave(3).Coils(0, 2); !slices.Equal(coils, []bool{false, true}) {
+		t.Fatalf("coils = %v", coils)
+	}
+	if err := sim.LoadJSON(strings.NewReader(`{"slaves": {"1": {"holdingRegisters": {"65535": [1, 2]}}}}`)); !errors.Is(err, OutOfRangeError) {
+		t.Fatalf("seed past the end = %v, want OutOfRangeError", err)
+	}
+}
+
+func TestServePty(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pty is only supported on linux")
+	}
+	sim := NewSimulator(1)
+	defer sim.Close()
+	_ = sim.Slave(1).SetHoldingRegisters(0, 7)
+	path, err := sim.ServePty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := modbus.NewModbusRTUPacket(path, 9600, 8, modbus.ParityNone, 1, 500*time.Millisecond, 0, modbus.ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	data, err := client.ReadHoldingRegisters(1, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, 7}) {
+		t.Fatalf("data = % x, want 00 07", data)
+	}
+}
@@ -0,0 +1,196 @@
+package statute
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ADU 应用数据单元，即带有帧头和校验的完整报文
+type ADU struct {
+	TransactionId uint16 //事务标识，仅MBAP
+	SlaveId       byte
+	PDU           []byte //功能码+数据域
+}
+
+// NewADU 将任意PDU封装为ADU
+func NewADU(transactionId uint16, slaveId byte, pdu PDU) (*ADU, error) {
+	data, err := pdu.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &ADU{TransactionId: transactionId, SlaveId: slaveId, PDU: data}, nil
+}
+
+// Request 将PDU解析为请求类型
+func (a *ADU) Request() (PDU, error) {
+	return ParseRequest(a.PDU)
+}
+
+// Response 将PDU解析为响应类型
+func (a *ADU) Response() (PDU, error) {
+	return ParseResponse(a.PDU)
+}
+
+// Framer ADU的帧格式
+type Framer interface {
+	Kind() FrameKind
+	// Encode 将ADU编码为报文
+	Encode(adu *ADU) ([]byte, error)
+	// Decode 将一条完整的报文解码为ADU，校验错误时同时返回ADU和校验错误
+	Decode(frame []byte) (*ADU, error)
+	// ReadFrame 从流中读取一条完整的报文，request表示按请求还是响应的长度规则读取
+	ReadFrame(r io.Reader, request bool) ([]byte, error)
+}
+
+// NewFramer 返回帧格式对应的Framer
+func NewFramer(kind FrameKind) (Framer, error) {
+	switch kind {
+	case FrameTCP:
+		return MBAPFramer{}, nil
+	case FrameRTU:
+		return RTUFramer{}, nil
+	case FrameASCII:
+		return ASCIIFramer{}, nil
+	}
+	return nil, fmt.Errorf("unknown frame kind:%s", kind)
+}
+
+func checkADU(adu *ADU) error {
+	if len(adu.PDU) == 0 || len(adu.PDU) > maxPduLength {
+		return errors.New("invalid pdu length")
+	}
+	return nil
+}
+
+// MBAPFramer Modbus TCP的MBAP帧：事务标识+协议标识+长度+单元id+PDU
+type MBAPFramer struct {
+}
+
+func (f MBAPFramer) Kind() FrameKind { return FrameTCP }
+
+func (f MBAPFramer) Encode(adu *ADU) ([]byte, error) {
+	if err := checkADU(adu); err != nil {
+		return nil, err
+	}
+	return BuildTCPFrame(adu.TransactionId, adu.SlaveId, adu.PDU), nil
+}
+
+func (f MBAPFramer) Decode(frame []byte) (*ADU, error) {
+	if len(frame) < tcpHeaderLength+2 {
+		return nil, fmt.Errorf("%w: frame too short", ErrShortFrame)
+	}
+	if binary.BigEndian.Uint16(frame[2:]) != 0 {
+		return nil, fmt.Errorf("%w: invalid protocol identifier", ErrProtocolViolation)
+	}
+	if int(binary.BigEndian.Uint16(frame[4:])) != len(frame)-tcpHeaderLength {
+		return nil, fmt.Errorf("%w: invalid length", ErrProtocolViolation)
+	}
+	return &ADU{TransactionId: binary.BigEndian.Uint16(frame), SlaveId: frame[6], PDU: frame[7:]}, nil
+}
+
+func (f MBAPFramer) ReadFrame(r io.Reader, _ bool) ([]byte, error) {
+	return ReadTCPFrame(r)
+}
+
+// RTUFramer RTU帧：从站id+PDU+CRC
+type RTUFramer struct {
+}
+
+func (f RTUFramer) Kind() FrameKind { return FrameRTU }
+
+func (f RTUFramer) Encode(adu *ADU) ([]byte, error) {
+	if err := checkADU(adu); err != nil {
+		return nil, err
+	}
+	return BuildRTUFrame(adu.SlaveId, adu.PDU), nil
+}
+
+func (f RTUFramer) Decode(frame []byte) (*ADU, error) {
+	if len(frame) < 4 {
+		return nil, fmt.Errorf("%w: frame too short", ErrShortFrame)
+	}
+	adu := &ADU{SlaveId: frame[0], PDU: frame[1 : len(frame)-2]}
+	if !bytes.Equal(Crc16(frame[:len(frame)-2]), frame[len(frame)-2:]) {
+		return adu, CsError
+	}
+	return adu, nil
+}
+
+func (f RTUFramer) ReadFrame(r io.Reader, request bool) ([]byte, error) {
+	return readRTUFrame(r, request)
+}
+
+// ASCIIFramer ASCII帧：':'+十六进制(从站id+PDU+LRC)+CRLF
+type ASCIIFramer struct {
+}
+
+func (f ASCIIFramer) Kind() FrameKind { return FrameASCII }
+
+func (f ASCIIFramer) Encode(adu *ADU) ([]byte, error) {
+	if err := checkADU(adu); err != nil {
+		return nil, err
+	}
+	return BuildASCIIFrame(adu.SlaveId, adu.PDU), nil
+}
+
+func (f ASCIIFramer) Decode(frame []byte) (*ADU, error) {
+	data, err := DecodeASCIIFrame(frame)
+	if data == nil {
+		return nil, err
+	}
+	return &ADU{SlaveId: data[0], PDU: data[1 : len(data)-1]}, err
+}
+
+// ReadFrame 读取到换行为止，丢弃':'之前的字节
+func (f ASCIIFramer) ReadFrame(r io.Reader, _ bool) ([]byte, error) {
+	return ReadASCIIFrame(r)
+}
+
+// ReadASCIIFrame 从流中读取一条ASCII报文，丢弃':'之前的字节，并校验LRC
+// r没有实现io.ByteReader时逐字节读取
+func ReadASCIIFrame(r io.Reader) ([]byte, error) {
+	reader, ok := r.(io.ByteReader)
+	if !ok {
+		reader = &byteReader{r: r}
+	}
+	var frame []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if len(frame) > 0 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch {
+		case b == ':':
+			frame = append(frame[:0], b)
+		case len(frame) == 0:
+		case b == '\n':
+			frame = append(frame, b)
+			if _, err = DecodeASCIIFrame(frame); err != nil && !errors.Is(err, LrcError) {
+				return nil, err
+			}
+			return frame, err
+		case len(frame) > 2*(maxPduLength+2)+2:
+			return nil, fmt.Errorf("%w: ascii frame too long", ErrProtocolViolation)
+		default:
+			frame = append(frame, b)
+		}
+	}
+}
+
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(b.r, b.buf[:]); err != nil {
+		return 0, err
+	}
+	return b.buf[0], nil
+}
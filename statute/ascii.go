@@ -0,0 +1,49 @@
+package statute
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// LrcError ASCII帧LRC校验错误，与ErrLRC相同
+var LrcError = ErrLRC
+
+// Lrc 计算ASCII报文的LRC，data为从站id和PDU
+func Lrc(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// BuildASCIIFrame 生成一条ASCII报文
+// slaveId 从站id
+// pdu 功能码及数据域
+func BuildASCIIFrame(slaveId byte, pdu []byte) []byte {
+	data := append([]byte{slaveId}, pdu...)
+	data = append(data, Lrc(data))
+	frame := make([]byte, 0, 2*len(data)+3)
+	frame = append(frame, ':')
+	frame = append(frame, strings.ToUpper(hex.EncodeToString(data))...)
+	return append(frame, '\r', '\n')
+}
+
+// DecodeASCIIFrame 将ASCII报文解码为二进制的从站id+PDU+LRC
+// LRC不正确时同时返回解码结果和LrcError
+func DecodeASCIIFrame(frame []byte) ([]byte, error) {
+	frame = bytes.TrimRight(frame, "\r\n")
+	if len(frame) < 7 || frame[0] != ':' || len(frame)%2 != 1 {
+		return nil, fmt.Errorf("%w: invalid ascii frame", ErrProtocolViolation)
+	}
+	data := make([]byte, (len(frame)-1)/2)
+	if _, err := hex.Decode(data, frame[1:]); err != nil {
+		return nil, err
+	}
+	if Lrc(data[:len(data)-1]) != data[len(data)-1] {
+		return data, LrcError
+	}
+	return data, nil
+}
@@ -54,6 +54,16 @@ type ModbusCodec interface {
 	// BuildWriteMultipleRegisters 写多个保持寄存器
 	BuildWriteMultipleRegisters(slaveId byte, address uint16, value ...uint16) ([]byte, error)
 
+	// BuildReportServerId 报告从站id
+	// slaveId 从站id
+	BuildReportServerId(slaveId byte) []byte
+
+	// BuildCustom 自定义请求，响应按功能码的长度规则读取，Decode返回功能码之后的全部数据
+	// slaveId 从站id
+	// funcCode 功能码
+	// data 功能码之后的数据域
+	BuildCustom(slaveId byte, funcCode byte, data []byte) []byte
+
 	// Decode 解码
 	// result 结果数据集
 	// error 解码错误
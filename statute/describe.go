@@ -0,0 +1,315 @@
+package statute
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Field 报文中的一个字段
+type Field struct {
+	Name  string
+	Bytes []byte //字段的原始字节，ASCII帧为解码后的字节
+	Value string
+}
+
+// Description 报文的逐字段说明
+type Description struct {
+	Kind    FrameKind
+	Request bool //是否按请求解析，异常响应和只符合响应长度规则的报文按响应解析
+	Fields  []*Field
+}
+
+// Describe 逐字段解析一条完整的报文，用于调试
+// kind为FrameASCII时frame为':'开头的ASCII报文
+// 校验错误和长度不符不返回错误，在对应字段中说明
+func Describe(frame []byte, kind FrameKind) (*Description, error) {
+	d := &Description{Kind: kind}
+	switch kind {
+	case FrameTCP:
+		if len(frame) < tcpHeaderLength+2 {
+			return nil, fmt.Errorf("%w: frame too short", ErrShortFrame)
+		}
+		d.add("Transaction ID", frame[0:2], "%d", binary.BigEndian.Uint16(frame))
+		protocol := "Modbus"
+		if binary.BigEndian.Uint16(frame[2:]) != 0 {
+			protocol = "unknown"
+		}
+		d.add("Protocol ID", frame[2:4], "%d (%s)", binary.BigEndian.Uint16(frame[2:]), protocol)
+		length := int(binary.BigEndian.Uint16(frame[4:]))
+		if length == len(frame)-tcpHeaderLength {
+			d.add("Length", frame[4:6], "%d", length)
+		} else {
+			d.add("Length", frame[4:6], "%d (mismatch, %d bytes follow)", length, len(frame)-tcpHeaderLength)
+		}
+		d.add("Unit ID", frame[6:7], "%d", frame[6])
+		d.describePdu(frame[7:])
+	case FrameRTU:
+		if len(frame) < 4 {
+			return nil, fmt.Errorf("%w: frame too short", ErrShortFrame)
+		}
+		d.add("Slave ID", frame[0:1], "%d", frame[0])
+		d.describePdu(frame[1 : len(frame)-2])
+		cs, check := frame[len(frame)-2:], Crc16(frame[:len(frame)-2])
+		if cs[0] == check[0] && cs[1] == check[1] {
+			d.add("CRC", cs, "valid")
+		} else {
+			d.add("CRC", cs, "invalid, expected %s", spaced(check))
+		}
+	case FrameASCII:
+		data, err := DecodeASCIIFrame(frame)
+		if err != nil && !errors.Is(err, LrcError) {
+			return nil, err
+		}
+		d.add("Slave ID", data[0:1], "%d", data[0])
+		d.describePdu(data[1 : len(data)-1])
+		if lrc := Lrc(data[:len(data)-1]); lrc == data[len(data)-1] {
+			d.add("LRC", data[len(data)-1:], "valid")
+		} else {
+			d.add("LRC", data[len(data)-1:], "invalid, expected %02x", lrc)
+		}
+	default:
+		return nil, fmt.Errorf("unknown frame kind:%s", kind)
+	}
+	return d, nil
+}
+
+// String 每个字段一行：原始字节、字段名、值
+func (d *Description) String() string {
+	var sb strings.Builder
+	for _, field := range d.Fields {
+		fmt.Fprintf(&sb, "%-17s %-16s %s\n", spaced(field.Bytes), field.Name, field.Value)
+	}
+	return sb.String()
+}
+
+func (d *Description) add(name string, b []byte, format string, args ...any) {
+	d.Fields = append(d.Fields, &Field{Name: name, Bytes: b, Value: fmt.Sprintf(format, args...)})
+}
+
+// 解析功能码和数据域
+func (d *Description) describePdu(pdu []byte) {
+	if len(pdu) == 0 {
+		return
+	}
+	funcCode, data := pdu[0], pdu[1:]
+	fitsRequest := funcCode&0x80 == 0 && fitsRule(funcCode, data, true)
+	fitsResponse := fitsRule(funcCode, data, false)
+	d.Request = fitsRequest || !fitsResponse
+	direction := "response"
+	switch {
+	case funcCode&0x80 != 0:
+		direction = "exception response"
+	case fitsRequest && fitsResponse && (funcCode == WriteSingleCoil || funcCode == WriteSingleRegister || funcCode == 0x08 || funcCode == 0x16):
+		direction = "request or echoed response"
+	case fitsRequest:
+		direction = "request"
+	case !fitsResponse:
+		direction = "request, length does not match function code"
+	}
+	d.add("Function", pdu[0:1], "0x%02X %s (%s)", funcCode, FuncCodeName(funcCode), direction)
+	r := &fieldReader{d: d, data: data}
+	if funcCode&0x80 != 0 {
+		if b, ok := r.take(1); ok {
+			d.add("Exception", b, "0x%02X %s", b[0], ExceptionName(b[0]))
+		}
+		r.rest("Extra data")
+		return
+	}
+	if d.Request {
+		r.request(funcCode)
+	} else {
+		r.response(funcCode)
+	}
+	r.rest("Extra data")
+}
+
+// 按顺序读取数据域中的字段
+type fieldReader struct {
+	d    *Description
+	data []byte
+}
+
+func (r *fieldReader) take(n int) ([]byte, bool) {
+	if len(r.data) < n {
+		return nil, false
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, true
+}
+
+func (r *fieldReader) uint16(name string) (uint16, bool) {
+	b, ok := r.take(2)
+	if !ok {
+		return 0, false
+	}
+	value := binary.BigEndian.Uint16(b)
+	r.d.add(name, b, "%d (0x%04X)", value, value)
+	return value, true
+}
+
+func (r *fieldReader) byteCount() (int, bool) {
+	b, ok := r.take(1)
+	if !ok {
+		return 0, false
+	}
+	if int(b[0]) == len(r.data) {
+		r.d.add("Byte count", b, "%d", b[0])
+	} else {
+		r.d.add("Byte count", b, "%d (mismatch, %d bytes follow)", b[0], len(r.data))
+	}
+	return int(b[0]), true
+}
+
+// 寄存器值，address为nil时按序号命名
+func (r *fieldReader) registers(address *uint16) {
+	for index := 0; len(r.data) >= 2; index++ {
+		name := fmt.Sprintf("Register[%d]", index)
+		if address != nil {
+			name = fmt.Sprintf("Register %d", int(*address)+index)
+		}
+		r.uint16(name)
+	}
+}
+
+// 线圈值，quantity为0时按字节数计算
+func (r *fieldReader) coils(count, quantity int) {
+	b, ok := r.take(min(count, len(r.data)))
+	if !ok || len(b) == 0 {
+		return
+	}
+	if quantity == 0 || quantity > len(b)*8 {
+		quantity = len(b) * 8
+	}
+	bits := make([]string, quantity)
+	for index := range bits {
+		bits[index] = "0"
+		if b[index/8]&(1<<(index%8)) != 0 {
+			bits[index] = "1"
+		}
+	}
+	r.d.add("Coils", b, "%s", strings.Join(bits, " "))
+}
+
+func (r *fieldReader) rest(name string) {
+	if len(r.data) > 0 {
+		r.d.add(name, r.data, "%d bytes", len(r.data))
+		r.data = nil
+	}
+}
+
+func (r *fieldReader) request(funcCode byte) {
+	switch funcCode {
+	case ReadCoils, ReadDiscreteInputs, ReadHoldingRegisters, ReadInputRegisters:
+		r.uint16("Address")
+		r.uint16("Quantity")
+	case WriteSingleCoil:
+		r.uint16("Address")
+		r.coilValue()
+	case WriteSingleRegister:
+		address, _ := r.uint16("Address")
+		r.registers(&address)
+	case WriteMultipleCoils:
+		r.uint16("Address")
+		quantity, _ := r.uint16("Quantity")
+		if count, ok := r.byteCount(); ok {
+			r.coils(count, int(quantity))
+		}
+	case WriteMultipleRegisters:
+		address, ok := r.uint16("Address")
+		r.uint16("Quantity")
+		if _, counted := r.byteCount(); ok && counted {
+			r.registers(&address)
+		}
+	case 0x16:
+		r.uint16("Address")
+		r.uint16("AND mask")
+		r.uint16("OR mask")
+	case 0x17:
+		r.uint16("Read address")
+		r.uint16("Read quantity")
+		address, ok := r.uint16("Write address")
+		r.uint16("Write quantity")
+		if _, counted := r.byteCount(); ok && counted {
+			r.registers(&address)
+		}
+	case 0x08:
+		r.uint16("Sub-function")
+		r.rest("Data")
+	case 0x18:
+		r.uint16("FIFO address")
+	case 0x2B:
+		if b, ok := r.take(1); ok {
+			r.d.add("MEI type", b, "0x%02X", b[0])
+		}
+		if b, ok := r.take(1); ok {
+			r.d.add("Read device ID", b, "%d", b[0])
+		}
+		if b, ok := r.take(1); ok {
+			r.d.add("Object ID", b, "%d", b[0])
+		}
+	}
+}
+
+func (r *fieldReader) response(funcCode byte) {
+	switch funcCode {
+	case ReadCoils, ReadDiscreteInputs:
+		if count, ok := r.byteCount(); ok {
+			r.coils(count, 0)
+		}
+	case ReadHoldingRegisters, ReadInputRegisters, 0x17:
+		if _, ok := r.byteCount(); ok {
+			r.registers(nil)
+		}
+	case WriteSingleCoil:
+		r.uint16("Address")
+		r.coilValue()
+	case WriteSingleRegister:
+		address, _ := r.uint16("Address")
+		r.registers(&address)
+	case WriteMultipleCoils, WriteMultipleRegisters:
+		r.uint16("Address")
+		r.uint16("Quantity")
+	case 0x16:
+		r.uint16("Address")
+		r.uint16("AND mask")
+		r.uint16("OR mask")
+	case ReportServerId, 0x0C, 0x14, 0x15:
+		if _, ok := r.byteCount(); ok {
+			r.rest("Data")
+		}
+	default:
+		r.rest("Data")
+	}
+}
+
+func (r *fieldReader) coilValue() {
+	b, ok := r.take(2)
+	if !ok {
+		return
+	}
+	switch binary.BigEndian.Uint16(b) {
+	case 0xFF00:
+		r.d.add("Value", b, "ON")
+	case 0x0000:
+		r.d.add("Value", b, "OFF")
+	default:
+		r.d.add("Value", b, "0x%04X (invalid, want 0xFF00 or 0x0000)", binary.BigEndian.Uint16(b))
+	}
+}
+
+// 以空格分隔的十六进制
+func spaced(b []byte) string {
+	s := hex.EncodeToString(b)
+	var sb strings.Builder
+	for index := 0; index < len(s); index += 2 {
+		if index > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(s[index : index+2])
+	}
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package statute
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	rtuResponse := BuildRTUFrame(1, []byte{0x03, 0x02, 0x00, 0x2A})
+	badCrc := append(rtuResponse[:len(rtuResponse)-1:len(rtuResponse)-1], rtuResponse[len(rtuResponse)-1]^0xFF)
+	asciiRequest := BuildASCIIFrame(1, []byte{0x06, 0x00, 0x0A, 0x00, 0x05})
+	//LRC两个十六进制字符位于\r\n之前
+	badLrc := bytes.Clone(asciiRequest)
+	badLrc[len(badLrc)-4] = '0'
+	badLrc[len(badLrc)-3] = '0'
+	tcpException := BuildTCPFrame(7, 1, []byte{0x83, 0x02})
+	tcpException[5]++
+	tests := []struct {
+		name    string
+		frame   []byte
+		kind    FrameKind
+		request bool
+		want    map[string]string //字段名到值的前缀
+	}{
+		{
+			name:    "tcp request",
+			frame:   BuildTCPFrame(7, 1, []byte{0x03, 0x00, 0x0A, 0x00, 0x02}),
+			kind:    FrameTCP,
+			request: true,
+			want:    map[string]string{"Transaction ID": "7", "Protocol ID": "0 (Modbus)", "Length": "6", "Unit ID": "1", "Address": "10", "Quantity": "2"},
+		},
+		{
+			name:  "tcp length mismatch",
+			frame: tcpException,
+			kind:  FrameTCP,
+			want:  map[string]string{"Length": "4 (mismatch, 3 bytes follow)", "Exception": "0x02"},
+		},
+		{
+			name:  "rtu response",
+			frame: rtuResponse,
+			kind:  FrameRTU,
+			want:  map[string]string{"Slave ID": "1", "Byte count": "2", "Register[0]": "42", "CRC": "valid"},
+		},
+		{
+			name:  "rtu bad crc",
+			frame: badCrc,
+			kind:  FrameRTU,
+			want:  map[string]string{"Register[0]": "42", "CRC": "invalid, expected " + spaced(rtuResponse[len(rtuResponse)-2:])},
+		},
+		{
+			name:    "ascii request",
+			frame:   asciiRequest,
+			kind:    FrameASCII,
+			request: true,
+			want:    map[string]string{"Slave ID": "1", "Address": "10", "Register 10": "5", "LRC": "valid"},
+		},
+		{
+			name:    "ascii bad lrc",
+			frame:   badLrc,
+			kind:    FrameASCII,
+			request: true,
+			want:    map[string]string{"Register 10": "5", "LRC": "invalid, expected"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			description, err := Describe(test.frame, test.kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if description.Request != test.request {
+				t.Fatalf("Request = %v, want %v", description.Request, test.request)
+			}
+			fields := make(map[string]string)
+			for _, field := range description.Fields {
+				fields[field.Name] = field.Value
+			}
+			for name, value := range test.want {
+				if got, ok := fields[name]; !ok || !strings.HasPrefix(got, value) {
+					t.Errorf("field %s = %q, want %q\n%s", name, got, value, description)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		kind  FrameKind
+	}{
+		{"tcp too short", []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x01}, FrameTCP},
+		{"rtu too short", []byte{0x01, 0x03, 0x00}, FrameRTU},
+		{"ascii without colon", []byte("0103000A0002F0\r\n"), FrameASCII},
+		{"ascii not hex", []byte(":01XX000A0002F0\r\n"), FrameASCII},
+		{"unknown kind", []byte{0x01, 0x03, 0x00, 0x00}, "can"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if description, err := Describe(test.frame, test.kind); err == nil {
+				t.Fatalf("Describe succeeded:\n%s", description)
+			}
+		})
+	}
+}
+
+func TestASCIIFrame(t *testing.T) {
+	frame := BuildASCIIFrame(1, []byte{0x03, 0x00, 0x0A, 0x00, 0x02})
+	if string(frame) != ":0103000A0002F0\r\n" {
+		t.Fatalf("frame = %q", frame)
+	}
+	data, err := DecodeASCIIFrame(frame)
+	if err != nil || !bytes.Equal(data, []byte{0x01, 0x03, 0x00, 0x0A, 0x00, 0x02, 0xF0}) {
+		t.Fatalf("DecodeASCIIFrame = % x %v", data, err)
+	}
+	frame[len(frame)-3] = '1'
+	data, err = DecodeASCIIFrame(frame)
+	if !errors.Is(err, LrcError) || data[len(data)-1] != 0xF1 {
+		t.Fatalf("DecodeASCIIFrame = % x %v, want %v", data, err, LrcError)
+	}
+}
@@ -1,23 +1,152 @@
 package statute
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 错误分类，解码和请求返回的错误可以用errors.Is判断属于哪一类
+var (
+	ErrTimeout             = errors.New("timeout")                  //读超时
+	ErrCRC                 = errors.New("crc error")                //RTU帧CRC校验错误
+	ErrLRC                 = errors.New("lrc error")                //ASCII帧LRC校验错误
+	ErrUnexpectedSlave     = errors.New("unexpected slave id")      //响应的从站id与请求不符
+	ErrUnexpectedFunction  = errors.New("unexpected function code") //响应的功能码与请求不符
+	ErrTransactionMismatch = errors.New("transaction id mismatch")  //响应的事务标识与请求不符
+	ErrShortFrame          = errors.New("short frame")              //报文不完整
+	ErrProtocolViolation   = errors.New("protocol violation")       //报文的长度、协议标识等不符合协议
+	ErrException           = errors.New("exception response")       //从站返回异常码，具体的异常码见下
+)
+
+// 异常码
+const (
+	ExceptionIllegalFunction        byte = 0x01 //非法功能码
+	ExceptionIllegalDataAddress     byte = 0x02 //非法数据地址
+	ExceptionIllegalDataValue       byte = 0x03 //非法数据值
+	ExceptionServerDeviceFailure    byte = 0x04 //从站设备故障
+	ExceptionAcknowledge            byte = 0x05 //已确认，正在处理
+	ExceptionServerDeviceBusy       byte = 0x06 //从站设备忙
+	ExceptionMemoryParityError      byte = 0x08 //存储奇偶校验错误
+	ExceptionGatewayPathUnavailable byte = 0x0A //网关路径不可用
+	ExceptionGatewayTargetFailed    byte = 0x0B //网关目标设备无响应
+)
+
+// 异常码对应的错误，从站返回的*ReturnedAbnormalFuncCode可以用errors.Is判断
+var (
+	ErrIllegalFunction        = &exceptionKind{code: ExceptionIllegalFunction}
+	ErrIllegalDataAddress     = &exceptionKind{code: ExceptionIllegalDataAddress}
+	ErrIllegalDataValue       = &exceptionKind{code: ExceptionIllegalDataValue}
+	ErrServerDeviceFailure    = &exceptionKind{code: ExceptionServerDeviceFailure}
+	ErrAcknowledge            = &exceptionKind{code: ExceptionAcknowledge}
+	ErrServerDeviceBusy       = &exceptionKind{code: ExceptionServerDeviceBusy}
+	ErrMemoryParityError      = &exceptionKind{code: ExceptionMemoryParityError}
+	ErrGatewayPathUnavailable = &exceptionKind{code: ExceptionGatewayPathUnavailable}
+	ErrGatewayTargetFailed    = &exceptionKind{code: ExceptionGatewayTargetFailed}
+)
+
+// CsError 校验错误，与ErrCRC相同
+var CsError = ErrCRC
+
+// 某个异常码
+type exceptionKind struct {
+	code byte
+}
+
+func (e *exceptionKind) Error() string {
+	return fmt.Sprintf("exception %s", ExceptionName(e.code))
+}
+
+// Is 同时属于ErrException
+func (e *exceptionKind) Is(target error) bool {
+	return target == ErrException
+}
+
+// RequestError 带有请求上下文的错误，ModbusPacket的请求出错时返回
+type RequestError struct {
+	SlaveId  byte
+	FuncCode byte
+	Address  int //起始地址，没有地址的请求为-1
+	Err      error
+}
+
+func (r *RequestError) Error() string {
+	if r.Address < 0 {
+		return fmt.Sprintf("slave %d %s: %v", r.SlaveId, FuncCodeName(r.FuncCode), r.Err)
+	}
+	return fmt.Sprintf("slave %d %s address %d: %v", r.SlaveId, FuncCodeName(r.FuncCode), r.Address, r.Err)
+}
+
+func (r *RequestError) Unwrap() error {
+	return r.Err
+}
+
+// 报文在中途结束时归为ErrShortFrame，同时保留原始错误
+func shortFrame(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrShortFrame, err)
+	}
+	return err
+}
 
 // 返回了一个错误功能码
-func newReturnedAbnormalFuncCode(funcCode byte) *ReturnedAbnormalFuncCode {
-	return &ReturnedAbnormalFuncCode{funcCode: funcCode}
+func newReturnedAbnormalFuncCode(funcCode, exceptionCode byte) *ReturnedAbnormalFuncCode {
+	return &ReturnedAbnormalFuncCode{funcCode: funcCode, exceptionCode: exceptionCode}
+}
+
+// NewExceptionError 创建一个从站返回异常的错误，可用于模拟从站
+// funcCode 请求的功能码
+// exceptionCode 异常码
+func NewExceptionError(funcCode, exceptionCode byte) *ReturnedAbnormalFuncCode {
+	return newReturnedAbnormalFuncCode(funcCode|0x80, exceptionCode)
 }
 
 var _ error = (*ReturnedAbnormalFuncCode)(nil)
 
 // ReturnedAbnormalFuncCode 返回了一个错误功能码
 type ReturnedAbnormalFuncCode struct {
-	funcCode byte
+	funcCode      byte
+	exceptionCode byte //异常码
 }
 
 func (r *ReturnedAbnormalFuncCode) Error() string {
-	return fmt.Sprintf("returned abnormal function code:%d", r.funcCode)
+	return fmt.Sprintf("returned abnormal function code:%d, exception code:%d", r.funcCode, r.exceptionCode)
+}
+
+// Is 属于ErrException及异常码对应的错误
+func (r *ReturnedAbnormalFuncCode) Is(target error) bool {
+	if target == ErrException {
+		return true
+	}
+	kind, ok := target.(*exceptionKind)
+	return ok && kind.code == r.exceptionCode
 }
 
 func (r *ReturnedAbnormalFuncCode) GetFuncCode() byte {
 	return r.funcCode
 }
+
+// GetExceptionCode 获取异常码
+func (r *ReturnedAbnormalFuncCode) GetExceptionCode() byte {
+	return r.exceptionCode
+}
+
+var exceptionNames = map[byte]string{
+	ExceptionIllegalFunction:        "IllegalFunction",
+	ExceptionIllegalDataAddress:     "IllegalDataAddress",
+	ExceptionIllegalDataValue:       "IllegalDataValue",
+	ExceptionServerDeviceFailure:    "ServerDeviceFailure",
+	ExceptionAcknowledge:            "Acknowledge",
+	ExceptionServerDeviceBusy:       "ServerDeviceBusy",
+	ExceptionMemoryParityError:      "MemoryParityError",
+	ExceptionGatewayPathUnavailable: "GatewayPathUnavailable",
+	ExceptionGatewayTargetFailed:    "GatewayTargetDeviceFailedToRespond",
+}
+
+// ExceptionName 返回异常码的名称
+func ExceptionName(exceptionCode byte) string {
+	if name, ok := exceptionNames[exceptionCode]; ok {
+		return name
+	}
+	return "Unknown"
+}
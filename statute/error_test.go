@@ -0,0 +1,184 @@
+package statute
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExceptionSentinels(t *testing.T) {
+	err := error(NewExceptionError(ReadHoldingRegisters, 0x02))
+	if !errors.Is(err, ErrException) || !errors.Is(err, ErrIllegalDataAddress) {
+		t.Fatalf("%v is not an illegal data address exception", err)
+	}
+	if errors.Is(err, ErrIllegalFunction) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("%v matched another category", err)
+	}
+	//异常码对应的错误本身也属于ErrException
+	if !errors.Is(ErrGatewayTargetFailed, ErrException) || errors.Is(ErrException, ErrGatewayTargetFailed) {
+		t.Fatal("exception kinds are not part of ErrException")
+	}
+	if CsError != ErrCRC || LrcError != ErrLRC {
+		t.Fatal("CsError and LrcError must stay aliases of ErrCRC and ErrLRC")
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	err := error(&RequestError{SlaveId: 3, FuncCode: ReadHoldingRegisters, Address: 100, Err: NewExceptionError(ReadHoldingRegisters, 0x02)})
+	if !strings.HasPrefix(err.Error(), "slave 3 ReadHoldingRegisters address 100: ") {
+		t.Fatalf("Error() = %q", err)
+	}
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Fatal("RequestError does not unwrap to the exception")
+	}
+	var abnormal *ReturnedAbnormalFuncCode
+	if !errors.As(err, &abnormal) || abnormal.GetExceptionCode() != 0x02 {
+		t.Fatalf("errors.As = %v", abnormal)
+	}
+	noAddress := &RequestError{SlaveId: 1, FuncCode: ReportServerId, Address: -1, Err: ErrTimeout}
+	if noAddress.Error() != "slave 1 ReportServerId: timeout" {
+		t.Fatalf("Error() = %q", noAddress)
+	}
+}
+
+func TestDecodeSentinels(t *testing.T) {
+	tcpFrame := func(transactionId uint16, slaveId byte, pdu []byte) []byte {
+		return BuildTCPFrame(transactionId, slaveId, pdu)
+	}
+	tests := []struct {
+		name     string
+		rtu      bool
+		response func(request []byte) []byte
+		want     error
+	}{
+		{
+			name:     "tcp transaction mismatch",
+			response: func(request []byte) []byte { return tcpFrame(0xFFFF, 1, []byte{0x03, 0x02, 0x00, 0x2A}) },
+			want:     ErrTransactionMismatch,
+		},
+		{
+			name: "tcp protocol identifier 00 01",
+			response: func(request []byte) []byte {
+				frame := tcpFrame(1, 1, []byte{0x03, 0x02, 0x00, 0x2A})
+				frame[0], frame[1], frame[2], frame[3] = request[0], request[1], 0x00, 0x01
+				return frame
+			},
+			want: ErrProtocolViolation,
+		},
+		{
+			name: "tcp protocol identifier 01 00",
+			response: func(request []byte) []byte {
+				frame := tcpFrame(1, 1, []byte{0x03, 0x02, 0x00, 0x2A})
+				frame[0], frame[1], frame[2], frame[3] = request[0], request[1], 0x01, 0x00
+				return frame
+			},
+			want: ErrProtocolViolation,
+		},
+		{
+			name: "tcp protocol identifier 01 01",
+			response: func(request []byte) []byte {
+				frame := tcpFrame(1, 1, []byte{0x03, 0x02, 0x00, 0x2A})
+				frame[0], frame[1], frame[2], frame[3] = request[0], request[1], 0x01, 0x01
+				return frame
+			},
+			want: ErrProtocolViolation,
+		},
+		{
+			name: "tcp length too small",
+			response: func(request []byte) []byte {
+				return []byte{request[0], request[1], 0x00, 0x00, 0x00, 0x01, 0x01, 0x03}
+			},
+			want: ErrProtocolViolation,
+		},
+		{
+			name: "tcp unexpected slave",
+			response: func(request []byte) []byte {
+				return append(request[:2:2], tcpFrame(0, 2, []byte{0x03, 0x02, 0x00, 0x2A})[2:]...)
+			},
+			want: ErrUnexpectedSlave,
+		},
+		{
+			name: "tcp unexpected function",
+			response: func(request []byte) []byte {
+				return append(request[:2:2], tcpFrame(0, 1, []byte{0x04, 0x02, 0x00, 0x2A})[2:]...)
+			},
+			want: ErrUnexpectedFunction,
+		},
+		{
+			name: "tcp byte count",
+			response: func(request []byte) []byte {
+				return append(request[:2:2], tcpFrame(0, 1, []byte{0x03, 0x04, 0x00, 0x2A})[2:]...)
+			},
+			want: ErrProtocolViolation,
+		},
+		{
+			name: "tcp short frame",
+			response: func(request []byte) []byte {
+				frame := append(request[:2:2], tcpFrame(0, 1, []byte{0x03, 0x02, 0x00, 0x2A})[2:]...)
+				return frame[:len(frame)-1]
+			},
+			want: ErrShortFrame,
+		},
+		{
+			name: "tcp exception",
+			response: func(request []byte) []byte {
+				return append(request[:2:2], tcpFrame(0, 1, []byte{0x83, 0x02})[2:]...)
+			},
+			want: ErrIllegalDataAddress,
+		},
+		{
+			name: "rtu crc",
+			rtu:  true,
+			response: func([]byte) []byte {
+				frame := BuildRTUFrame(1, []byte{0x03, 0x02, 0x00, 0x2A})
+				frame[len(frame)-1] ^= 0xFF
+				return frame
+			},
+			want: ErrCRC,
+		},
+		{
+			name:     "rtu unexpected slave",
+			rtu:      true,
+			response: func([]byte) []byte { return BuildRTUFrame(2, []byte{0x03, 0x02, 0x00, 0x2A}) },
+			want:     ErrUnexpectedSlave,
+		},
+		{
+			name:     "rtu unexpected function",
+			rtu:      true,
+			response: func([]byte) []byte { return BuildRTUFrame(1, []byte{0x04, 0x02, 0x00, 0x2A}) },
+			want:     ErrUnexpectedFunction,
+		},
+		{
+			name:     "rtu short frame",
+			rtu:      true,
+			response: func([]byte) []byte { return BuildRTUFrame(1, []byte{0x03, 0x02, 0x00, 0x2A})[:4] },
+			want:     ErrShortFrame,
+		},
+		{
+			name:     "rtu exception",
+			rtu:      true,
+			response: func([]byte) []byte { return BuildRTUFrame(1, []byte{0x83, 0x04}) },
+			want:     ErrServerDeviceFailure,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var codec ModbusCodec = NewModbusTCPCodec()
+			if test.rtu {
+				codec = NewModbusRTUCodec()
+			}
+			request := codec.BuildReadHoldingRegisters(1, 0, 1)
+			data, err := codec.Decode(bufio.NewReader(bytes.NewReader(test.response(request))))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Decode = % x %v, want %v", data, err, test.want)
+			}
+			//报文中途结束时保留原始的io错误
+			if test.want == ErrShortFrame && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+				t.Fatalf("short frame error %v lost the io error", err)
+			}
+		})
+	}
+}
@@ -7,9 +7,9 @@ var mrFuncCodes []byte
 var errFuncCodes []byte
 
 func init() {
-	mrFuncCodes = []byte{ReadCoils, ReadDiscreteInputs, ReadHoldingRegisters, ReadInputRegisters, WriteSingleCoil, WriteSingleRegister, WriteMultipleCoils, WriteMultipleRegisters}
+	mrFuncCodes = []byte{ReadCoils, ReadDiscreteInputs, ReadHoldingRegisters, ReadInputRegisters, WriteSingleCoil, WriteSingleRegister, WriteMultipleCoils, WriteMultipleRegisters, ReportServerId}
 
-	errFuncCodes = []byte{ReadCoils + 0x80, ReadDiscreteInputs + 0x80, ReadHoldingRegisters + 0x80, ReadInputRegisters + 0x80, WriteSingleCoil + 0x80, WriteSingleRegister + 0x80, WriteMultipleCoils + 0x80, WriteMultipleRegisters + 0x80}
+	errFuncCodes = []byte{ReadCoils + 0x80, ReadDiscreteInputs + 0x80, ReadHoldingRegisters + 0x80, ReadInputRegisters + 0x80, WriteSingleCoil + 0x80, WriteSingleRegister + 0x80, WriteMultipleCoils + 0x80, WriteMultipleRegisters + 0x80, ReportServerId + 0x80}
 }
 
 const (
@@ -21,8 +21,43 @@ const (
 	WriteSingleRegister    byte = 0x06 //写单个保持寄存器,整型、浮点型、字符型,把具体二进制值装入一个保持寄存器
 	WriteMultipleCoils     byte = 0x0F //写多个线圈寄存器,位,强置一串连续逻辑线圈的通断
 	WriteMultipleRegisters byte = 0x10 //写多个保持寄存器,整型、浮点型、字符型,把具体的二进制值装入一串连续的保持寄存器
+	ReportServerId         byte = 0x11 //报告从站id,仅串行链路,取得从站的类型、运行状态等设备相关信息
 )
 
+// FuncCodeName 获取功能码名称，异常功能码会带上Exception后缀
+func FuncCodeName(funcCode byte) string {
+	name, ok := funcCodeNames[funcCode&0x7F]
+	if !ok {
+		name = "Unknown"
+	}
+	if funcCode&0x80 != 0 {
+		return name + "Exception"
+	}
+	return name
+}
+
+var funcCodeNames = map[byte]string{
+	ReadCoils:              "ReadCoils",
+	ReadDiscreteInputs:     "ReadDiscreteInputs",
+	ReadHoldingRegisters:   "ReadHoldingRegisters",
+	ReadInputRegisters:     "ReadInputRegisters",
+	WriteSingleCoil:        "WriteSingleCoil",
+	WriteSingleRegister:    "WriteSingleRegister",
+	WriteMultipleCoils:     "WriteMultipleCoils",
+	WriteMultipleRegisters: "WriteMultipleRegisters",
+	ReportServerId:         "ReportServerId",
+	0x07:                   "ReadExceptionStatus",
+	0x08:                   "Diagnostics",
+	0x0B:                   "GetCommEventCounter",
+	0x0C:                   "GetCommEventLog",
+	0x14:                   "ReadFileRecord",
+	0x15:                   "WriteFileRecord",
+	0x16:                   "MaskWriteRegister",
+	0x17:                   "ReadWriteMultipleRegisters",
+	0x18:                   "ReadFIFOQueue",
+	0x2B:                   "EncapsulatedInterfaceTransport",
+}
+
 // modbusFrameBuilder RTU报文构造器
 type modbusFrameBuilder struct {
 }
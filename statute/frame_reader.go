@@ -0,0 +1,253 @@
+package statute
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	tcpHeaderLength = 6   //事务标识+协议标识+长度
+	maxPduLength    = 253 //PDU最大长度
+)
+
+// FrameKind 报文的帧格式
+type FrameKind string
+
+const (
+	FrameTCP   FrameKind = "tcp"   //MBAP头
+	FrameRTU   FrameKind = "rtu"   //从站id+PDU+CRC
+	FrameASCII FrameKind = "ascii" //':'+十六进制(从站id+PDU+LRC)+CRLF
+)
+
+// 数据域长度规则：数据域长度 = fixed + 计数字段的值
+// countSize为0时表示定长
+type lengthRule struct {
+	fixed       int //定长部分
+	countOffset int //计数字段在数据域中的偏移
+	countSize   int //计数字段的字节数
+}
+
+// 请求数据域长度规则
+var requestRules = map[byte]lengthRule{
+	ReadCoils:              {fixed: 4},
+	ReadDiscreteInputs:     {fixed: 4},
+	ReadHoldingRegisters:   {fixed: 4},
+	ReadInputRegisters:     {fixed: 4},
+	WriteSingleCoil:        {fixed: 4},
+	WriteSingleRegister:    {fixed: 4},
+	0x07:                   {fixed: 0}, //读异常状态
+	0x08:                   {fixed: 4}, //诊断
+	0x0B:                   {fixed: 0}, //读通信事件计数
+	0x0C:                   {fixed: 0}, //读通信事件记录
+	WriteMultipleCoils:     {fixed: 5, countOffset: 4, countSize: 1},
+	WriteMultipleRegisters: {fixed: 5, countOffset: 4, countSize: 1},
+	0x11:                   {fixed: 0},                               //报告从站id
+	0x14:                   {fixed: 1, countOffset: 0, countSize: 1}, //读文件记录
+	0x15:                   {fixed: 1, countOffset: 0, countSize: 1}, //写文件记录
+	0x16:                   {fixed: 6},                               //屏蔽写寄存器
+	0x17:                   {fixed: 9, countOffset: 8, countSize: 1}, //读写多个寄存器
+	0x18:                   {fixed: 2},                               //读FIFO队列
+	0x2B:                   {fixed: 3},                               //读设备标识
+}
+
+// 响应数据域长度规则
+var responseRules = map[byte]lengthRule{
+	ReadCoils:              {fixed: 1, countOffset: 0, countSize: 1},
+	ReadDiscreteInputs:     {fixed: 1, countOffset: 0, countSize: 1},
+	ReadHoldingRegisters:   {fixed: 1, countOffset: 0, countSize: 1},
+	ReadInputRegisters:     {fixed: 1, countOffset: 0, countSize: 1},
+	WriteSingleCoil:        {fixed: 4},
+	WriteSingleRegister:    {fixed: 4},
+	0x07:                   {fixed: 1},
+	0x08:                   {fixed: 4},
+	0x0B:                   {fixed: 4},
+	0x0C:                   {fixed: 1, countOffset: 0, countSize: 1},
+	WriteMultipleCoils:     {fixed: 4},
+	WriteMultipleRegisters: {fixed: 4},
+	0x11:                   {fixed: 1, countOffset: 0, countSize: 1},
+	0x14:                   {fixed: 1, countOffset: 0, countSize: 1},
+	0x15:                   {fixed: 1, countOffset: 0, countSize: 1},
+	0x16:                   {fixed: 6},
+	0x17:                   {fixed: 1, countOffset: 0, countSize: 1},
+	0x18:                   {fixed: 2, countOffset: 0, countSize: 2},
+}
+
+// Crc16 计算RTU报文的CRC，结果为低字节在前
+func Crc16(frame []byte) []byte {
+	crc := uint16(0xFFFF)
+	for _, b := range frame {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if (crc & 0x0001) != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc = crc >> 1
+			}
+		}
+	}
+	return []byte{byte(crc & 0xFF), byte(crc >> 8)}
+}
+
+// BuildTCPFrame 生成一条Modbus TCP报文
+// transactionId 事务标识
+// slaveId 单元id
+// pdu 功能码及数据域
+func BuildTCPFrame(transactionId uint16, slaveId byte, pdu []byte) []byte {
+	frame := make([]byte, tcpHeaderLength+1, tcpHeaderLength+1+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:2], transactionId)
+	binary.BigEndian.PutUint16(frame[4:6], uint16(len(pdu)+1))
+	frame[6] = slaveId
+	return append(frame, pdu...)
+}
+
+// BuildRTUFrame 生成一条RTU报文
+// slaveId 从站id
+// pdu 功能码及数据域
+func BuildRTUFrame(slaveId byte, pdu []byte) []byte {
+	frame := append([]byte{slaveId}, pdu...)
+	return append(frame, Crc16(frame)...)
+}
+
+// SupportedFuncCode 是否能按长度规则读取该功能码的响应
+func SupportedFuncCode(funcCode byte) bool {
+	_, ok := responseRules[funcCode]
+	return ok || funcCode == 0x2B
+}
+
+// ReadRequest 按帧格式从流中读取一帧请求
+func ReadRequest(r io.Reader, kind FrameKind) ([]byte, error) {
+	switch kind {
+	case FrameRTU:
+		return ReadRTURequest(r)
+	case FrameASCII:
+		return ReadASCIIFrame(r)
+	}
+	return ReadTCPFrame(r)
+}
+
+// ReadResponse 按帧格式从流中读取一帧响应
+func ReadResponse(r io.Reader, kind FrameKind) ([]byte, error) {
+	switch kind {
+	case FrameRTU:
+		return ReadRTUResponse(r)
+	case FrameASCII:
+		return ReadASCIIFrame(r)
+	}
+	return ReadTCPFrame(r)
+}
+
+// ReadTCPFrame 按MBAP头中的长度从流中读取一帧完整的Modbus TCP报文
+func ReadTCPFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, tcpHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[4:6]))
+	if length < 2 || length > maxPduLength+1 {
+		return nil, fmt.Errorf("%w: invalid length", ErrProtocolViolation)
+	}
+	frame := make([]byte, tcpHeaderLength+length)
+	copy(frame, header)
+	if _, err := io.ReadFull(r, frame[tcpHeaderLength:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// ReadRTURequest 按功能码的长度规则从流中读取一帧RTU请求，并校验CRC
+func ReadRTURequest(r io.Reader) ([]byte, error) {
+	return readRTUFrame(r, true)
+}
+
+// ReadRTUResponse 按功能码的长度规则从流中读取一帧RTU响应，并校验CRC
+func ReadRTUResponse(r io.Reader) ([]byte, error) {
+	return readRTUFrame(r, false)
+}
+
+func readRTUFrame(r io.Reader, request bool) ([]byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	data, err := readPduData(r, head[1], request)
+	if err != nil {
+		return nil, err
+	}
+	frame := append(head, data...)
+	cs := make([]byte, 2)
+	if _, err = io.ReadFull(r, cs); err != nil {
+		return nil, err
+	}
+	frame = append(frame, cs...)
+	if check := Crc16(frame[:len(frame)-2]); check[0] != cs[0] || check[1] != cs[1] {
+		return frame, CsError
+	}
+	return frame, nil
+}
+
+// 按长度规则读取功能码之后的数据域
+func readPduData(r io.Reader, funcCode byte, request bool) ([]byte, error) {
+	if funcCode&0x80 != 0 {
+		//异常响应只有1字节异常码
+		data := make([]byte, 1)
+		_, err := io.ReadFull(r, data)
+		return data, err
+	}
+	if funcCode == 0x2B && !request {
+		return readDeviceIdentification(r)
+	}
+	rules := responseRules
+	if request {
+		rules = requestRules
+	}
+	rule, ok := rules[funcCode]
+	if !ok {
+		return nil, fmt.Errorf("%w: error function code:%d", ErrProtocolViolation, funcCode)
+	}
+	if rule.countSize == 0 {
+		data := make([]byte, rule.fixed)
+		_, err := io.ReadFull(r, data)
+		return data, err
+	}
+	head := make([]byte, rule.countOffset+rule.countSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	count := int(head[rule.countOffset])
+	if rule.countSize == 2 {
+		count = int(binary.BigEndian.Uint16(head[rule.countOffset:]))
+	}
+	length := rule.fixed + count
+	if length > maxPduLength-1 {
+		return nil, fmt.Errorf("%w: invalid length", ErrProtocolViolation)
+	}
+	data := make([]byte, length)
+	copy(data, head)
+	_, err := io.ReadFull(r, data[len(head):])
+	return data, err
+}
+
+// 读设备标识(0x2B/0x0E)响应的数据域
+func readDeviceIdentification(r io.Reader) ([]byte, error) {
+	//MEI类型、读设备标识码、一致性等级、后续标志、下一个对象id、对象数量
+	data := make([]byte, 6)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	for index := 0; index < int(data[5]); index++ {
+		object := make([]byte, 2)
+		if _, err := io.ReadFull(r, object); err != nil {
+			return nil, err
+		}
+		value := make([]byte, object[1])
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		data = append(append(data, object...), value...)
+		if len(data) > maxPduLength-1 {
+			return nil, fmt.Errorf("%w: invalid length", ErrProtocolViolation)
+		}
+	}
+	return data, nil
+}
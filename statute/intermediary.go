@@ -2,8 +2,8 @@ package statute
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
+	"io"
 )
 
 type CoilStatus bool
@@ -17,19 +17,43 @@ const (
 type intermediary struct {
 	ident    uint16 //唯一标识
 	slaveId  byte
-	funcCode byte //功能码
+	funcCode byte   //功能码
+	raw      []byte //最近一次解码读取到的原始报文
+	custom   bool   //是否为自定义请求
 }
 
 func (i *intermediary) ObtainIntermediary() *intermediary {
 	return i
 }
 
+// ObtainRawResponse 获取最近一次解码时读取到的原始报文，解码失败时为已读取的部分
+func (i *intermediary) ObtainRawResponse() []byte {
+	return i.raw
+}
+
+// 记录解码过程中读取的字节
+func (i *intermediary) record(r io.Reader) io.Reader {
+	i.raw = nil
+	return &recordReader{reader: r, intermediary: i}
+}
+
+type recordReader struct {
+	reader       io.Reader
+	intermediary *intermediary
+}
+
+func (r *recordReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.intermediary.raw = append(r.intermediary.raw, p[:n]...)
+	return n, err
+}
+
 func (i *intermediary) data4ParseRequest(funcCode byte, data []byte) (addr, number uint16, err error) {
 	if i.funcCode != funcCode {
-		return 0, 0, errors.New("funcCode mismatch")
+		return 0, 0, fmt.Errorf("%w: funcCode mismatch", ErrUnexpectedFunction)
 	}
 	if len(data) != 4 {
-		return 0, 0, errors.New("invalid data length")
+		return 0, 0, fmt.Errorf("%w: invalid data length", ErrProtocolViolation)
 	}
 	addr = binary.BigEndian.Uint16(data[:2])
 	number = binary.BigEndian.Uint16(data[2:4])
@@ -38,17 +62,17 @@ func (i *intermediary) data4ParseRequest(funcCode byte, data []byte) (addr, numb
 
 func (i *intermediary) data4ParseResponse(funcCode byte, result []byte) (length byte, data []byte, err error) {
 	if i.funcCode != funcCode {
-		return 0, nil, errors.New("funcCode mismatch")
+		return 0, nil, fmt.Errorf("%w: funcCode mismatch", ErrUnexpectedFunction)
 	}
 	if len(result) == 0 {
-		return 0, nil, errors.New("invalid data length")
+		return 0, nil, fmt.Errorf("%w: invalid data length", ErrProtocolViolation)
 	}
 	return data[0], data[1:], nil
 }
 
 func (i *intermediary) parseCoilsResponse(bytes []byte, number uint16) (length uint16, result []CoilStatus, err error) {
 	if bytes == nil || len(bytes) == 0 {
-		return 0, nil, errors.New("invalid response, response is empty")
+		return 0, nil, fmt.Errorf("%w: response is empty", ErrShortFrame)
 	}
 	var strResult []string
 	for _, b := range bytes {
@@ -61,7 +85,7 @@ func (i *intermediary) parseCoilsResponse(bytes []byte, number uint16) (length u
 		strResult = append(strResult, bs...)
 	}
 	if uint16(len(strResult)) < number {
-		return 0, nil, errors.New("invalid response, response is error")
+		return 0, nil, fmt.Errorf("%w: fewer coils than requested", ErrProtocolViolation)
 	}
 	result = make([]CoilStatus, number)
 	for index := uint16(0); index < number; index++ {
@@ -148,17 +172,17 @@ func (i *intermediary) ParseWriteSingleRegister(data []byte) (addr, status uint1
 // result 数据
 func (i *intermediary) ParseWriteMultipleCoilsRequest(data []byte) (addr, number uint16, length byte, result []byte, err error) {
 	if i.funcCode != WriteMultipleCoils {
-		return 0, 0, 0, nil, errors.New("funcCode mismatch")
+		return 0, 0, 0, nil, fmt.Errorf("%w: funcCode mismatch", ErrUnexpectedFunction)
 	}
 	if len(data) < 6 {
-		return 0, 0, 0, nil, errors.New("invalid data length")
+		return 0, 0, 0, nil, fmt.Errorf("%w: invalid data length", ErrProtocolViolation)
 	}
 	addr = binary.BigEndian.Uint16(data[:2])
 	number = binary.BigEndian.Uint16(data[2:4])
 	length = data[4]
 	data = data[5:]
 	if len(data) != int(length) {
-		return 0, 0, 0, nil, errors.New("invalid data length")
+		return 0, 0, 0, nil, fmt.Errorf("%w: invalid data length", ErrProtocolViolation)
 	}
 	return
 }
@@ -169,10 +193,10 @@ func (i *intermediary) ParseWriteMultipleCoilsRequest(data []byte) (addr, number
 // length 字节数
 func (i *intermediary) ParseWriteMultipleCoilsResponse(data []byte) (addr, number uint16, err error) {
 	if i.funcCode != WriteMultipleCoils {
-		return 0, 0, errors.New("funcCode mismatch")
+		return 0, 0, fmt.Errorf("%w: funcCode mismatch", ErrUnexpectedFunction)
 	}
 	if len(data) < 4 {
-		return 0, 0, errors.New("invalid data length")
+		return 0, 0, fmt.Errorf("%w: invalid data length", ErrProtocolViolation)
 	}
 	addr = binary.BigEndian.Uint16(data[:2])
 	number = binary.BigEndian.Uint16(data[2:4])
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"slices"
 )
 
@@ -22,27 +23,23 @@ type ModbusRTUCodec struct {
 }
 
 func (m *ModbusRTUCodec) cs(frame []byte) []byte {
-	crc := uint16(0xFFFF)
-	for _, b := range frame {
-		crc ^= uint16(b)
-		for i := 0; i < 8; i++ {
-			if (crc & 0x0001) != 0 {
-				crc = (crc >> 1) ^ 0xA001
-			} else {
-				crc = crc >> 1
-			}
-		}
-	}
-	return []byte{byte(crc & 0xFF), byte(crc >> 8)}
+	return Crc16(frame)
 }
 
 // 生成一条完整的报文
 func (m *ModbusRTUCodec) buildFrame(slaveId byte, funcCode byte, data []byte) []byte {
-	m.slaveId, m.funcCode = slaveId, funcCode
-	encode := []byte{slaveId, funcCode}
-	encode = append(encode, data...)
-	cs := m.cs(encode)
-	return append(encode, cs...)
+	m.slaveId, m.funcCode, m.raw, m.custom = slaveId, funcCode, nil, false
+	return BuildRTUFrame(slaveId, append([]byte{funcCode}, data...))
+}
+
+// BuildCustom 自定义请求
+// slaveId 从站id
+// funcCode 功能码
+// data 功能码之后的数据域
+func (m *ModbusRTUCodec) BuildCustom(slaveId byte, funcCode byte, data []byte) []byte {
+	frame := m.buildFrame(slaveId, funcCode, data)
+	m.custom = true
+	return frame
 }
 
 // BuildReadCoils 读线圈
@@ -120,58 +117,84 @@ func (m *ModbusRTUCodec) BuildWriteMultipleRegisters(slaveId byte, address uint1
 	return m.buildFrame(slaveId, WriteMultipleRegisters, data), nil
 }
 
+// BuildReportServerId 报告从站id
+// slaveId 从站id
+func (m *ModbusRTUCodec) BuildReportServerId(slaveId byte) []byte {
+	return m.buildFrame(slaveId, ReportServerId, nil)
+}
+
 // Decode 解码
 // result 结果数据集
 // error 解码错误
 func (m *ModbusRTUCodec) Decode(buf *bufio.Reader) ([]byte, error) {
+	r := m.record(buf)
 	var slaveId byte
-	if err := binary.Read(buf, binary.BigEndian, &slaveId); err != nil {
+	if err := binary.Read(r, binary.BigEndian, &slaveId); err != nil {
 		return nil, err
 	}
 	if slaveId != m.slaveId {
-		return nil, errors.New("invaild slave id")
+		return nil, fmt.Errorf("%w: got %d, want %d", ErrUnexpectedSlave, slaveId, m.slaveId)
 	}
 	var funcCode byte
-	if err := binary.Read(buf, binary.BigEndian, &funcCode); err != nil {
-		return nil, err
+	if err := binary.Read(r, binary.BigEndian, &funcCode); err != nil {
+		return nil, shortFrame(err)
 	}
 	if funcCode != m.funcCode {
-		if slices.Contains(errFuncCodes, m.funcCode) {
-			return nil, newReturnedAbnormalFuncCode(funcCode)
+		if funcCode == m.funcCode+0x80 && (m.custom || slices.Contains(errFuncCodes, funcCode)) {
+			//异常响应：异常码 + 校验
+			var exceptionCode byte
+			if err := binary.Read(r, binary.BigEndian, &exceptionCode); err != nil {
+				return nil, shortFrame(err)
+			}
+			if err := m.checkCs(funcCode, []byte{exceptionCode}, r); err != nil {
+				return nil, err
+			}
+			return nil, newReturnedAbnormalFuncCode(funcCode, exceptionCode)
+		}
+		return nil, fmt.Errorf("%w: got 0x%02X, want 0x%02X", ErrUnexpectedFunction, funcCode, m.funcCode)
+	}
+	if m.custom {
+		//自定义请求按功能码的长度规则读取，返回功能码之后的全部数据
+		data, err := readPduData(r, funcCode, false)
+		if err != nil {
+			return nil, shortFrame(err)
+		}
+		if err = m.checkCs(funcCode, data, r); err != nil {
+			return nil, err
 		}
-		return nil, errors.New("invaild function code")
+		return data, nil
 	}
 	var data []byte
 	var result []byte
 	if slices.Contains(mrFuncCodes, m.funcCode) {
-		if m.funcCode == ReadCoils || m.funcCode == ReadDiscreteInputs || m.funcCode == ReadHoldingRegisters || m.funcCode == ReadInputRegisters {
+		if m.funcCode == ReadCoils || m.funcCode == ReadDiscreteInputs || m.funcCode == ReadHoldingRegisters || m.funcCode == ReadInputRegisters || m.funcCode == ReportServerId {
 			//读线圈
 			var length byte
-			if err := binary.Read(buf, binary.LittleEndian, &length); err != nil {
-				return nil, err
+			if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+				return nil, shortFrame(err)
 			}
 			if length < 0 {
-				return nil, errors.New("invalid length")
+				return nil, fmt.Errorf("%w: invalid length %d", ErrProtocolViolation, length)
 			}
 			result = make([]byte, length)
-			if err := binary.Read(buf, binary.LittleEndian, &result); err != nil {
-				return nil, err
+			if err := binary.Read(r, binary.LittleEndian, &result); err != nil {
+				return nil, shortFrame(err)
 			}
 			data = append([]byte{length}, result...)
 		} else if m.funcCode == WriteSingleCoil || m.funcCode == WriteSingleRegister || m.funcCode == WriteMultipleRegisters {
 			result = make([]byte, 4)
-			if err := binary.Read(buf, binary.LittleEndian, &result); err != nil {
-				return nil, err
+			if err := binary.Read(r, binary.LittleEndian, &result); err != nil {
+				return nil, shortFrame(err)
 			}
 			data = result
 		} else {
 			result = make([]byte, 4)
-			if err := binary.Read(buf, binary.LittleEndian, &result); err != nil {
-				return nil, err
+			if err := binary.Read(r, binary.LittleEndian, &result); err != nil {
+				return nil, shortFrame(err)
 			}
 			data = result
 		}
-		if err := m.checkCs(data, buf); err != nil {
+		if err := m.checkCs(m.funcCode, data, r); err != nil {
 			return nil, err
 		}
 		return result, nil
@@ -180,15 +203,15 @@ func (m *ModbusRTUCodec) Decode(buf *bufio.Reader) ([]byte, error) {
 
 }
 
-func (m *ModbusRTUCodec) checkCs(result []byte, buf *bufio.Reader) error {
-	data := append([]byte{m.slaveId, m.funcCode}, result...)
+func (m *ModbusRTUCodec) checkCs(funcCode byte, result []byte, buf io.Reader) error {
+	data := append([]byte{m.slaveId, funcCode}, result...)
 	cs := make([]byte, 2)
 	if err := binary.Read(buf, binary.BigEndian, &cs); err != nil {
-		return err
+		return shortFrame(err)
 	}
 	checkCs := m.cs(data)
 	if checkCs[0] != cs[0] || checkCs[1] != cs[1] {
-		return errors.New("cs error")
+		return fmt.Errorf("%w: got %x, want %x", CsError, cs, checkCs)
 	}
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"slices"
 	"sync"
 )
@@ -39,12 +40,19 @@ func (m *ModbusTCPCodec) identifier() uint16 {
 // 生成一条完整的报文
 func (m *ModbusTCPCodec) buildFrame(slaveId byte, funcCode byte, data []byte) []byte {
 	frameId := m.identifier()
-	encode := []byte{byte(frameId >> 8), byte(frameId), 0x00, 0x00}
-	data1 := append([]byte{slaveId, funcCode}, data...)
-	encode = append(encode, byte(len(data1)>>8), byte(len(data1)))
 	//保存快照
-	m.ident, m.funcCode, m.slaveId = frameId, funcCode, slaveId
-	return append(encode, data1...)
+	m.ident, m.funcCode, m.slaveId, m.raw, m.custom = frameId, funcCode, slaveId, nil, false
+	return BuildTCPFrame(frameId, slaveId, append([]byte{funcCode}, data...))
+}
+
+// BuildCustom 自定义请求
+// slaveId 从站id
+// funcCode 功能码
+// data 功能码之后的数据域
+func (m *ModbusTCPCodec) BuildCustom(slaveId byte, funcCode byte, data []byte) []byte {
+	frame := m.buildFrame(slaveId, funcCode, data)
+	m.custom = true
+	return frame
 }
 
 // BuildReadCoils 读线圈
@@ -122,54 +130,71 @@ func (m *ModbusTCPCodec) BuildWriteMultipleRegisters(slaveId byte, address uint1
 	return m.buildFrame(slaveId, WriteMultipleRegisters, data), nil
 }
 
+// BuildReportServerId 报告从站id
+// slaveId 从站id
+func (m *ModbusTCPCodec) BuildReportServerId(slaveId byte) []byte {
+	return m.buildFrame(slaveId, ReportServerId, nil)
+}
+
 // Decode 解码
 // result 结果数据集
 // error 解码错误
 func (m *ModbusTCPCodec) Decode(buf *bufio.Reader) ([]byte, error) {
+	r := m.record(buf)
 	//判断frameId
 	var frameId uint16
-	if err := binary.Read(buf, binary.BigEndian, &frameId); err != nil {
+	if err := binary.Read(r, binary.BigEndian, &frameId); err != nil {
 		return nil, err
 	}
 	if frameId != m.ident {
-		return nil, errors.New("invalid identifier")
+		return nil, fmt.Errorf("%w: got %d, want %d", ErrTransactionMismatch, frameId, m.ident)
 	}
-	//读取两个参数，判定是否为modbusTCP协议
-	var flag [2]byte
-	if err := binary.Read(buf, binary.BigEndian, &flag); err != nil {
-		return nil, err
+	//协议标识，modbusTCP为0
+	var protocolId uint16
+	if err := binary.Read(r, binary.BigEndian, &protocolId); err != nil {
+		return nil, shortFrame(err)
 	}
-	if flag[0] != 0 && flag[1] != 0 {
-		return nil, errors.New("invalid modbus tcp type")
+	if protocolId != 0 {
+		return nil, fmt.Errorf("%w: invalid protocol identifier %d", ErrProtocolViolation, protocolId)
 	}
 	//获取长度
 	var length uint16
-	if err := binary.Read(buf, binary.BigEndian, &length); err != nil {
-		return nil, err
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, shortFrame(err)
 	}
-	length -= 2
-	if length < 0 {
-		return nil, errors.New("invalid length")
+	if length < 2 {
+		return nil, fmt.Errorf("%w: invalid length %d", ErrProtocolViolation, length)
 	}
+	length -= 2
 	var data [2]byte
-	if err := binary.Read(buf, binary.BigEndian, &data); err != nil {
-		return nil, err
+	if err := binary.Read(r, binary.BigEndian, &data); err != nil {
+		return nil, shortFrame(err)
 	}
 	if data[0] != m.slaveId {
-		return nil, errors.New("invaild slave id")
+		return nil, fmt.Errorf("%w: got %d, want %d", ErrUnexpectedSlave, data[0], m.slaveId)
 	}
-	if data[1] != m.funcCode {
-		if slices.Contains(errFuncCodes, m.funcCode) {
-			return nil, newReturnedAbnormalFuncCode(data[1])
+	var result []byte
+	if length > 0 {
+		result = make([]byte, length)
+		if err := binary.Read(r, binary.BigEndian, &result); err != nil {
+			return nil, shortFrame(err)
 		}
-		return nil, errors.New("invaild function code")
 	}
-	if length > 0 {
-		result := make([]byte, length)
-		if err := binary.Read(buf, binary.BigEndian, &result); err != nil {
-			return nil, err
+	if data[1] != m.funcCode {
+		if data[1] == m.funcCode+0x80 && (m.custom || slices.Contains(errFuncCodes, data[1])) && len(result) == 1 {
+			return nil, newReturnedAbnormalFuncCode(data[1], result[0])
 		}
+		return nil, fmt.Errorf("%w: got 0x%02X, want 0x%02X", ErrUnexpectedFunction, data[1], m.funcCode)
+	}
+	if m.custom {
 		return result, nil
 	}
-	return nil, nil
+	if m.funcCode == ReadCoils || m.funcCode == ReadDiscreteInputs || m.funcCode == ReadHoldingRegisters || m.funcCode == ReadInputRegisters || m.funcCode == ReportServerId {
+		//读类响应去掉字节数，与RTU保持一致
+		if len(result) == 0 || int(result[0]) != len(result)-1 {
+			return nil, fmt.Errorf("%w: byte count does not match length", ErrProtocolViolation)
+		}
+		return result[1:], nil
+	}
+	return result, nil
 }
@@ -0,0 +1,105 @@
+package statute
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestModbusTCPCodecDecode(t *testing.T) {
+	tests := []struct {
+		name          string
+		build         func(codec *ModbusTCPCodec) []byte
+		pdu           []byte //响应PDU，MBAP头按请求生成
+		want          []byte
+		exceptionCode int //大于等于0时预期异常响应
+		err           bool
+	}{
+		{
+			name:          "read holding registers drops byte count",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildReadHoldingRegisters(1, 0, 2) },
+			pdu:           []byte{0x03, 0x04, 0x00, 0x2A, 0x01, 0x02},
+			want:          []byte{0x00, 0x2A, 0x01, 0x02},
+			exceptionCode: -1,
+		},
+		{
+			name:          "read coils drops byte count",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildReadCoils(1, 0, 3) },
+			pdu:           []byte{0x01, 0x01, 0x05},
+			want:          []byte{0x05},
+			exceptionCode: -1,
+		},
+		{
+			name:          "read input registers with wrong byte count",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildReadInputRegisters(1, 0, 1) },
+			pdu:           []byte{0x04, 0x03, 0x00, 0x2A},
+			exceptionCode: -1,
+			err:           true,
+		},
+		{
+			name:          "write single register echo",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildWriteSingleRegister(1, 10, 5) },
+			pdu:           []byte{0x06, 0x00, 0x0A, 0x00, 0x05},
+			want:          []byte{0x00, 0x0A, 0x00, 0x05},
+			exceptionCode: -1,
+		},
+		{
+			name:          "exception",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildReadHoldingRegisters(1, 0, 1) },
+			pdu:           []byte{0x83, 0x02},
+			exceptionCode: 0x02,
+		},
+		{
+			name:          "exception for another function",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildReadHoldingRegisters(1, 0, 1) },
+			pdu:           []byte{0x84, 0x02},
+			exceptionCode: -1,
+			err:           true,
+		},
+		{
+			name:          "exception without code",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildReadHoldingRegisters(1, 0, 1) },
+			pdu:           []byte{0x83},
+			exceptionCode: -1,
+			err:           true,
+		},
+		{
+			name:          "exception with extra bytes",
+			build:         func(codec *ModbusTCPCodec) []byte { return codec.BuildReadHoldingRegisters(1, 0, 1) },
+			pdu:           []byte{0x83, 0x02, 0x00},
+			exceptionCode: -1,
+			err:           true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codec := NewModbusTCPCodec()
+			request := test.build(codec)
+			response := append([]byte{request[0], request[1], 0x00, 0x00, 0x00, byte(len(test.pdu) + 1), request[6]}, test.pdu...)
+			data, err := codec.Decode(bufio.NewReader(bytes.NewReader(response)))
+			var abnormal *ReturnedAbnormalFuncCode
+			if test.exceptionCode >= 0 {
+				if !errors.As(err, &abnormal) || abnormal.GetExceptionCode() != byte(test.exceptionCode) {
+					t.Fatalf("error = %v, want exception %d", err, test.exceptionCode)
+				}
+				return
+			}
+			if errors.As(err, &abnormal) {
+				t.Fatalf("error = %v, want no exception", err)
+			}
+			if test.err {
+				if err == nil {
+					t.Fatalf("Decode = % x, want error", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, test.want) {
+				t.Fatalf("Decode = % x, want % x", data, test.want)
+			}
+		})
+	}
+}
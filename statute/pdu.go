@@ -0,0 +1,570 @@
+package statute
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 单个请求的数量上限
+const (
+	MaxReadBits       = 2000 //一次最多读取的线圈数
+	MaxReadRegisters  = 125  //一次最多读取的寄存器数
+	MaxWriteBits      = 1968 //一次最多写入的线圈数
+	MaxWriteRegisters = 123  //一次最多写入的寄存器数
+)
+
+// PDU 协议数据单元，二进制形式为功能码+数据域
+type PDU interface {
+	FuncCode() byte
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// ParseRequest 按功能码将请求PDU解析为对应的请求类型，不认识的功能码解析为*RawPDU
+func ParseRequest(pdu []byte) (PDU, error) {
+	if len(pdu) == 0 {
+		return nil, errors.New("empty pdu")
+	}
+	var p PDU
+	switch pdu[0] {
+	case ReadCoils:
+		p = &ReadCoilsRequest{}
+	case ReadDiscreteInputs:
+		p = &ReadDiscreteInputsRequest{}
+	case ReadHoldingRegisters:
+		p = &ReadHoldingRegistersRequest{}
+	case ReadInputRegisters:
+		p = &ReadInputRegistersRequest{}
+	case WriteSingleCoil:
+		p = &WriteSingleCoilRequest{}
+	case WriteSingleRegister:
+		p = &WriteSingleRegisterRequest{}
+	case WriteMultipleCoils:
+		p = &WriteMultipleCoilsRequest{}
+	case WriteMultipleRegisters:
+		p = &WriteMultipleRegistersRequest{}
+	case ReportServerId:
+		p = &ReportServerIdRequest{}
+	default:
+		p = &RawPDU{}
+	}
+	return p, p.UnmarshalBinary(pdu)
+}
+
+// ParseResponse 按功能码将响应PDU解析为对应的响应类型，异常响应解析为*ExceptionResponse，不认识的功能码解析为*RawPDU
+func ParseResponse(pdu []byte) (PDU, error) {
+	if len(pdu) == 0 {
+		return nil, errors.New("empty pdu")
+	}
+	var p PDU
+	switch pdu[0] {
+	case ReadCoils:
+		p = &ReadCoilsResponse{}
+	case ReadDiscreteInputs:
+		p = &ReadDiscreteInputsResponse{}
+	case ReadHoldingRegisters:
+		p = &ReadHoldingRegistersResponse{}
+	case ReadInputRegisters:
+		p = &ReadInputRegistersResponse{}
+	case WriteSingleCoil:
+		p = &WriteSingleCoilResponse{}
+	case WriteSingleRegister:
+		p = &WriteSingleRegisterResponse{}
+	case WriteMultipleCoils:
+		p = &WriteMultipleCoilsResponse{}
+	case WriteMultipleRegisters:
+		p = &WriteMultipleRegistersResponse{}
+	case ReportServerId:
+		p = &ReportServerIdResponse{}
+	default:
+		if pdu[0]&0x80 != 0 {
+			p = &ExceptionResponse{}
+		} else {
+			p = &RawPDU{}
+		}
+	}
+	return p, p.UnmarshalBinary(pdu)
+}
+
+// 检查功能码和长度，length小于0时不检查长度
+func checkPdu(data []byte, funcCode byte, length int) error {
+	if len(data) == 0 || data[0] != funcCode {
+		return fmt.Errorf("%w: %s", ErrUnexpectedFunction, FuncCodeName(funcCode))
+	}
+	if length >= 0 && len(data) != length {
+		return fmt.Errorf("%w: %s: invalid length %d", ErrProtocolViolation, FuncCodeName(funcCode), len(data))
+	}
+	return nil
+}
+
+func marshalAddressValue(funcCode byte, address, value uint16) []byte {
+	data := make([]byte, 5)
+	data[0] = funcCode
+	binary.BigEndian.PutUint16(data[1:], address)
+	binary.BigEndian.PutUint16(data[3:], value)
+	return data
+}
+
+func unmarshalAddressValue(data []byte, funcCode byte) (address, value uint16, err error) {
+	if err = checkPdu(data, funcCode, 5); err != nil {
+		return 0, 0, err
+	}
+	return binary.BigEndian.Uint16(data[1:]), binary.BigEndian.Uint16(data[3:]), nil
+}
+
+// 读请求，数量需在1~limit之间
+func marshalRead(funcCode byte, address, quantity uint16, limit uint16) ([]byte, error) {
+	if quantity == 0 || quantity > limit {
+		return nil, fmt.Errorf("%s: quantity must be 1-%d", FuncCodeName(funcCode), limit)
+	}
+	return marshalAddressValue(funcCode, address, quantity), nil
+}
+
+// 带字节计数的数据，如读线圈和读寄存器的响应
+func marshalCounted(funcCode byte, payload []byte) ([]byte, error) {
+	if len(payload) > maxPduLength-2 {
+		return nil, fmt.Errorf("%s: too many values", FuncCodeName(funcCode))
+	}
+	return append([]byte{funcCode, byte(len(payload))}, payload...), nil
+}
+
+func unmarshalCounted(data []byte, funcCode byte) ([]byte, error) {
+	if err := checkPdu(data, funcCode, -1); err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || int(data[1]) != len(data)-2 {
+		return nil, fmt.Errorf("%w: %s: byte count mismatch", ErrProtocolViolation, FuncCodeName(funcCode))
+	}
+	return data[2:], nil
+}
+
+func packBits(bits []bool) []byte {
+	data := make([]byte, (len(bits)+7)/8)
+	for index, bit := range bits {
+		if bit {
+			data[index/8] |= 1 << (index % 8)
+		}
+	}
+	return data
+}
+
+func packRegisters(values []uint16) []byte {
+	data := make([]byte, 2*len(values))
+	for index, value := range values {
+		binary.BigEndian.PutUint16(data[2*index:], value)
+	}
+	return data
+}
+
+func coilValue(on bool) uint16 {
+	if on {
+		return 0xFF00
+	}
+	return 0x0000
+}
+
+func parseCoilValue(funcCode byte, value uint16) (bool, error) {
+	switch value {
+	case 0xFF00:
+		return true, nil
+	case 0x0000:
+		return false, nil
+	}
+	return false, fmt.Errorf("%s: invalid coil value 0x%04X", FuncCodeName(funcCode), value)
+}
+
+// ReadCoilsRequest 读线圈请求，功能码0x01
+type ReadCoilsRequest struct {
+	Address  uint16
+	Quantity uint16
+}
+
+func (p *ReadCoilsRequest) FuncCode() byte { return ReadCoils }
+
+func (p *ReadCoilsRequest) MarshalBinary() ([]byte, error) {
+	return marshalRead(ReadCoils, p.Address, p.Quantity, MaxReadBits)
+}
+
+func (p *ReadCoilsRequest) UnmarshalBinary(data []byte) (err error) {
+	p.Address, p.Quantity, err = unmarshalAddressValue(data, ReadCoils)
+	return err
+}
+
+// ReadDiscreteInputsRequest 读离散输入请求，功能码0x02
+type ReadDiscreteInputsRequest struct {
+	Address  uint16
+	Quantity uint16
+}
+
+func (p *ReadDiscreteInputsRequest) FuncCode() byte { return ReadDiscreteInputs }
+
+func (p *ReadDiscreteInputsRequest) MarshalBinary() ([]byte, error) {
+	return marshalRead(ReadDiscreteInputs, p.Address, p.Quantity, MaxReadBits)
+}
+
+func (p *ReadDiscreteInputsRequest) UnmarshalBinary(data []byte) (err error) {
+	p.Address, p.Quantity, err = unmarshalAddressValue(data, ReadDiscreteInputs)
+	return err
+}
+
+// ReadHoldingRegistersRequest 读保持寄存器请求，功能码0x03
+type ReadHoldingRegistersRequest struct {
+	Address  uint16
+	Quantity uint16
+}
+
+func (p *ReadHoldingRegistersRequest) FuncCode() byte { return ReadHoldingRegisters }
+
+func (p *ReadHoldingRegistersRequest) MarshalBinary() ([]byte, error) {
+	return marshalRead(ReadHoldingRegisters, p.Address, p.Quantity, MaxReadRegisters)
+}
+
+func (p *ReadHoldingRegistersRequest) UnmarshalBinary(data []byte) (err error) {
+	p.Address, p.Quantity, err = unmarshalAddressValue(data, ReadHoldingRegisters)
+	return err
+}
+
+// ReadInputRegistersRequest 读输入寄存器请求，功能码0x04
+type ReadInputRegistersRequest struct {
+	Address  uint16
+	Quantity uint16
+}
+
+func (p *ReadInputRegistersRequest) FuncCode() byte { return ReadInputRegisters }
+
+func (p *ReadInputRegistersRequest) MarshalBinary() ([]byte, error) {
+	return marshalRead(ReadInputRegisters, p.Address, p.Quantity, MaxReadRegisters)
+}
+
+func (p *ReadInputRegistersRequest) UnmarshalBinary(data []byte) (err error) {
+	p.Address, p.Quantity, err = unmarshalAddressValue(data, ReadInputRegisters)
+	return err
+}
+
+// WriteSingleCoilRequest 写单个线圈请求，功能码0x05
+type WriteSingleCoilRequest struct {
+	Address uint16
+	Value   bool //true-ON false-OFF
+}
+
+func (p *WriteSingleCoilRequest) FuncCode() byte { return WriteSingleCoil }
+
+func (p *WriteSingleCoilRequest) MarshalBinary() ([]byte, error) {
+	return marshalAddressValue(WriteSingleCoil, p.Address, coilValue(p.Value)), nil
+}
+
+func (p *WriteSingleCoilRequest) UnmarshalBinary(data []byte) error {
+	address, value, err := unmarshalAddressValue(data, WriteSingleCoil)
+	if err != nil {
+		return err
+	}
+	p.Address = address
+	p.Value, err = parseCoilValue(WriteSingleCoil, value)
+	return err
+}
+
+// WriteSingleRegisterRequest 写单个保持寄存器请求，功能码0x06
+type WriteSingleRegisterRequest struct {
+	Address uint16
+	Value   uint16
+}
+
+func (p *WriteSingleRegisterRequest) FuncCode() byte { return WriteSingleRegister }
+
+func (p *WriteSingleRegisterRequest) MarshalBinary() ([]byte, error) {
+	return marshalAddressValue(WriteSingleRegister, p.Address, p.Value), nil
+}
+
+func (p *WriteSingleRegisterRequest) UnmarshalBinary(data []byte) (err error) {
+	p.Address, p.Value, err = unmarshalAddressValue(data, WriteSingleRegister)
+	return err
+}
+
+// WriteMultipleCoilsRequest 写多个线圈请求，功能码0x0F
+type WriteMultipleCoilsRequest struct {
+	Address uint16
+	Values  []bool
+}
+
+func (p *WriteMultipleCoilsRequest) FuncCode() byte { return WriteMultipleCoils }
+
+func (p *WriteMultipleCoilsRequest) MarshalBinary() ([]byte, error) {
+	if len(p.Values) == 0 || len(p.Values) > MaxWriteBits {
+		return nil, fmt.Errorf("%s: quantity must be 1-%d", FuncCodeName(WriteMultipleCoils), MaxWriteBits)
+	}
+	bits := packBits(p.Values)
+	data := marshalAddressValue(WriteMultipleCoils, p.Address, uint16(len(p.Values)))
+	return append(append(data, byte(len(bits))), bits...), nil
+}
+
+func (p *WriteMultipleCoilsRequest) UnmarshalBinary(data []byte) error {
+	if err := checkPdu(data, WriteMultipleCoils, -1); err != nil {
+		return err
+	}
+	if len(data) < 6 || int(data[5]) != len(data)-6 {
+		return fmt.Errorf("%w: %s: byte count mismatch", ErrProtocolViolation, FuncCodeName(WriteMultipleCoils))
+	}
+	quantity := int(binary.BigEndian.Uint16(data[3:]))
+	if quantity == 0 || (quantity+7)/8 != int(data[5]) {
+		return fmt.Errorf("%w: %s: quantity mismatch", ErrProtocolViolation, FuncCodeName(WriteMultipleCoils))
+	}
+	p.Address = binary.BigEndian.Uint16(data[1:])
+	p.Values = unpackBits(data[6:], quantity)
+	return nil
+}
+
+// WriteMultipleRegistersRequest 写多个保持寄存器请求，功能码0x10
+type WriteMultipleRegistersRequest struct {
+	Address uint16
+	Values  []uint16
+}
+
+func (p *WriteMultipleRegistersRequest) FuncCode() byte { return WriteMultipleRegisters }
+
+func (p *WriteMultipleRegistersRequest) MarshalBinary() ([]byte, error) {
+	if len(p.Values) == 0 || len(p.Values) > MaxWriteRegisters {
+		return nil, fmt.Errorf("%s: quantity must be 1-%d", FuncCodeName(WriteMultipleRegisters), MaxWriteRegisters)
+	}
+	data := marshalAddressValue(WriteMultipleRegisters, p.Address, uint16(len(p.Values)))
+	return append(append(data, byte(2*len(p.Values))), packRegisters(p.Values)...), nil
+}
+
+func (p *WriteMultipleRegistersRequest) UnmarshalBinary(data []byte) error {
+	if err := checkPdu(data, WriteMultipleRegisters, -1); err != nil {
+		return err
+	}
+	if len(data) < 6 || int(data[5]) != len(data)-6 {
+		return fmt.Errorf("%w: %s: byte count mismatch", ErrProtocolViolation, FuncCodeName(WriteMultipleRegisters))
+	}
+	quantity := int(binary.BigEndian.Uint16(data[3:]))
+	if quantity == 0 || 2*quantity != int(data[5]) {
+		return fmt.Errorf("%w: %s: quantity mismatch", ErrProtocolViolation, FuncCodeName(WriteMultipleRegisters))
+	}
+	p.Address = binary.BigEndian.Uint16(data[1:])
+	p.Values = unpackRegisters(data[6:])
+	return nil
+}
+
+// ReportServerIdRequest 报告从站id请求，功能码0x11
+type ReportServerIdRequest struct {
+}
+
+func (p *ReportServerIdRequest) FuncCode() byte { return ReportServerId }
+
+func (p *ReportServerIdRequest) MarshalBinary() ([]byte, error) {
+	return []byte{ReportServerId}, nil
+}
+
+func (p *ReportServerIdRequest) UnmarshalBinary(data []byte) error {
+	return checkPdu(data, ReportServerId, 1)
+}
+
+// ReadCoilsResponse 读线圈响应，功能码0x01
+// 响应中没有线圈数量，解码得到的Values为字节数*8个
+type ReadCoilsResponse struct {
+	Values []bool
+}
+
+func (p *ReadCoilsResponse) FuncCode() byte { return ReadCoils }
+
+func (p *ReadCoilsResponse) MarshalBinary() ([]byte, error) {
+	return marshalCounted(ReadCoils, packBits(p.Values))
+}
+
+func (p *ReadCoilsResponse) UnmarshalBinary(data []byte) error {
+	payload, err := unmarshalCounted(data, ReadCoils)
+	if err != nil {
+		return err
+	}
+	p.Values = unpackBits(payload, 8*len(payload))
+	return nil
+}
+
+// ReadDiscreteInputsResponse 读离散输入响应，功能码0x02
+// 响应中没有输入数量，解码得到的Values为字节数*8个
+type ReadDiscreteInputsResponse struct {
+	Values []bool
+}
+
+func (p *ReadDiscreteInputsResponse) FuncCode() byte { return ReadDiscreteInputs }
+
+func (p *ReadDiscreteInputsResponse) MarshalBinary() ([]byte, error) {
+	return marshalCounted(ReadDiscreteInputs, packBits(p.Values))
+}
+
+func (p *ReadDiscreteInputsResponse) UnmarshalBinary(data []byte) error {
+	payload, err := unmarshalCounted(data, ReadDiscreteInputs)
+	if err != nil {
+		return err
+	}
+	p.Values = unpackBits(payload, 8*len(payload))
+	return nil
+}
+
+// ReadHoldingRegistersResponse 读保持寄存器响应，功能码0x03
+type ReadHoldingRegistersResponse struct {
+	Values []uint16
+}
+
+func (p *ReadHoldingRegistersResponse) FuncCode() byte { return ReadHoldingRegisters }
+
+func (p *ReadHoldingRegistersResponse) MarshalBinary() ([]byte, error) {
+	return marshalCounted(ReadHoldingRegisters, packRegisters(p.Values))
+}
+
+func (p *ReadHoldingRegistersResponse) UnmarshalBinary(data []byte) error {
+	payload, err := unmarshalCounted(data, ReadHoldingRegisters)
+	if err != nil {
+		return err
+	}
+	if len(payload)%2 != 0 {
+		return fmt.Errorf("%w: %s: odd byte count", ErrProtocolViolation, FuncCodeName(ReadHoldingRegisters))
+	}
+	p.Values = unpackRegisters(payload)
+	return nil
+}
+
+// ReadInputRegistersResponse 读输入寄存器响应，功能码0x04
+type ReadInputRegistersResponse struct {
+	Values []uint16
+}
+
+func (p *ReadInputRegistersResponse) FuncCode() byte { return ReadInputRegisters }
+
+func (p *ReadInputRegistersResponse) MarshalBinary() ([]byte, error) {
+	return marshalCounted(ReadInputRegisters, packRegisters(p.Values))
+}
+
+func (p *ReadInputRegistersResponse) UnmarshalBinary(data []byte) error {
+	payload, err := unmarshalCounted(data, ReadInputRegisters)
+	if err != nil {
+		return err
+	}
+	if len(payload)%2 != 0 {
+		return fmt.Errorf("%w: %s: odd byte count", ErrProtocolViolation, FuncCodeName(ReadInputRegisters))
+	}
+	p.Values = unpackRegisters(payload)
+	return nil
+}
+
+// WriteSingleCoilResponse 写单个线圈响应，功能码0x05，回显请求
+type WriteSingleCoilResponse WriteSingleCoilRequest
+
+func (p *WriteSingleCoilResponse) FuncCode() byte { return WriteSingleCoil }
+
+func (p *WriteSingleCoilResponse) MarshalBinary() ([]byte, error) {
+	return (*WriteSingleCoilRequest)(p).MarshalBinary()
+}
+
+func (p *WriteSingleCoilResponse) UnmarshalBinary(data []byte) error {
+	return (*WriteSingleCoilRequest)(p).UnmarshalBinary(data)
+}
+
+// WriteSingleRegisterResponse 写单个保持寄存器响应，功能码0x06，回显请求
+type WriteSingleRegisterResponse WriteSingleRegisterRequest
+
+func (p *WriteSingleRegisterResponse) FuncCode() byte { return WriteSingleRegister }
+
+func (p *WriteSingleRegisterResponse) MarshalBinary() ([]byte, error) {
+	return (*WriteSingleRegisterRequest)(p).MarshalBinary()
+}
+
+func (p *WriteSingleRegisterResponse) UnmarshalBinary(data []byte) error {
+	return (*WriteSingleRegisterRequest)(p).UnmarshalBinary(data)
+}
+
+// WriteMultipleCoilsResponse 写多个线圈响应，功能码0x0F
+type WriteMultipleCoilsResponse struct {
+	Address  uint16
+	Quantity uint16
+}
+
+func (p *WriteMultipleCoilsResponse) FuncCode() byte { return WriteMultipleCoils }
+
+func (p *WriteMultipleCoilsResponse) MarshalBinary() ([]byte, error) {
+	return marshalAddressValue(WriteMultipleCoils, p.Address, p.Quantity), nil
+}
+
+func (p *WriteMultipleCoilsResponse) UnmarshalBinary(data []byte) (err error) {
+	p.Address, p.Quantity, err = unmarshalAddressValue(data, WriteMultipleCoils)
+	return err
+}
+
+// WriteMultipleRegistersResponse 写多个保持寄存器响应，功能码0x10
+type WriteMultipleRegistersResponse struct {
+	Address  uint16
+	Quantity uint16
+}
+
+func (p *WriteMultipleRegistersResponse) FuncCode() byte { return WriteMultipleRegisters }
+
+func (p *WriteMultipleRegistersResponse) MarshalBinary() ([]byte, error) {
+	return marshalAddressValue(WriteMultipleRegisters, p.Address, p.Quantity), nil
+}
+
+func (p *WriteMultipleRegistersResponse) UnmarshalBinary(data []byte) (err error) {
+	p.Address, p.Quantity, err = unmarshalAddressValue(data, WriteMultipleRegisters)
+	return err
+}
+
+// ReportServerIdResponse 报告从站id响应，功能码0x11
+// Data为从站id、运行状态和附加数据，格式由设备定义
+type ReportServerIdResponse struct {
+	Data []byte
+}
+
+func (p *ReportServerIdResponse) FuncCode() byte { return ReportServerId }
+
+func (p *ReportServerIdResponse) MarshalBinary() ([]byte, error) {
+	return marshalCounted(ReportServerId, p.Data)
+}
+
+func (p *ReportServerIdResponse) UnmarshalBinary(data []byte) (err error) {
+	p.Data, err = unmarshalCounted(data, ReportServerId)
+	return err
+}
+
+// ExceptionResponse 异常响应，功能码为请求功能码+0x80
+type ExceptionResponse struct {
+	Function      byte //请求的功能码
+	ExceptionCode byte
+}
+
+func (p *ExceptionResponse) FuncCode() byte { return p.Function | 0x80 }
+
+func (p *ExceptionResponse) MarshalBinary() ([]byte, error) {
+	return []byte{p.Function | 0x80, p.ExceptionCode}, nil
+}
+
+func (p *ExceptionResponse) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 || data[0]&0x80 == 0 {
+		return fmt.Errorf("%w: invalid exception response", ErrProtocolViolation)
+	}
+	p.Function, p.ExceptionCode = data[0]&0x7F, data[1]
+	return nil
+}
+
+// RawPDU 未解析数据域的PDU，可表示任意功能码
+type RawPDU struct {
+	Function byte
+	Data     []byte
+}
+
+func (p *RawPDU) FuncCode() byte { return p.Function }
+
+func (p *RawPDU) MarshalBinary() ([]byte, error) {
+	if len(p.Data) > maxPduLength-1 {
+		return nil, errors.New("pdu too long")
+	}
+	return append([]byte{p.Function}, p.Data...), nil
+}
+
+func (p *RawPDU) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || len(data) > maxPduLength {
+		return fmt.Errorf("%w: invalid pdu length", ErrProtocolViolation)
+	}
+	p.Function, p.Data = data[0], append([]byte(nil), data[1:]...)
+	return nil
+}
@@ -0,0 +1,205 @@
+package statute
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		pdu  PDU
+		want []byte
+	}{
+		{"read coils", &ReadCoilsRequest{Address: 0x13, Quantity: 19}, []byte{0x01, 0x00, 0x13, 0x00, 0x13}},
+		{"read discrete inputs", &ReadDiscreteInputsRequest{Address: 0xC4, Quantity: 22}, []byte{0x02, 0x00, 0xC4, 0x00, 0x16}},
+		{"read holding registers", &ReadHoldingRegistersRequest{Address: 0x6B, Quantity: 3}, []byte{0x03, 0x00, 0x6B, 0x00, 0x03}},
+		{"read input registers", &ReadInputRegistersRequest{Address: 0x08, Quantity: 1}, []byte{0x04, 0x00, 0x08, 0x00, 0x01}},
+		{"write single coil", &WriteSingleCoilRequest{Address: 0xAC, Value: true}, []byte{0x05, 0x00, 0xAC, 0xFF, 0x00}},
+		{"write single register", &WriteSingleRegisterRequest{Address: 0x01, Value: 3}, []byte{0x06, 0x00, 0x01, 0x00, 0x03}},
+		{"write multiple coils", &WriteMultipleCoilsRequest{Address: 0x13, Values: []bool{true, false, true, true, false, false, true, true, true, false}}, []byte{0x0F, 0x00, 0x13, 0x00, 0x0A, 0x02, 0xCD, 0x01}},
+		{"write multiple registers", &WriteMultipleRegistersRequest{Address: 0x01, Values: []uint16{0x0A, 0x0102}}, []byte{0x10, 0x00, 0x01, 0x00, 0x02, 0x04, 0x00, 0x0A, 0x01, 0x02}},
+		{"report server id", &ReportServerIdRequest{}, []byte{0x11}},
+		{"unknown function", &RawPDU{Function: 0x2B, Data: []byte{0x0E, 0x01, 0x00}}, []byte{0x2B, 0x0E, 0x01, 0x00}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.pdu.MarshalBinary()
+			if err != nil || !bytes.Equal(data, test.want) {
+				t.Fatalf("MarshalBinary = % x %v, want % x", data, err, test.want)
+			}
+			parsed, err := ParseRequest(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, test.pdu) || parsed.FuncCode() != test.want[0] {
+				t.Fatalf("ParseRequest = %+v, want %+v", parsed, test.pdu)
+			}
+		})
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		pdu  PDU
+		want []byte
+	}{
+		//响应中没有线圈数量，按整字节解码
+		{"read coils", &ReadCoilsResponse{Values: []bool{true, false, true, true, false, false, true, true}}, []byte{0x01, 0x01, 0xCD}},
+		{"read discrete inputs", &ReadDiscreteInputsResponse{Values: []bool{false, true, false, false, false, false, false, false}}, []byte{0x02, 0x01, 0x02}},
+		{"read holding registers", &ReadHoldingRegistersResponse{Values: []uint16{0x022B, 0x0000, 0x0064}}, []byte{0x03, 0x06, 0x02, 0x2B, 0x00, 0x00, 0x00, 0x64}},
+		{"read input registers", &ReadInputRegistersResponse{Values: []uint16{0x0A}}, []byte{0x04, 0x02, 0x00, 0x0A}},
+		{"write single coil", &WriteSingleCoilResponse{Address: 0xAC, Value: false}, []byte{0x05, 0x00, 0xAC, 0x00, 0x00}},
+		{"write single register", &WriteSingleRegisterResponse{Address: 0x01, Value: 3}, []byte{0x06, 0x00, 0x01, 0x00, 0x03}},
+		{"write multiple coils", &WriteMultipleCoilsResponse{Address: 0x13, Quantity: 10}, []byte{0x0F, 0x00, 0x13, 0x00, 0x0A}},
+		{"write multiple registers", &WriteMultipleRegistersResponse{Address: 0x01, Quantity: 2}, []byte{0x10, 0x00, 0x01, 0x00, 0x02}},
+		{"report server id", &ReportServerIdResponse{Data: []byte{0x2A, 0xFF}}, []byte{0x11, 0x02, 0x2A, 0xFF}},
+		{"exception", &ExceptionResponse{Function: 0x03, ExceptionCode: 0x02}, []byte{0x83, 0x02}},
+		{"unknown function", &RawPDU{Function: 0x14, Data: []byte{0x00}}, []byte{0x14, 0x00}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.pdu.MarshalBinary()
+			if err != nil || !bytes.Equal(data, test.want) {
+				t.Fatalf("MarshalBinary = % x %v, want % x", data, err, test.want)
+			}
+			parsed, err := ParseResponse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, test.pdu) || parsed.FuncCode() != test.want[0] {
+				t.Fatalf("ParseResponse = %+v, want %+v", parsed, test.pdu)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		pdu     []byte
+		request bool
+	}{
+		{"empty request", nil, true},
+		{"empty response", nil, false},
+		{"short read request", []byte{0x03, 0x00, 0x00, 0x00}, true},
+		{"invalid coil value", []byte{0x05, 0x00, 0x01, 0x12, 0x34}, true},
+		{"coils byte count mismatch", []byte{0x0F, 0x00, 0x00, 0x00, 0x08, 0x02, 0xFF}, true},
+		{"coils quantity mismatch", []byte{0x0F, 0x00, 0x00, 0x00, 0x10, 0x01, 0xFF}, true},
+		{"registers quantity mismatch", []byte{0x10, 0x00, 0x00, 0x00, 0x02, 0x02, 0x00, 0x01}, true},
+		{"report server id with data", []byte{0x11, 0x00}, true},
+		{"registers byte count mismatch", []byte{0x03, 0x04, 0x00, 0x01}, false},
+		{"exception without code", []byte{0x83}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parse := ParseResponse
+			if test.request {
+				parse = ParseRequest
+			}
+			if p, err := parse(test.pdu); err == nil {
+				t.Fatalf("parsed % x as %+v", test.pdu, p)
+			}
+		})
+	}
+}
+
+func TestMarshalLimits(t *testing.T) {
+	for _, pdu := range []PDU{
+		&ReadCoilsRequest{Quantity: 0},
+		&ReadCoilsRequest{Quantity: 2001},
+		&ReadHoldingRegistersRequest{Quantity: 126},
+		&WriteMultipleCoilsRequest{},
+		&WriteMultipleRegistersRequest{Values: make([]uint16, 124)},
+		&RawPDU{Function: 0x14, Data: make([]byte, maxPduLength)},
+	} {
+		if data, err := pdu.MarshalBinary(); err == nil {
+			t.Errorf("%T marshaled to % x", pdu, data)
+		}
+	}
+}
+
+func TestFramer(t *testing.T) {
+	request := &ReadHoldingRegistersRequest{Address: 10, Quantity: 2}
+	response := &ReadHoldingRegistersResponse{Values: []uint16{7, 8}}
+	for _, kind := range []FrameKind{FrameTCP, FrameRTU, FrameASCII} {
+		t.Run(string(kind), func(t *testing.T) {
+			framer, err := NewFramer(kind)
+			if err != nil || framer.Kind() != kind {
+				t.Fatalf("NewFramer = %v %v", framer, err)
+			}
+			var stream bytes.Buffer
+			for index, pdu := range []PDU{request, response} {
+				adu, err := NewADU(uint16(index+1), 1, pdu)
+				if err != nil {
+					t.Fatal(err)
+				}
+				frame, err := framer.Encode(adu)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stream.Write(frame)
+			}
+			for index, want := range []PDU{request, response} {
+				frame, err := framer.ReadFrame(&stream, index == 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				adu, err := framer.Decode(frame)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parse := adu.Response
+				if index == 0 {
+					parse = adu.Request
+				}
+				got, err := parse()
+				if err != nil || adu.SlaveId != 1 || !reflect.DeepEqual(got, want) {
+					t.Fatalf("frame % x decoded to %+v %+v %v", frame, adu, got, err)
+				}
+				//只有MBAP帧带事务标识
+				if kind == FrameTCP && adu.TransactionId != uint16(index+1) {
+					t.Fatalf("TransactionId = %d", adu.TransactionId)
+				}
+			}
+		})
+	}
+	if _, err := NewFramer("can"); err == nil {
+		t.Fatal("NewFramer accepted an unknown kind")
+	}
+}
+
+func TestFramerDecodeErrors(t *testing.T) {
+	rtu := BuildRTUFrame(1, []byte{0x03, 0x02, 0x00, 0x2A})
+	rtu[len(rtu)-1] ^= 0xFF
+	ascii := BuildASCIIFrame(1, []byte{0x03, 0x02, 0x00, 0x2A})
+	ascii[len(ascii)-3] ^= 0x01
+	tcp := BuildTCPFrame(1, 1, []byte{0x03, 0x02, 0x00, 0x2A})
+	tests := []struct {
+		name  string
+		kind  FrameKind
+		frame []byte
+		check error //校验错误时仍返回ADU
+	}{
+		{"rtu crc", FrameRTU, rtu, CsError},
+		{"ascii lrc", FrameASCII, ascii, LrcError},
+		{"rtu too short", FrameRTU, rtu[:3], nil},
+		{"tcp protocol", FrameTCP, append([]byte{0x00, 0x01, 0x00, 0x01}, tcp[4:]...), nil},
+		{"tcp length", FrameTCP, tcp[:len(tcp)-1], nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			framer, _ := NewFramer(test.kind)
+			adu, err := framer.Decode(test.frame)
+			if err == nil {
+				t.Fatalf("Decode = %+v", adu)
+			}
+			if test.check != nil && (!errors.Is(err, test.check) || adu == nil || !bytes.Equal(adu.PDU, []byte{0x03, 0x02, 0x00, 0x2A})) {
+				t.Fatalf("Decode = %+v %v, want the ADU and %v", adu, err, test.check)
+			}
+		})
+	}
+}
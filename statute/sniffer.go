@@ -0,0 +1,330 @@
+package statute
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxRTUFrameLength = 256 //RTU帧最大长度
+
+// NewSniffer 创建一个被动监听器，从r中读取总线上双向的原始字节流
+// kind为FrameRTU时按功能码长度规则和CRC切分并区分请求和响应，为FrameTCP时按MBAP头切分
+func NewSniffer(r io.Reader, kind FrameKind) *Sniffer {
+	return &Sniffer{reader: bufio.NewReaderSize(r, maxRTUFrameLength*2), kind: kind}
+}
+
+// Sniffer 被动监听器，不需要自己发出请求即可解析其他主站的通信
+type Sniffer struct {
+	reader  *bufio.Reader
+	kind    FrameKind
+	pending []*SniffedFrame       //等待响应的请求，RTU总线上最多一个
+	ready   []*SniffedTransaction //已完成配对等待返回的事务
+	skipped int
+	err     error
+}
+
+// SniffedFrame 监听到的一帧报文
+type SniffedFrame struct {
+	Time          time.Time //收完整帧的时间
+	Request       bool      //是否为请求
+	TransactionId uint16    //事务标识，仅TCP
+	SlaveId       byte
+	FuncCode      byte
+	Data          []byte //功能码之后的数据域，不含CRC
+	Frame         []byte //完整的报文
+}
+
+// SniffedTransaction 一次配对的请求和响应
+type SniffedTransaction struct {
+	Request       *SniffedFrame //nil表示请求未被监听到
+	Response      *SniffedFrame //nil表示没有响应
+	Latency       time.Duration //请求到响应的时间
+	Address       uint16        //起始地址
+	Quantity      uint16        //数量
+	Registers     []uint16      //读到或写入的寄存器
+	Coils         []bool        //读到或写入的线圈
+	ExceptionCode byte          //异常码，0表示没有异常
+}
+
+// Skipped 返回重新同步时丢弃的字节数
+func (s *Sniffer) Skipped() int {
+	return s.skipped
+}
+
+// Next 返回下一个事务
+// 没有响应的请求在下一个请求到达或流结束时返回，流结束后返回io.EOF
+func (s *Sniffer) Next() (*SniffedTransaction, error) {
+	for len(s.ready) == 0 {
+		if s.err != nil {
+			if len(s.pending) == 0 {
+				return nil, s.err
+			}
+			s.emit(s.pending[0], nil)
+			s.pending = s.pending[1:]
+			break
+		}
+		var frame *SniffedFrame
+		if s.kind == FrameRTU {
+			frame, s.err = s.nextRTU()
+		} else {
+			frame, s.err = s.nextTCP()
+		}
+		if frame != nil {
+			s.pair(frame)
+		}
+	}
+	transaction := s.ready[0]
+	s.ready = s.ready[1:]
+	return transaction, nil
+}
+
+// 将一帧与等待中的请求配对
+func (s *Sniffer) pair(frame *SniffedFrame) {
+	if frame.Request {
+		if s.kind == FrameRTU {
+			//RTU总线同一时间只有一个请求，新请求到达说明上一个没有响应
+			for _, request := range s.pending {
+				s.emit(request, nil)
+			}
+			s.pending = nil
+		} else if index := slices.IndexFunc(s.pending, func(f *SniffedFrame) bool { return f.TransactionId == frame.TransactionId }); index >= 0 {
+			s.emit(s.pending[index], nil)
+			s.pending = slices.Delete(s.pending, index, index+1)
+		}
+		if frame.SlaveId == 0 && s.kind == FrameRTU {
+			//广播没有响应
+			s.emit(frame, nil)
+			return
+		}
+		s.pending = append(s.pending, frame)
+		return
+	}
+	index := slices.IndexFunc(s.pending, func(f *SniffedFrame) bool { return s.answers(f, frame) })
+	if index < 0 {
+		s.emit(nil, frame)
+		return
+	}
+	request := s.pending[index]
+	s.pending = slices.Delete(s.pending, index, index+1)
+	s.emit(request, frame)
+}
+
+// 判断response是否为request的响应
+func (s *Sniffer) answers(request, response *SniffedFrame) bool {
+	if s.kind == FrameTCP && request.TransactionId != response.TransactionId {
+		return false
+	}
+	return request.SlaveId == response.SlaveId && request.FuncCode == response.FuncCode&0x7F
+}
+
+func (s *Sniffer) emit(request, response *SniffedFrame) {
+	transaction := &SniffedTransaction{Request: request, Response: response}
+	if request != nil && response != nil {
+		transaction.Latency = response.Time.Sub(request.Time)
+	}
+	transaction.decode()
+	s.ready = append(s.ready, transaction)
+}
+
+// 读取下一帧RTU报文，CRC不正确时逐字节丢弃重新同步
+func (s *Sniffer) nextRTU() (*SniffedFrame, error) {
+	preferResponse := len(s.pending) > 0
+	for {
+		buf, err := s.reader.Peek(max(s.reader.Buffered(), 4))
+		if len(buf) < 4 {
+			if len(buf) > 0 && err != nil {
+				s.skipped += len(buf)
+				_, _ = s.reader.Discard(len(buf))
+			}
+			return nil, err
+		}
+		request, requestShort := tryRTUFrame(buf, true)
+		response, responseShort := tryRTUFrame(buf, false)
+		if request != nil && response != nil {
+			//请求和响应都能解析时按是否有等待中的请求判断，如写单个寄存器的响应与请求相同
+			if preferResponse && s.answers(s.pending[0], &SniffedFrame{SlaveId: response[0], FuncCode: response[1]}) {
+				request = nil
+			} else {
+				response = nil
+			}
+		}
+		if frame := slices.Concat(request, response); frame != nil {
+			_, _ = s.reader.Discard(len(frame))
+			return &SniffedFrame{
+				Time:     time.Now(),
+				Request:  request != nil,
+				SlaveId:  frame[0],
+				FuncCode: frame[1],
+				Data:     frame[2 : len(frame)-2],
+				Frame:    frame,
+			}, nil
+		}
+		if (requestShort || responseShort) && len(buf) < maxRTUFrameLength {
+			//数据不足，等待更多字节，流已结束时剩余数据无法组成完整帧
+			if _, err = s.reader.Peek(len(buf) + 1); err == nil {
+				continue
+			}
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+		}
+		s.skipped++
+		_, _ = s.reader.Discard(1)
+	}
+}
+
+// 尝试从buf开头解析一帧RTU报文，返回CRC正确的帧，short表示数据不足
+func tryRTUFrame(buf []byte, request bool) (frame []byte, short bool) {
+	if request && buf[1]&0x80 != 0 {
+		return nil, false
+	}
+	frame, err := readRTUFrame(bytes.NewReader(buf), request)
+	if err != nil {
+		return nil, errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return frame, false
+}
+
+// 读取下一帧TCP报文，按等待中的事务和长度规则区分请求和响应
+func (s *Sniffer) nextTCP() (*SniffedFrame, error) {
+	frame, err := ReadTCPFrame(s.reader)
+	if err != nil {
+		return nil, err
+	}
+	sniffed := &SniffedFrame{
+		Time:          time.Now(),
+		TransactionId: binary.BigEndian.Uint16(frame),
+		SlaveId:       frame[6],
+		FuncCode:      frame[7],
+		Data:          frame[8:],
+		Frame:         frame,
+	}
+	if slices.ContainsFunc(s.pending, func(f *SniffedFrame) bool { return s.answers(f, sniffed) }) {
+		return sniffed, nil
+	}
+	sniffed.Request = sniffed.FuncCode&0x80 == 0 && fitsRule(sniffed.FuncCode, sniffed.Data, true)
+	if !sniffed.Request && sniffed.FuncCode&0x80 == 0 && !fitsRule(sniffed.FuncCode, sniffed.Data, false) {
+		//两种规则都不符合时按请求处理
+		sniffed.Request = true
+	}
+	return sniffed, nil
+}
+
+// 判断数据域是否恰好符合功能码的长度规则
+func fitsRule(funcCode byte, data []byte, request bool) bool {
+	reader := bytes.NewReader(data)
+	if _, err := readPduData(reader, funcCode, request); err != nil {
+		return false
+	}
+	return reader.Len() == 0
+}
+
+// 解析地址、数量和数值
+func (t *SniffedTransaction) decode() {
+	if t.Response != nil && t.Response.FuncCode&0x80 != 0 && len(t.Response.Data) > 0 {
+		t.ExceptionCode = t.Response.Data[0]
+	}
+	if t.Request != nil {
+		t.decodeRequest(t.Request.FuncCode, t.Request.Data)
+	} else if t.Response != nil {
+		//没有请求时从写操作的回显中取地址
+		switch t.Response.FuncCode {
+		case WriteSingleCoil, WriteSingleRegister, WriteMultipleCoils, WriteMultipleRegisters:
+			t.decodeRequest(t.Response.FuncCode, t.Response.Data)
+		}
+	}
+	if t.Response == nil || t.ExceptionCode != 0 || len(t.Response.Data) == 0 {
+		return
+	}
+	data := t.Response.Data
+	switch t.Response.FuncCode {
+	case ReadCoils, ReadDiscreteInputs:
+		quantity := int(t.Quantity)
+		if quantity == 0 || quantity > (len(data)-1)*8 {
+			quantity = (len(data) - 1) * 8
+		}
+		t.Coils = unpackBits(data[1:], quantity)
+	case ReadHoldingRegisters, ReadInputRegisters:
+		t.Registers = unpackRegisters(data[1:])
+	}
+}
+
+func (t *SniffedTransaction) decodeRequest(funcCode byte, data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	t.Address = binary.BigEndian.Uint16(data)
+	value := binary.BigEndian.Uint16(data[2:])
+	switch funcCode {
+	case ReadCoils, ReadDiscreteInputs, ReadHoldingRegisters, ReadInputRegisters:
+		t.Quantity = value
+	case WriteSingleCoil:
+		t.Quantity, t.Coils = 1, []bool{value == 0xFF00}
+	case WriteSingleRegister:
+		t.Quantity, t.Registers = 1, []uint16{value}
+	case WriteMultipleCoils:
+		t.Quantity = value
+		if len(data) > 5 {
+			t.Coils = unpackBits(data[5:], int(value))
+		}
+	case WriteMultipleRegisters:
+		t.Quantity = value
+		if len(data) > 5 {
+			t.Registers = unpackRegisters(data[5:])
+		}
+	}
+}
+
+func unpackBits(data []byte, quantity int) []bool {
+	bits := make([]bool, 0, quantity)
+	for index := 0; index < quantity && index/8 < len(data); index++ {
+		bits = append(bits, data[index/8]&(1<<(index%8)) != 0)
+	}
+	return bits
+}
+
+func unpackRegisters(data []byte) []uint16 {
+	registers := make([]uint16, 0, len(data)/2)
+	for index := 0; index+1 < len(data); index += 2 {
+		registers = append(registers, binary.BigEndian.Uint16(data[index:]))
+	}
+	return registers
+}
+
+// String 单行描述，如 slave=1 ReadHoldingRegisters address=0 quantity=2 registers=[7 8] latency=12ms
+func (t *SniffedTransaction) String() string {
+	var sb strings.Builder
+	frame := t.Request
+	if frame == nil {
+		frame = t.Response
+	}
+	fmt.Fprintf(&sb, "slave=%d %s", frame.SlaveId, FuncCodeName(frame.FuncCode&0x7F))
+	if t.Quantity > 0 {
+		fmt.Fprintf(&sb, " address=%d quantity=%d", t.Address, t.Quantity)
+	}
+	if t.Registers != nil {
+		fmt.Fprintf(&sb, " registers=%v", t.Registers)
+	}
+	if t.Coils != nil {
+		fmt.Fprintf(&sb, " coils=%v", t.Coils)
+	}
+	switch {
+	case t.ExceptionCode != 0:
+		fmt.Fprintf(&sb, " exception=0x%02x(%s)", t.ExceptionCode, ExceptionName(t.ExceptionCode))
+	case t.Response == nil:
+		sb.WriteString(" no response")
+	case t.Request == nil:
+		sb.WriteString(" request not captured")
+	}
+	if t.Request != nil && t.Response != nil {
+		fmt.Fprintf(&sb, " latency=%s", t.Latency)
+	}
+	return sb.String()
+}
@@ -0,0 +1,147 @@
+package statute
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 读取全部事务
+func sniffAll(t *testing.T, sniffer *Sniffer) []*SniffedTransaction {
+	t.Helper()
+	var transactions []*SniffedTransaction
+	for {
+		transaction, err := sniffer.Next()
+		if errors.Is(err, io.EOF) {
+			return transactions
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactions = append(transactions, transaction)
+	}
+}
+
+func TestSnifferRTU(t *testing.T) {
+	readRequest := BuildRTUFrame(1, []byte{0x03, 0x00, 0x0A, 0x00, 0x02})
+	readResponse := BuildRTUFrame(1, []byte{0x03, 0x04, 0x00, 0x07, 0x00, 0x08})
+	writeEcho := BuildRTUFrame(1, []byte{0x06, 0x00, 0x01, 0x00, 0x05})
+	coilsRequest := BuildRTUFrame(2, []byte{0x01, 0x00, 0x00, 0x00, 0x03})
+	coilsResponse := BuildRTUFrame(2, []byte{0x01, 0x01, 0x05})
+	exceptionResponse := BuildRTUFrame(2, []byte{0x81, 0x02})
+	broadcast := BuildRTUFrame(0, []byte{0x06, 0x00, 0x01, 0x00, 0x05})
+	tests := []struct {
+		name    string
+		stream  [][]byte
+		want    []string
+		skipped int
+	}{
+		{
+			name:   "read registers",
+			stream: [][]byte{readRequest, readResponse},
+			want:   []string{"slave=1 ReadHoldingRegisters address=10 quantity=2 registers=[7 8] latency="},
+		},
+		{
+			name:   "write single register echo",
+			stream: [][]byte{writeEcho, writeEcho},
+			want:   []string{"slave=1 WriteSingleRegister address=1 quantity=1 registers=[5] latency="},
+		},
+		{
+			name:   "read coils",
+			stream: [][]byte{coilsRequest, coilsResponse},
+			want:   []string{"slave=2 ReadCoils address=0 quantity=3 coils=[true false true] latency="},
+		},
+		{
+			name:   "exception",
+			stream: [][]byte{coilsRequest, exceptionResponse},
+			want:   []string{"slave=2 ReadCoils address=0 quantity=3 exception=0x02(IllegalDataAddress) latency="},
+		},
+		{
+			name:   "request without response",
+			stream: [][]byte{readRequest, coilsRequest, coilsResponse},
+			want:   []string{"slave=1 ReadHoldingRegisters address=10 quantity=2 no response", "slave=2 ReadCoils address=0 quantity=3 coils=[true false true] latency="},
+		},
+		{
+			name:   "broadcast",
+			stream: [][]byte{broadcast, readRequest, readResponse},
+			want:   []string{"slave=0 WriteSingleRegister address=1 quantity=1 registers=[5] no response", "slave=1 ReadHoldingRegisters address=10 quantity=2 registers=[7 8] latency="},
+		},
+		{
+			name:    "resync after noise",
+			stream:  [][]byte{{0xFF, 0x00, 0x13}, readRequest, {0xAA}, readResponse},
+			want:    []string{"slave=1 ReadHoldingRegisters address=10 quantity=2 registers=[7 8] latency="},
+			skipped: 4,
+		},
+		{
+			name:    "corrupted response",
+			stream:  [][]byte{readRequest, append(readResponse[:len(readResponse)-1:len(readResponse)-1], 0x00)},
+			want:    []string{"slave=1 ReadHoldingRegisters address=10 quantity=2 no response"},
+			skipped: len(readResponse),
+		},
+		{
+			name:   "response without request",
+			stream: [][]byte{writeEcho[:3], writeEcho},
+			want:   []string{"slave=1 WriteSingleRegister address=1 quantity=1 registers=[5] no response"},
+			//残缺的3个字节被丢弃
+			skipped: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sniffer := NewSniffer(bytes.NewReader(slices.Concat(test.stream...)), FrameRTU)
+			transactions := sniffAll(t, sniffer)
+			if len(transactions) != len(test.want) {
+				t.Fatalf("%d transactions, want %d: %v", len(transactions), len(test.want), transactions)
+			}
+			for index, transaction := range transactions {
+				if got := transaction.String(); !strings.HasPrefix(got, test.want[index]) {
+					t.Fatalf("transaction %d = %q, want %q", index, got, test.want[index])
+				}
+			}
+			if sniffer.Skipped() != test.skipped {
+				t.Fatalf("Skipped = %d, want %d", sniffer.Skipped(), test.skipped)
+			}
+		})
+	}
+}
+
+func TestSnifferTCP(t *testing.T) {
+	stream := slices.Concat(
+		BuildTCPFrame(1, 1, []byte{0x03, 0x00, 0x00, 0x00, 0x01}),
+		BuildTCPFrame(2, 1, []byte{0x04, 0x00, 0x05, 0x00, 0x01}),
+		BuildTCPFrame(3, 1, []byte{0x03, 0x00, 0x09, 0x00, 0x01}),
+		//响应乱序到达
+		BuildTCPFrame(2, 1, []byte{0x04, 0x02, 0x00, 0x2A}),
+		BuildTCPFrame(1, 1, []byte{0x03, 0x02, 0x00, 0x07}),
+		BuildTCPFrame(9, 1, []byte{0x83, 0x02}),
+	)
+	transactions := sniffAll(t, NewSniffer(bytes.NewReader(stream), FrameTCP))
+	want := []struct {
+		request  uint16
+		response uint16
+		text     string
+	}{
+		{2, 2, "slave=1 ReadInputRegisters address=5 quantity=1 registers=[42] latency="},
+		{1, 1, "slave=1 ReadHoldingRegisters address=0 quantity=1 registers=[7] latency="},
+		{0, 9, "slave=1 ReadHoldingRegisters exception=0x02(IllegalDataAddress)"},
+		{3, 0, "slave=1 ReadHoldingRegisters address=9 quantity=1 no response"},
+	}
+	if len(transactions) != len(want) {
+		t.Fatalf("%d transactions, want %d: %v", len(transactions), len(want), transactions)
+	}
+	for index, transaction := range transactions {
+		var request, response uint16
+		if transaction.Request != nil {
+			request = transaction.Request.TransactionId
+		}
+		if transaction.Response != nil {
+			response = transaction.Response.TransactionId
+		}
+		if request != want[index].request || response != want[index].response || !strings.HasPrefix(transaction.String(), want[index].text) {
+			t.Fatalf("transaction %d = %d/%d %q, want %d/%d %q", index, request, response, transaction, want[index].request, want[index].response, want[index].text)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package statute
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ByteOrder 多寄存器数值的字节序，以大端的ABCD为基准
+type ByteOrder string
+
+const (
+	ABCD ByteOrder = "ABCD" //大端
+	DCBA ByteOrder = "DCBA" //小端
+	BADC ByteOrder = "BADC" //大端，字内字节交换
+	CDAB ByteOrder = "CDAB" //小端，字交换
+)
+
+// ParseByteOrder 解析字节序，不区分大小写
+func ParseByteOrder(s string) (ByteOrder, error) {
+	order := ByteOrder(strings.ToUpper(s))
+	switch order {
+	case ABCD, DCBA, BADC, CDAB:
+		return order, nil
+	}
+	return "", fmt.Errorf("invalid byte order:%s", s)
+}
+
+// ValueType 寄存器数值类型
+type ValueType string
+
+const (
+	Uint16  ValueType = "uint16"
+	Int16   ValueType = "int16"
+	Uint32  ValueType = "uint32"
+	Int32   ValueType = "int32"
+	Float32 ValueType = "float32"
+	Uint64  ValueType = "uint64"
+	Int64   ValueType = "int64"
+	Float64 ValueType = "float64"
+)
+
+// ParseValueType 解析数值类型，不区分大小写
+func ParseValueType(s string) (ValueType, error) {
+	valueType := ValueType(strings.ToLower(s))
+	if valueType.Registers() == 0 {
+		return "", fmt.Errorf("invalid value type:%s", s)
+	}
+	return valueType, nil
+}
+
+// Registers 该类型占用的寄存器数量，未知类型返回0
+func (v ValueType) Registers() int {
+	switch v {
+	case Uint16, Int16:
+		return 1
+	case Uint32, Int32, Float32:
+		return 2
+	case Uint64, Int64, Float64:
+		return 4
+	}
+	return 0
+}
+
+// 在设备字节序和大端之间转换，四种字节序的转换都是自反的
+func reorder(data []byte, order ByteOrder) []byte {
+	result := slices.Clone(data)
+	switch order {
+	case DCBA:
+		slices.Reverse(result)
+	case BADC:
+		for index := 0; index+1 < len(result); index += 2 {
+			result[index], result[index+1] = result[index+1], result[index]
+		}
+	case CDAB:
+		for left, right := 0, len(result)-2; left < right; left, right = left+2, right-2 {
+			result[left], result[left+1], result[right], result[right+1] = result[right], result[right+1], result[left], result[left+1]
+		}
+	}
+	return result
+}
+
+// DecodeValue 将寄存器数据按类型和字节序解码为一个值
+// 返回值的实际类型与valueType对应，如Float32返回float32
+func DecodeValue(data []byte, valueType ValueType, order ByteOrder) (any, error) {
+	size := valueType.Registers() * 2
+	if size == 0 {
+		return nil, fmt.Errorf("invalid value type:%s", valueType)
+	}
+	if len(data) != size {
+		return nil, errors.New("invalid data length")
+	}
+	data = reorder(data, order)
+	switch valueType {
+	case Uint16:
+		return binary.BigEndian.Uint16(data), nil
+	case Int16:
+		return int16(binary.BigEndian.Uint16(data)), nil
+	case Uint32:
+		return binary.BigEndian.Uint32(data), nil
+	case Int32:
+		return int32(binary.BigEndian.Uint32(data)), nil
+	case Float32:
+		return math.Float32frombits(binary.BigEndian.Uint32(data)), nil
+	case Uint64:
+		return binary.BigEndian.Uint64(data), nil
+	case Int64:
+		return int64(binary.BigEndian.Uint64(data)), nil
+	default:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	}
+}
+
+// DecodeValues 将连续的寄存器数据按类型和字节序解码为多个值
+func DecodeValues(data []byte, valueType ValueType, order ByteOrder) ([]any, error) {
+	size := valueType.Registers() * 2
+	if size == 0 {
+		return nil, fmt.Errorf("invalid value type:%s", valueType)
+	}
+	if len(data)%size != 0 {
+		return nil, errors.New("invalid data length")
+	}
+	values := make([]any, 0, len(data)/size)
+	for offset := 0; offset < len(data); offset += size {
+		value, err := DecodeValue(data[offset:offset+size], valueType, order)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// ValueRangeError 值超出类型的范围
+var ValueRangeError = errors.New("value out of range")
+
+// ParseValue 按类型解析字符串，整数支持0x前缀，超出类型范围时返回ValueRangeError
+// 返回值的实际类型与valueType对应，如Uint16返回uint16
+func ParseValue(s string, valueType ValueType) (any, error) {
+	bits := valueType.Registers() * 16
+	if bits == 0 {
+		return nil, fmt.Errorf("invalid value type:%s", valueType)
+	}
+	var value any
+	var err error
+	switch valueType {
+	case Uint16, Uint32, Uint64:
+		var v uint64
+		v, err = strconv.ParseUint(s, 0, bits)
+		if _, signed := strconv.ParseInt(s, 0, 64); err != nil && signed == nil {
+			//负数
+			err = strconv.ErrRange
+		}
+		value = narrowUint(v, valueType)
+	case Int16, Int32, Int64:
+		var v int64
+		v, err = strconv.ParseInt(s, 0, bits)
+		value = narrowInt(v, valueType)
+	case Float32:
+		var v float64
+		v, err = strconv.ParseFloat(s, 32)
+		value = float32(v)
+	default:
+		value, err = strconv.ParseFloat(s, 64)
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, fmt.Errorf("%w: %s for %s", ValueRangeError, s, valueType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q", valueType, s)
+	}
+	return value, nil
+}
+
+func narrowUint(v uint64, valueType ValueType) any {
+	switch valueType {
+	case Uint16:
+		return uint16(v)
+	case Uint32:
+		return uint32(v)
+	}
+	return v
+}
+
+func narrowInt(v int64, valueType ValueType) any {
+	switch valueType {
+	case Int16:
+		return int16(v)
+	case Int32:
+		return int32(v)
+	}
+	return v
+}
+
+// EncodeValue 将一个值按类型和字节序编码为寄存器
+// value可以是任意整数或浮点类型，也可以是字符串(按ParseValue解析)
+// 整数类型会截断浮点值的小数部分，值超出类型范围时返回ValueRangeError
+func EncodeValue(value any, valueType ValueType, order ByteOrder) ([]uint16, error) {
+	size := valueType.Registers() * 2
+	if size == 0 {
+		return nil, fmt.Errorf("invalid value type:%s", valueType)
+	}
+	if s, ok := value.(string); ok {
+		parsed, err := ParseValue(s, valueType)
+		if err != nil {
+			return nil, err
+		}
+		value = parsed
+	}
+	data := make([]byte, size)
+	switch valueType {
+	case Uint16, Uint32, Uint64:
+		v, err := toUint(value, size*8)
+		if err != nil {
+			return nil, fmt.Errorf("%w for %s", err, valueType)
+		}
+		putUint(data, v)
+	case Int16, Int32, Int64:
+		v, err := toInt(value, size*8)
+		if err != nil {
+			return nil, fmt.Errorf("%w for %s", err, valueType)
+		}
+		putUint(data, uint64(v))
+	case Float32:
+		v, err := toFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		if !math.IsInf(v, 0) && !math.IsNaN(v) && math.Abs(v) > math.MaxFloat32 {
+			return nil, fmt.Errorf("%w: %v for %s", ValueRangeError, v, valueType)
+		}
+		binary.BigEndian.PutUint32(data, math.Float32bits(float32(v)))
+	case Float64:
+		v, err := toFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint64(data, math.Float64bits(v))
+	}
+	return BytesToRegisters(reorder(data, order)), nil
+}
+
+// 按data的长度写入大端整数
+func putUint(data []byte, v uint64) {
+	switch len(data) {
+	case 2:
+		binary.BigEndian.PutUint16(data, uint16(v))
+	case 4:
+		binary.BigEndian.PutUint32(data, uint32(v))
+	default:
+		binary.BigEndian.PutUint64(data, v)
+	}
+}
+
+// 转换为bits位无符号整数，超出范围时返回ValueRangeError
+func toUint(value any, bits int) (uint64, error) {
+	v := reflect.ValueOf(value)
+	var result uint64
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		result = v.Uint()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return 0, fmt.Errorf("%w: %d", ValueRangeError, v.Int())
+		}
+		result = uint64(v.Int())
+	case reflect.Float32, reflect.Float64:
+		f := math.Trunc(v.Float())
+		if math.IsNaN(f) || f < 0 || f >= math.Ldexp(1, bits) {
+			return 0, fmt.Errorf("%w: %v", ValueRangeError, v.Float())
+		}
+		return uint64(f), nil
+	default:
+		return 0, fmt.Errorf("invalid value %v", value)
+	}
+	if bits < 64 && result >= 1<<bits {
+		return 0, fmt.Errorf("%w: %d", ValueRangeError, result)
+	}
+	return result, nil
+}
+
+// 转换为bits位有符号整数，超出范围时返回ValueRangeError
+func toInt(value any, bits int) (int64, error) {
+	v := reflect.ValueOf(value)
+	var result int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		result = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%w: %d", ValueRangeError, v.Uint())
+		}
+		result = int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := math.Trunc(v.Float())
+		limit := math.Ldexp(1, bits-1)
+		if math.IsNaN(f) || f < -limit || f >= limit {
+			return 0, fmt.Errorf("%w: %v", ValueRangeError, v.Float())
+		}
+		return int64(f), nil
+	default:
+		return 0, fmt.Errorf("invalid value %v", value)
+	}
+	if bits < 64 && (result < -1<<(bits-1) || result >= 1<<(bits-1)) {
+		return 0, fmt.Errorf("%w: %d", ValueRangeError, result)
+	}
+	return result, nil
+}
+
+// 转换为浮点数
+func toFloat(value any) (float64, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	}
+	return 0, fmt.Errorf("invalid value %v", value)
+}
+
+// BytesToRegisters 将大端字节转换为寄存器值，长度为奇数时末尾补0
+func BytesToRegisters(data []byte) []uint16 {
+	registers := make([]uint16, (len(data)+1)/2)
+	for index := range registers {
+		registers[index] = uint16(data[index*2]) << 8
+		if index*2+1 < len(data) {
+			registers[index] |= uint16(data[index*2+1])
+		}
+	}
+	return registers
+}
+
+// RegistersToBytes 将寄存器值转换为大端字节
+func RegistersToBytes(registers []uint16) []byte {
+	data := make([]byte, len(registers)*2)
+	for index, register := range registers {
+		binary.BigEndian.PutUint16(data[index*2:], register)
+	}
+	return data
+}
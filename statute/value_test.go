@@ -0,0 +1,185 @@
+package statute
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestValueByteOrder(t *testing.T) {
+	tests := []struct {
+		order     ByteOrder
+		valueType ValueType
+		value     float64
+		want      any
+		registers []uint16
+	}{
+		{ABCD, Uint32, 0x01020304, uint32(0x01020304), []uint16{0x0102, 0x0304}},
+		{DCBA, Uint32, 0x01020304, uint32(0x01020304), []uint16{0x0403, 0x0201}},
+		{BADC, Uint32, 0x01020304, uint32(0x01020304), []uint16{0x0201, 0x0403}},
+		{CDAB, Uint32, 0x01020304, uint32(0x01020304), []uint16{0x0304, 0x0102}},
+		{CDAB, Uint64, 0x0001000200030004, uint64(0x0001000200030004), []uint16{0x0004, 0x0003, 0x0002, 0x0001}},
+		{ABCD, Int16, -2, int16(-2), []uint16{0xFFFE}},
+		{DCBA, Int16, -2, int16(-2), []uint16{0xFEFF}},
+		{ABCD, Int32, -1, int32(-1), []uint16{0xFFFF, 0xFFFF}},
+		{ABCD, Float32, 1.5, float32(1.5), []uint16{0x3FC0, 0x0000}},
+		{CDAB, Float32, 1.5, float32(1.5), []uint16{0x0000, 0x3FC0}},
+		{ABCD, Float64, 1.5, 1.5, []uint16{0x3FF8, 0, 0, 0}},
+		{ABCD, Int64, -1, int64(-1), []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}},
+		{ABCD, Uint16, 0x1234, uint16(0x1234), []uint16{0x1234}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.order)+" "+string(test.valueType), func(t *testing.T) {
+			registers, err := EncodeValue(test.value, test.valueType, test.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(registers, test.registers) {
+				t.Fatalf("EncodeValue = %04x, want %04x", registers, test.registers)
+			}
+			value, err := DecodeValue(RegistersToBytes(registers), test.valueType, test.order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != test.want {
+				t.Fatalf("DecodeValue = %v (%T), want %v (%T)", value, value, test.want, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeValues(t *testing.T) {
+	values, err := DecodeValues([]byte{0x00, 0x01, 0xFF, 0xFF}, Int16, ABCD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []any{int16(1), int16(-1)}) {
+		t.Fatalf("DecodeValues = %v", values)
+	}
+	if _, err = DecodeValues([]byte{0x00, 0x01, 0x00}, Uint32, ABCD); err == nil {
+		t.Fatal("DecodeValues with a partial value succeeded")
+	}
+	if _, err = DecodeValue([]byte{0x00, 0x01}, Float32, ABCD); err == nil {
+		t.Fatal("DecodeValue with a short buffer succeeded")
+	}
+	if _, err = DecodeValue([]byte{0x00, 0x01}, "int8", ABCD); err == nil {
+		t.Fatal("DecodeValue with an unknown type succeeded")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		s         string
+		valueType ValueType
+		want      any
+		rangeErr  bool
+	}{
+		{"65535", Uint16, uint16(65535), false},
+		{"0x10", Uint16, uint16(16), false},
+		{"65536", Uint16, nil, true},
+		{"-1", Uint32, nil, true},
+		{"4294967295", Uint32, uint32(4294967295), false},
+		{"18446744073709551615", Uint64, uint64(math.MaxUint64), false},
+		{"-32768", Int16, int16(-32768), false},
+		{"32768", Int16, nil, true},
+		{"-0x10", Int32, int32(-16), false},
+		{"-9223372036854775808", Int64, int64(math.MinInt64), false},
+		{"1.5", Float32, float32(1.5), false},
+		{"1e39", Float32, nil, true},
+		{"1e39", Float64, 1e39, false},
+	}
+	for _, test := range tests {
+		t.Run(test.s+" "+string(test.valueType), func(t *testing.T) {
+			value, err := ParseValue(test.s, test.valueType)
+			if test.rangeErr {
+				if !errors.Is(err, ValueRangeError) {
+					t.Fatalf("ParseValue = %v, %v, want ValueRangeError", value, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != test.want {
+				t.Fatalf("ParseValue = %v (%T), want %v (%T)", value, value, test.want, test.want)
+			}
+		})
+	}
+	if _, err := ParseValue("abc", Int16); err == nil || errors.Is(err, ValueRangeError) {
+		t.Fatalf("ParseValue abc = %v", err)
+	}
+	if _, err := ParseValue("1", "int8"); err == nil {
+		t.Fatal("ParseValue with an unknown type succeeded")
+	}
+}
+
+func TestEncodeValueInputs(t *testing.T) {
+	tests := []struct {
+		value     any
+		valueType ValueType
+		registers []uint16
+		rangeErr  bool
+	}{
+		{"0x1234", Uint16, []uint16{0x1234}, false},
+		{"-2", Int16, []uint16{0xFFFE}, false},
+		{"1.5", Float32, []uint16{0x3FC0, 0x0000}, false},
+		{uint8(7), Uint16, []uint16{0x0007}, false},
+		{-2, Int32, []uint16{0xFFFF, 0xFFFE}, false},
+		{uint64(5), Int16, []uint16{0x0005}, false},
+		{12.9, Uint16, []uint16{0x000C}, false},
+		{3, Float32, []uint16{0x4040, 0x0000}, false},
+		{65536, Uint16, nil, true},
+		{-1, Uint16, nil, true},
+		{32768, Int16, nil, true},
+		{uint64(math.MaxUint64), Int64, nil, true},
+		{-0.5e5, Uint32, nil, true},
+		{1e39, Float32, nil, true},
+		{"65536", Uint16, nil, true},
+	}
+	for _, test := range tests {
+		registers, err := EncodeValue(test.value, test.valueType, ABCD)
+		if test.rangeErr {
+			if !errors.Is(err, ValueRangeError) {
+				t.Fatalf("EncodeValue(%v, %s) = %04x, %v, want ValueRangeError", test.value, test.valueType, registers, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("EncodeValue(%v, %s): %v", test.value, test.valueType, err)
+		}
+		if !reflect.DeepEqual(registers, test.registers) {
+			t.Fatalf("EncodeValue(%v, %s) = %04x, want %04x", test.value, test.valueType, registers, test.registers)
+		}
+	}
+	if _, err := EncodeValue(true, Uint16, ABCD); err == nil {
+		t.Fatal("EncodeValue with a bool succeeded")
+	}
+}
+
+func TestParseValueNames(t *testing.T) {
+	if order, err := ParseByteOrder("cdab"); err != nil || order != CDAB {
+		t.Fatalf("ParseByteOrder = %s, %v", order, err)
+	}
+	if _, err := ParseByteOrder("ACBD"); err == nil {
+		t.Fatal("ParseByteOrder accepted ACBD")
+	}
+	if valueType, err := ParseValueType("Float32"); err != nil || valueType != Float32 || valueType.Registers() != 2 {
+		t.Fatalf("ParseValueType = %s, %v", valueType, err)
+	}
+	if _, err := ParseValueType("int8"); err == nil {
+		t.Fatal("ParseValueType accepted int8")
+	}
+}
+
+func TestRegistersBytes(t *testing.T) {
+	if registers := BytesToRegisters([]byte{0x01, 0x02, 0x03}); !reflect.DeepEqual(registers, []uint16{0x0102, 0x0300}) {
+		t.Fatalf("BytesToRegisters = %04x", registers)
+	}
+	if data := RegistersToBytes([]uint16{0x0102, 0x0304}); !reflect.DeepEqual(data, []byte{1, 2, 3, 4}) {
+		t.Fatalf("RegistersToBytes = % x", data)
+	}
+	if value, _ := DecodeValue([]byte{0x7F, 0xC0, 0x00, 0x00}, Float32, ABCD); !math.IsNaN(float64(value.(float32))) {
+		t.Fatalf("DecodeValue NaN = %v", value)
+	}
+}
@@ -0,0 +1,50 @@
+package go_modbus
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// TransportStream 任意字节流
+const TransportStream = "stream"
+
+// 支持读写超时的字节流，如net.Conn
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// NewModbusStreamPacket 创建一个在已打开的字节流上收发的连接，可用于内存管道、虚拟串口和串口服务器隧道
+// rwc 字节流，实现SetReadDeadline和SetWriteDeadline(如net.Conn)时读写超时生效，否则读取会一直阻塞直到有数据或Close
+// readTimeout 读超时，同时作为写超时
+// rwInterval 读写间隔
+// modbusType 协议类型，决定字节流上的帧格式
+// 返回的连接已经可以使用，Close会关闭rwc，之后不能再次连接
+func NewModbusStreamPacket(rwc io.ReadWriteCloser, readTimeout, rwInterval time.Duration, modbusType StatuteType) (*ModbusRTUPacket, error) {
+	if rwc == nil {
+		return nil, errors.New("stream can not be nil")
+	}
+	tc, err := NewModbusRTUPacket("", 0, 0, ParityNone, 0, readTimeout, rwInterval, modbusType)
+	if err != nil {
+		return nil, err
+	}
+	tc.transport = TransportStream
+	tc.given = &givenStream{ReadWriteCloser: rwc}
+	tc.attach(tc.given)
+	return tc, nil
+}
+
+// 外部传入的字节流，记录是否已关闭
+type givenStream struct {
+	io.ReadWriteCloser
+	closed atomic.Bool
+}
+
+func (s *givenStream) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	return s.ReadWriteCloser.Close()
+}
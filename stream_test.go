@@ -0,0 +1,158 @@
+package go_modbus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 不支持读写超时的字节流，读取会一直阻塞直到有数据或关闭
+type blockingStream struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (s *blockingStream) Close() error {
+	_ = s.PipeWriter.Close()
+	return s.PipeReader.Close()
+}
+
+// 返回客户端一端，设备一端只读取不应答
+func silentStream(t *testing.T) io.ReadWriteCloser {
+	clientReader, deviceWriter := io.Pipe()
+	deviceReader, clientWriter := io.Pipe()
+	t.Cleanup(func() {
+		_ = deviceWriter.Close()
+		_ = deviceReader.Close()
+	})
+	go func() {
+		_, _ = io.Copy(io.Discard, deviceReader)
+	}()
+	return &blockingStream{PipeReader: clientReader, PipeWriter: clientWriter}
+}
+
+// 在net.Pipe的设备一端应答RTU读写请求
+func serveRTUStream(t *testing.T, device *registerDevice) net.Conn {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	go func() {
+		request := make([]byte, 8)
+		for {
+			if _, err := io.ReadFull(server, request); err != nil {
+				return
+			}
+			if response := device.respond(request); response != nil {
+				if _, err := server.Write(response); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return client
+}
+
+// 记录写入次数的包装
+type countingStream struct {
+	io.ReadWriteCloser
+	writes atomic.Int32
+}
+
+func (s *countingStream) Write(p []byte) (int, error) {
+	s.writes.Add(1)
+	return s.ReadWriteCloser.Write(p)
+}
+
+func TestStreamPacket(t *testing.T) {
+	device := &registerDevice{rtu: true, registers: []uint16{1, 2, 3}}
+	packet, err := NewModbusStreamPacket(serveRTUStream(t, device), 50*time.Millisecond, 0, ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//创建后不需要Connect
+	data, err := packet.ReadHoldingRegisters(1, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, 2, 0, 3}) {
+		t.Fatalf("ReadHoldingRegisters = % x", data)
+	}
+	if err = packet.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	counter := &countingStream{}
+	packet.WrapPort(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		counter.ReadWriteCloser = rwc
+		return counter
+	})
+	if _, _, err = packet.WriteSingleRegister(1, 0, 9); err != nil {
+		t.Fatal(err)
+	}
+	if counter.writes.Load() != 1 {
+		t.Fatalf("wrapped stream saw %d writes, want 1", counter.writes.Load())
+	}
+	//从站2不应答，net.Pipe的读超时生效
+	if _, err = packet.ReadHoldingRegisters(2, 0, 1); !isTimeout(err) {
+		t.Fatalf("error = %v, want timeout", err)
+	}
+	if err = packet.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = packet.ReadHoldingRegisters(1, 0, 1); err != nil || !bytes.Equal(data, []byte{0, 9}) {
+		t.Fatalf("ReadHoldingRegisters = % x, %v", data, err)
+	}
+	if err = packet.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = packet.Connect(); !errors.Is(err, NoConnectionError) {
+		t.Fatalf("Connect after Close = %v, want NoConnectionError", err)
+	}
+	if _, err = packet.ReadHoldingRegisters(1, 0, 1); !errors.Is(err, NoConnectionError) {
+		t.Fatalf("read after Close = %v, want NoConnectionError", err)
+	}
+	if _, err = NewModbusStreamPacket(nil, time.Second, 0, ModbusRTU); err == nil {
+		t.Fatal("NewModbusStreamPacket accepted a nil stream")
+	}
+}
+
+func TestCloseUnblocksRead(t *testing.T) {
+	for _, modbusType := range []StatuteType{ModbusTCP, ModbusRTU} {
+		t.Run(string(modbusType), func(t *testing.T) {
+			client, err := NewModbusStreamPacket(silentStream(t), time.Second, 0, modbusType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() {
+				_, err := client.ReadHoldingRegisters(1, 0, 1)
+				done <- err
+			}()
+			time.Sleep(20 * time.Millisecond)
+			closed := make(chan error, 1)
+			go func() {
+				closed <- client.Close()
+			}()
+			select {
+			case err = <-closed:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Close blocked by the pending read")
+			}
+			select {
+			case err = <-done:
+				if err == nil {
+					t.Fatal("read succeeded after Close")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("read still blocked after Close")
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package go_modbus
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/VaccariaSeed/go-modbus/statute"
@@ -26,6 +30,7 @@ const (
 	defaultConnectTimeout = 3 * time.Second
 	defaultReadTimeout    = 2 * time.Second
 	defaultWriteTimeout   = 2 * time.Second
+	flushTimeout          = 10 * time.Millisecond
 )
 
 // NewModbusTCPPacket 创建一个TCP连接
@@ -42,7 +47,7 @@ func NewModbusTCPPacket(ip string, port int, connectTimeout, readTimeout, writeT
 	if rwInterval <= 0 {
 		rwInterval = defaultRwTimeout
 	}
-	tc := &ModbusTCPPacket{ip: ip, port: port, connectTimeout: connectTimeout, readTimeout: readTimeout, writeTimeout: writeTimeout, ModbusPacket: &ModbusPacket{rwInterval: rwInterval}}
+	tc := &ModbusTCPPacket{network: "tcp", ip: ip, port: port, connectTimeout: connectTimeout, readTimeout: readTimeout, writeTimeout: writeTimeout, ModbusPacket: &ModbusPacket{rwInterval: rwInterval, transport: TransportTCP, unit: defaultUnit}}
 	switch modbusType {
 	case ModbusTCP:
 		tc.ModbusCodec = statute.NewModbusTCPCodec()
@@ -51,33 +56,296 @@ func NewModbusTCPPacket(ip string, port int, connectTimeout, readTimeout, writeT
 	default:
 		return nil, errors.New("modbus type not supported")
 	}
+	tc.statuteType = modbusType
 	tc.ModbusPacket.read = tc.read
 	tc.ModbusPacket.write = tc.write
+	tc.ModbusPacket.flush = tc.flush
 	return tc, nil
 }
 
-// ModbusTCPPacket MODBUS TCP
+// NewModbusUDPPacket 创建一个UDP连接，每个请求和响应各占一个数据报
+func NewModbusUDPPacket(ip string, port int, readTimeout, writeTimeout, rwInterval time.Duration, modbusType StatuteType) (*ModbusTCPPacket, error) {
+	tc, err := NewModbusTCPPacket(ip, port, 0, readTimeout, writeTimeout, rwInterval, modbusType)
+	if err != nil {
+		return nil, err
+	}
+	tc.network = "udp"
+	tc.transport = TransportUDP
+	return tc, nil
+}
+
+// NewModbusConnPacket 在已建立的连接上创建MODBUS连接，如SSH隧道、Unix域套接字等
+// Connect不会重新拨号，连接关闭后Connect返回NoConnectionError
+func NewModbusConnPacket(conn net.Conn, readTimeout, writeTimeout, rwInterval time.Duration, modbusType StatuteType) (*ModbusTCPPacket, error) {
+	if conn == nil {
+		return nil, errors.New("conn can not be nil")
+	}
+	tc, err := NewModbusTCPPacket("", 0, 0, readTimeout, writeTimeout, rwInterval, modbusType)
+	if err != nil {
+		return nil, err
+	}
+	given := &givenConn{Conn: conn}
+	tc.dialer = func(context.Context, string, string) (net.Conn, error) {
+		if given.closed.Load() {
+			return nil, NoConnectionError
+		}
+		return given, nil
+	}
+	tc.attach(given, 0)
+	return tc, nil
+}
+
+// 外部传入的连接，记录是否已关闭
+type givenConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+func (c *givenConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+// DialFunc 自定义拨号函数，可用于SOCKS代理、SSH隧道、Unix域套接字等
+// network为tcp或udp，address为host:port，ctx在连接超时后取消
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// SetDialer 设置自定义拨号函数，nil表示直接拨号
+// 使用自定义拨号时不在本地解析域名，address原样传给dial
+func (T *ModbusTCPPacket) SetDialer(dial DialFunc) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.dialer = dial
+}
+
+// SetKeepAlive 设置TCP保活间隔，0表示使用系统默认，小于0表示关闭
+// 仅对*net.TCPConn生效，自定义拨号返回其他类型的连接时忽略
+func (T *ModbusTCPPacket) SetKeepAlive(period time.Duration) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.keepAlive = period
+}
+
+// ModbusTCPPacket MODBUS TCP，也用于UDP
 type ModbusTCPPacket struct {
 	*ModbusPacket
+	network        string //tcp或udp
 	ip             string
 	port           int
 	connectTimeout time.Duration //连接超时
 	readTimeout    time.Duration //读超时
 	writeTimeout   time.Duration //写超时
-	conn           *net.TCPConn
+	conn           net.Conn
 	reader         *bufio.Reader
+	wrap           func(net.Conn) net.Conn //连接包装
+	dialer         DialFunc                //自定义拨号
+	keepAlive      time.Duration           //TCP保活间隔
+	tlsConfig      *tls.Config             //TLS配置，nil表示不加密
+	tlsConn        *tls.Conn               //当前的TLS连接
+
+	failover   *FailoverPolicy //冗余端点
+	active     int             //当前连接的端点序号，0为主端点
+	failures   int             //连续失败次数
+	switchedAt time.Time       //切换到冗余端点的时间
+	lost       bool            //所有端点都不可用，下次请求时重新尝试
+}
+
+// Endpoint 网络端点，Host可以是ipv4、ipv6或域名
+type Endpoint struct {
+	Host string
+	Port int
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// FailoverPolicy 冗余端点策略，用于双网口的PLC等
+// 当前端点连续Failures次请求超时或连接断开后，依次切换到下一个可用的端点
+type FailoverPolicy struct {
+	Backups  []Endpoint    //冗余端点，按顺序尝试
+	Failures int           //连续失败多少次后切换，默认1
+	FailBack time.Duration //切换后每隔多久尝试回到主端点，0表示不回切
+}
+
+// SetFailover 设置冗余端点，Connect时依次尝试主端点和冗余端点，nil表示取消
+func (T *ModbusTCPPacket) SetFailover(policy *FailoverPolicy) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.failover = policy
+	T.failures = 0
+}
+
+// ActiveEndpoint 返回当前连接的端点
+func (T *ModbusTCPPacket) ActiveEndpoint() Endpoint {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	return T.endpoints()[T.active]
+}
+
+// 主端点和冗余端点
+func (T *ModbusTCPPacket) endpoints() []Endpoint {
+	endpoints := []Endpoint{{Host: T.ip, Port: T.port}}
+	if T.failover != nil {
+		endpoints = append(endpoints, T.failover.Backups...)
+	}
+	return endpoints
+}
+
+// WrapConn 设置连接包装函数，Connect时对新建立的连接调用，可用于故障注入等
+func (T *ModbusTCPPacket) WrapConn(wrap func(net.Conn) net.Conn) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.wrap = wrap
 }
 
 func (T *ModbusTCPPacket) Connect() error {
 	T.lock.Lock()
 	defer T.lock.Unlock()
-	conn, err := net.DialTimeout("tcp", T.ip+":"+strconv.Itoa(T.port), T.connectTimeout)
+	return T.connectFrom(0)
+}
+
+// 从第start个端点开始依次尝试连接，调用方需持有锁
+func (T *ModbusTCPPacket) connectFrom(start int) error {
+	endpoints := T.endpoints()
+	var errs []error
+	for offset := range endpoints {
+		index := (start + offset) % len(endpoints)
+		conn, err := T.open(endpoints[index])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		T.attach(conn, index)
+		return nil
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// 连接端点，设置保活并按需进行TLS握手
+func (T *ModbusTCPPacket) open(endpoint Endpoint) (net.Conn, error) {
+	conn, err := T.dial(endpoint)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok && T.keepAlive != 0 {
+		_ = tcp.SetKeepAlive(T.keepAlive > 0)
+		if T.keepAlive > 0 {
+			_ = tcp.SetKeepAlivePeriod(T.keepAlive)
+		}
+	}
+	if T.tlsConfig == nil {
+		return conn, nil
+	}
+	return T.handshake(conn, endpoint)
+}
+
+// 解析端点的所有地址并依次尝试，域名解析和所有地址共用一个连接超时
+func (T *ModbusTCPPacket) dial(endpoint Endpoint) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), T.connectTimeout)
+	defer cancel()
+	if T.dialer != nil {
+		return T.dialer(ctx, T.network, endpoint.String())
 	}
-	T.conn = conn.(*net.TCPConn)
+	addrs, err := net.DefaultResolver.LookupHost(ctx, strings.Trim(endpoint.Host, "[]"))
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for index, addr := range addrs {
+		conn, err := dialAddr(ctx, T.network, net.JoinHostPort(addr, strconv.Itoa(endpoint.Port)), len(addrs)-index)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, errors.Join(errs...)
+}
+
+// 连接一个地址，剩余时间在剩下的remaining个地址间平分，避免一个不可达的地址用完全部超时
+func dialAddr(ctx context.Context, network, address string, remaining int) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(remaining))
+		defer cancel()
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// 使用新建立的连接，调用方需持有锁
+func (T *ModbusTCPPacket) attach(conn net.Conn, index int) {
+	T.tlsConn, _ = conn.(*tls.Conn)
+	if T.wrap != nil {
+		conn = T.wrap(conn)
+	}
+	T.conn = conn
 	T.reader = bufio.NewReader(conn)
-	return nil
+	T.failures = 0
+	T.lost = false
+	if index != T.active {
+		T.active = index
+		T.switchedAt = time.Now()
+	}
+}
+
+// 记录一次请求的结果，连续失败达到阈值时切换到下一个端点，调用方需持有锁
+func (T *ModbusTCPPacket) record(err error) {
+	if T.failover == nil {
+		return
+	}
+	if !connectionLost(err) {
+		T.failures = 0
+		return
+	}
+	T.failures++
+	if T.failures < max(T.failover.Failures, 1) {
+		return
+	}
+	_ = T.conn.Close()
+	T.conn, T.reader = nil, nil
+	if T.connectFrom(T.active+1) != nil {
+		T.lost = true
+	}
+}
+
+// 请求前按需重连或回切到主端点，调用方需持有锁
+func (T *ModbusTCPPacket) prepare() {
+	if T.failover == nil {
+		return
+	}
+	if T.lost {
+		_ = T.connectFrom(T.active)
+		return
+	}
+	if T.conn == nil || T.active == 0 || T.failover.FailBack <= 0 || time.Since(T.switchedAt) < T.failover.FailBack {
+		return
+	}
+	conn, err := T.open(T.endpoints()[0])
+	if err != nil {
+		T.switchedAt = time.Now()
+		return
+	}
+	_ = T.conn.Close()
+	T.attach(conn, 0)
+}
+
+// 超时或连接断开，视为端点不可用
+func connectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	return isTimeout(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) || errors.As(err, &opErr)
 }
 
 func (T *ModbusTCPPacket) Close() error {
@@ -85,6 +353,8 @@ func (T *ModbusTCPPacket) Close() error {
 	defer func() {
 		T.reader = nil
 		T.conn = nil
+		T.tlsConn = nil
+		T.lost = false
 		T.lock.Unlock()
 	}()
 	if T.conn != nil {
@@ -94,6 +364,7 @@ func (T *ModbusTCPPacket) Close() error {
 }
 
 func (T *ModbusTCPPacket) write(frame []byte) (int, error) {
+	T.prepare()
 	if T.conn == nil {
 		return 0, NoConnectionError
 	}
@@ -101,7 +372,11 @@ func (T *ModbusTCPPacket) write(frame []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return T.conn.Write(frame)
+	n, err := T.conn.Write(frame)
+	if err != nil {
+		T.record(err)
+	}
+	return n, err
 }
 
 func (T *ModbusTCPPacket) read() ([]byte, error) {
@@ -112,15 +387,29 @@ func (T *ModbusTCPPacket) read() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return T.ModbusCodec.Decode(T.reader)
+	data, err := T.ModbusCodec.Decode(T.reader)
+	T.record(err)
+	return data, netReadError(err)
 }
 
 func (T *ModbusTCPPacket) Flush() error {
 	T.lock.Lock()
 	defer T.lock.Unlock()
+	return T.flush()
+}
+
+func (T *ModbusTCPPacket) flush() error {
 	if T.conn == nil {
 		return NoConnectionError
 	}
-	_, err := io.ReadAll(T.reader)
+	//丢弃已缓存的数据，再在短时间内读空连接上残留的数据
+	_, _ = T.reader.Discard(T.reader.Buffered())
+	if err := T.conn.SetReadDeadline(time.Now().Add(flushTimeout)); err != nil {
+		return err
+	}
+	_, err := io.Copy(io.Discard, T.reader)
+	if isTimeout(err) {
+		return nil
+	}
 	return err
 }
@@ -0,0 +1,321 @@
+package go_modbus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 可以切换为不应答的设备，保持寄存器0的值用于区分端点
+type switchableDevice struct {
+	device *registerDevice
+	silent atomic.Bool
+	port   int
+}
+
+func newSwitchableDevice(t *testing.T, value uint16) *switchableDevice {
+	d := &switchableDevice{device: &registerDevice{registers: []uint16{value}}}
+	d.port = serveDevice(t, func(request []byte) []byte {
+		if d.silent.Load() {
+			return nil
+		}
+		return d.device.respond(request)
+	})
+	return d
+}
+
+func (d *switchableDevice) endpoint() Endpoint {
+	return Endpoint{Host: "127.0.0.1", Port: d.port}
+}
+
+// 没有监听的端口
+func closedPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func failoverPacket(t *testing.T, port int, policy *FailoverPolicy) *ModbusTCPPacket {
+	t.Helper()
+	packet, err := NewModbusTCPPacket("127.0.0.1", port, time.Second, replayTimeout, time.Second, time.Microsecond, ModbusTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet.SetFailover(policy)
+	if err = packet.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = packet.Close() })
+	return packet
+}
+
+// 读保持寄存器0，返回应答的端点的值，没有应答时返回0
+func readEndpoint(packet *ModbusTCPPacket) uint16 {
+	data, err := packet.ReadHoldingRegisters(1, 0, 1)
+	if err != nil {
+		return 0
+	}
+	return uint16(data[0])<<8 | uint16(data[1])
+}
+
+func TestFailoverConnect(t *testing.T) {
+	backup := newSwitchableDevice(t, 2)
+	//主端点不可用时连接冗余端点
+	packet := failoverPacket(t, closedPort(t), &FailoverPolicy{Backups: []Endpoint{backup.endpoint()}})
+	if packet.ActiveEndpoint() != backup.endpoint() || readEndpoint(packet) != 2 {
+		t.Fatalf("active = %s", packet.ActiveEndpoint())
+	}
+	//所有端点都不可用
+	unreachable, err := NewModbusTCPPacket("127.0.0.1", closedPort(t), time.Second, time.Second, time.Second, 0, ModbusTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable.SetFailover(&FailoverPolicy{Backups: []Endpoint{{Host: "127.0.0.1", Port: closedPort(t)}}})
+	if err = unreachable.Connect(); err == nil {
+		t.Fatal("Connect succeeded without a reachable endpoint")
+	}
+}
+
+func TestFailoverOrder(t *testing.T) {
+	devices := []*switchableDevice{newSwitchableDevice(t, 1), newSwitchableDevice(t, 2), newSwitchableDevice(t, 3)}
+	packet := failoverPacket(t, devices[0].port, &FailoverPolicy{
+		Backups:  []Endpoint{devices[1].endpoint(), devices[2].endpoint()},
+		Failures: 2,
+	})
+	steps := []struct {
+		silent  int //本次请求前停止应答的设备，-1表示不变
+		recover int //本次请求前恢复应答的设备，-1表示不变
+		want    uint16
+	}{
+		{-1, -1, 1},
+		{0, -1, 0},  //第一次超时不切换
+		{-1, -1, 0}, //第二次超时切换到下一个端点
+		{-1, -1, 2},
+		{1, -1, 0},
+		{-1, -1, 0},
+		{-1, -1, 3},
+		//最后一个端点之后回到主端点
+		{2, -1, 0},
+		{-1, -1, 0},
+		{-1, 0, 1},
+	}
+	for index, step := range steps {
+		if step.silent >= 0 {
+			devices[step.silent].silent.Store(true)
+		}
+		if step.recover >= 0 {
+			devices[step.recover].silent.Store(false)
+		}
+		if value := readEndpoint(packet); value != step.want {
+			t.Fatalf("request %d answered by %d, want %d", index, value, step.want)
+		}
+	}
+	if packet.ActiveEndpoint() != devices[0].endpoint() {
+		t.Fatalf("active = %s", packet.ActiveEndpoint())
+	}
+}
+
+func TestFailoverNotForExceptions(t *testing.T) {
+	primary, backup := newSwitchableDevice(t, 1), newSwitchableDevice(t, 2)
+	packet := failoverPacket(t, primary.port, &FailoverPolicy{Backups: []Endpoint{backup.endpoint()}})
+	//异常响应说明端点可用，不切换
+	if _, err := packet.ReadHoldingRegisters(1, 5, 1); !isException(err, 0x02) {
+		t.Fatalf("error = %v", err)
+	}
+	if packet.ActiveEndpoint() != primary.endpoint() {
+		t.Fatalf("active = %s", packet.ActiveEndpoint())
+	}
+}
+
+func TestFailBack(t *testing.T) {
+	primary, backup := newSwitchableDevice(t, 1), newSwitchableDevice(t, 2)
+	packet := failoverPacket(t, primary.port, &FailoverPolicy{Backups: []Endpoint{backup.endpoint()}, FailBack: 3 * replayTimeout})
+	primary.silent.Store(true)
+	if value := readEndpoint(packet); value != 0 {
+		t.Fatalf("silent primary answered %d", value)
+	}
+	primary.silent.Store(false)
+	//回切间隔未到时留在冗余端点
+	if value := readEndpoint(packet); value != 2 {
+		t.Fatalf("answer = %d, want backup", value)
+	}
+	time.Sleep(3 * replayTimeout)
+	if value := readEndpoint(packet); value != 1 {
+		t.Fatalf("answer = %d, want primary", value)
+	}
+	if packet.ActiveEndpoint() != primary.endpoint() {
+		t.Fatalf("active = %s", packet.ActiveEndpoint())
+	}
+}
+
+func TestConnectIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("ipv6 loopback not available:", err)
+	}
+	defer listener.Close()
+	device := &registerDevice{registers: []uint16{6}}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 512)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(device.respond(buf[:n]))
+		}
+	}()
+	config, err := ParseClientURL("tcp://[::1]:" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := config.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if value := readEndpoint(client.(*ModbusTCPPacket)); value != 6 {
+		t.Fatalf("answer = %d", value)
+	}
+}
+
+func TestFailoverConfig(t *testing.T) {
+	config, err := ParseClientURL("tcp://plc-a?backup=plc-b:1502&backup=[fe80::2]&failures=3&failback=1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Backups, []string{"plc-b:1502", "[fe80::2]"}) || config.Failures != 3 || config.FailBack != Duration(time.Minute) {
+		t.Fatalf("config = %+v", config)
+	}
+	client, err := config.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &FailoverPolicy{Backups: []Endpoint{{Host: "plc-b", Port: 1502}, {Host: "fe80::2", Port: defaultPort}}, Failures: 3, FailBack: time.Minute}
+	if policy := client.(*ModbusTCPPacket).failover; !reflect.DeepEqual(policy, want) {
+		t.Fatalf("failover = %+v, want %+v", policy, want)
+	}
+	config.Backups = append(config.Backups, "plc-c:http")
+	if _, err = config.Build(); err == nil {
+		t.Fatal("Build accepted an invalid backup")
+	}
+}
+
+func TestSetDialer(t *testing.T) {
+	device := newSwitchableDevice(t, 4)
+	var addresses []string
+	packet, err := NewModbusTCPPacket("plc.invalid", 1502, time.Second, replayTimeout, time.Second, time.Microsecond, ModbusTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//域名不在本地解析，原样交给拨号函数
+	packet.SetDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+		if _, ok := ctx.Deadline(); !ok || network != "tcp" {
+			return nil, errors.New("dial without deadline")
+		}
+		addresses = append(addresses, address)
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, device.endpoint().String())
+	})
+	packet.SetKeepAlive(time.Minute)
+	if err = packet.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer packet.Close()
+	if value := readEndpoint(packet); value != 4 {
+		t.Fatalf("answer = %d", value)
+	}
+	if !reflect.DeepEqual(addresses, []string{"plc.invalid:1502"}) {
+		t.Fatalf("dialed %v", addresses)
+	}
+}
+
+func TestNewModbusConnPacket(t *testing.T) {
+	if _, err := NewModbusConnPacket(nil, 0, 0, 0, ModbusTCP); err == nil {
+		t.Fatal("NewModbusConnPacket accepted a nil conn")
+	}
+	for _, modbusType := range []StatuteType{ModbusTCP, ModbusRTU} {
+		t.Run(string(modbusType), func(t *testing.T) {
+			client, server := net.Pipe()
+			device := &registerDevice{rtu: modbusType == ModbusRTU, registers: []uint16{8}}
+			go func() {
+				defer server.Close()
+				buf := make([]byte, 512)
+				for {
+					n, err := server.Read(buf)
+					if err != nil {
+						return
+					}
+					if _, err = server.Write(device.respond(buf[:n])); err != nil {
+						return
+					}
+				}
+			}()
+			packet, err := NewModbusConnPacket(client, replayTimeout, time.Second, time.Microsecond, modbusType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			//连接已建立，Connect不重新拨号
+			if err = packet.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			if value := readEndpoint(packet); value != 8 {
+				t.Fatalf("answer = %d", value)
+			}
+			if err = packet.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err = packet.Connect(); !errors.Is(err, NoConnectionError) {
+				t.Fatalf("Connect after Close = %v, want %v", err, NoConnectionError)
+			}
+		})
+	}
+}
+
+func TestDialAddrSharesDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := dialAddr(ctx, "tcp", listener.Addr().String(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	//不可路由的地址只能用剩余时间的1/4
+	ctx, cancel = context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	conn, err = dialAddr(ctx, "tcp", "10.255.255.1:502", 4)
+	elapsed := time.Since(start)
+	if err == nil {
+		_ = conn.Close()
+		t.Skip("unroutable address is reachable in this environment")
+	}
+	if !isTimeout(err) && !errors.Is(err, context.DeadlineExceeded) {
+		t.Skipf("unroutable address failed without a timeout: %v", err)
+	}
+	if elapsed > 250*time.Millisecond {
+		t.Fatalf("dial took %v, want about 100ms", elapsed)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("dialAddr used up the shared deadline")
+	}
+}
@@ -0,0 +1,94 @@
+package go_modbus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// DefaultTLSPort Modbus/TCP Security的默认端口
+const DefaultTLSPort = 802
+
+// SetTLS 启用TLS(Modbus/TCP Security)，nil表示关闭
+// config中的Certificates为客户端证书，RootCAs为校验服务端的CA，版本低于TLS 1.2时强制为TLS 1.2
+// ServerName为空时使用端点的主机名
+func (T *ModbusTCPPacket) SetTLS(config *tls.Config) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	if config == nil {
+		T.tlsConfig = nil
+		return
+	}
+	T.tlsConfig = config.Clone()
+	if T.tlsConfig.MinVersion < tls.VersionTLS12 {
+		T.tlsConfig.MinVersion = tls.VersionTLS12
+	}
+}
+
+// ConnectionState 返回当前TLS连接的状态，未使用TLS或未连接时返回false
+func (T *ModbusTCPPacket) ConnectionState() (tls.ConnectionState, bool) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	if T.tlsConn == nil {
+		return tls.ConnectionState{}, false
+	}
+	return T.tlsConn.ConnectionState(), true
+}
+
+// PeerCertificate 返回服务端的证书，未使用TLS或未连接时返回nil
+func (T *ModbusTCPPacket) PeerCertificate() *x509.Certificate {
+	state, ok := T.ConnectionState()
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// 在已建立的连接上进行TLS握手，握手失败时关闭连接
+func (T *ModbusTCPPacket) handshake(conn net.Conn, endpoint Endpoint) (net.Conn, error) {
+	if T.network != "tcp" {
+		_ = conn.Close()
+		return nil, errors.New("tls requires a tcp connection")
+	}
+	config := T.tlsConfig
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = strings.Trim(endpoint.Host, "[]")
+	}
+	tlsConn := tls.Client(conn, config)
+	ctx, cancel := context.WithTimeout(context.Background(), T.connectTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// 按证书文件创建TLS配置
+func (c *ClientConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CAFile)
+		}
+	}
+	return config, nil
+}
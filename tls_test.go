@@ -0,0 +1,222 @@
+package go_modbus_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	modbus "github.com/VaccariaSeed/go-modbus"
+	"github.com/VaccariaSeed/go-modbus/simulator"
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// 测试用的证书颁发机构
+type authority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pool        *x509.CertPool
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	return &authority{certificate: certificate, key: key, pool: pool}
+}
+
+// 签发一张同时可用于服务端和客户端的证书，对127.0.0.1和localhost有效
+func (a *authority) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.certificate, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// 启动一个要求客户端证书的TLS模拟器，返回监听端口
+func serveTLS(t *testing.T, ca *authority) int {
+	t.Helper()
+	sim := simulator.NewSimulator(1)
+	_ = sim.Slave(1).SetHoldingRegisters(0, 42)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "server")}, ClientCAs: ca.pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	go func() { _ = sim.Serve(tls.NewListener(listener, config), statute.FrameTCP) }()
+	t.Cleanup(func() { _ = sim.Close() })
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// 连接并读取一个寄存器，TLS 1.3下服务端拒绝客户端证书的错误在首次读取时返回
+func readOverTLS(t *testing.T, client modbus.Client) ([]byte, error) {
+	t.Cleanup(func() { _ = client.Close() })
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	return client.ReadHoldingRegisters(1, 0, 1)
+}
+
+func TestTLSMutualAuth(t *testing.T) {
+	ca := newAuthority(t, "ca")
+	other := newAuthority(t, "other ca")
+	port := serveTLS(t, ca)
+	tests := []struct {
+		name   string
+		config func() *tls.Config
+		ok     bool
+	}{
+		{
+			name: "mutual auth",
+			config: func() *tls.Config {
+				return &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "client")}, RootCAs: ca.pool}
+			},
+			ok: true,
+		},
+		{
+			name:   "no client certificate",
+			config: func() *tls.Config { return &tls.Config{RootCAs: ca.pool} },
+		},
+		{
+			name: "client certificate from another ca",
+			config: func() *tls.Config {
+				return &tls.Config{Certificates: []tls.Certificate{other.issue(t, "client")}, RootCAs: ca.pool}
+			},
+		},
+		{
+			name: "untrusted server",
+			config: func() *tls.Config {
+				return &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "client")}, RootCAs: other.pool}
+			},
+		},
+		{
+			name: "server name mismatch",
+			config: func() *tls.Config {
+				return &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "client")}, RootCAs: ca.pool, ServerName: "plc.example"}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := modbus.NewModbusTCPPacket("127.0.0.1", port, time.Second, time.Second, time.Second, 0, modbus.ModbusTCP)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.SetTLS(test.config())
+			data, err := readOverTLS(t, client)
+			if !test.ok {
+				if err == nil {
+					t.Fatal("request succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, []byte{0, 42}) {
+				t.Fatalf("data = % x, want 00 2a", data)
+			}
+			if certificate := client.PeerCertificate(); certificate == nil || certificate.Subject.CommonName != "server" {
+				t.Fatalf("PeerCertificate = %v", certificate)
+			}
+		})
+	}
+}
+
+func TestTLSClientURL(t *testing.T) {
+	ca := newAuthority(t, "ca")
+	port := serveTLS(t, ca)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"), filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", ca.certificate.Raw)
+	client := ca.issue(t, "client")
+	writePEM(t, certFile, "CERTIFICATE", client.Certificate[0])
+	key, err := x509.MarshalPKCS8PrivateKey(client.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, keyFile, "PRIVATE KEY", key)
+	tests := []struct {
+		name  string
+		query string
+		ok    bool
+	}{
+		{name: "cert key and ca", query: fmt.Sprintf("cert=%s&key=%s&ca=%s", certFile, keyFile, caFile), ok: true},
+		{name: "without client certificate", query: "ca=" + caFile},
+		{name: "server name mismatch", query: fmt.Sprintf("cert=%s&key=%s&ca=%s&server_name=plc.example", certFile, keyFile, caFile)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := modbus.ParseClientURL(fmt.Sprintf("tls://127.0.0.1:%d?timeout=1s&%s", port, test.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := config.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := readOverTLS(t, client)
+			if test.ok != (err == nil) {
+				t.Fatalf("error = %v, want success %v", err, test.ok)
+			}
+			if test.ok && !bytes.Equal(data, []byte{0, 42}) {
+				t.Fatalf("data = % x, want 00 2a", data)
+			}
+		})
+	}
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+package go_modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// Direction 报文方向
+type Direction string
+
+const (
+	DirectionOutbound Direction = "TX" //发出
+	DirectionInbound  Direction = "RX" //收到
+)
+
+// TraceEvent 一帧报文的追踪信息
+type TraceEvent struct {
+	Time        time.Time   //时间戳
+	Direction   Direction   //方向
+	Transport   string      //传输方式
+	StatuteType StatuteType //协议类型
+	SlaveId     byte        //请求的从站id
+	FuncCode    byte        //请求的功能码
+	Attempt     int         //第几次尝试，从1开始
+	Frame       []byte      //完整的ADU，收到的报文在解码失败时为已读取的部分
+	Err         error       //发送错误或解码结果
+}
+
+// Tracer 报文追踪接口，每发出或收到一帧报文调用一次
+type Tracer interface {
+	Trace(event *TraceEvent)
+}
+
+// TracerFunc 函数形式的Tracer
+type TracerFunc func(event *TraceEvent)
+
+func (f TracerFunc) Trace(event *TraceEvent) {
+	f(event)
+}
+
+// SetTracer 设置报文追踪，传nil关闭追踪
+func (T *ModbusPacket) SetTracer(tracer Tracer) {
+	T.lock.Lock()
+	defer T.lock.Unlock()
+	T.tracer = tracer
+}
+
+// 上报一帧报文
+func (T *ModbusPacket) trace(direction Direction, slaveId, funcCode byte, attempt int, frame []byte, err error) {
+	if T.tracer == nil {
+		return
+	}
+	T.tracer.Trace(&TraceEvent{
+		Time:        time.Now(),
+		Direction:   direction,
+		Transport:   T.transport,
+		StatuteType: T.statuteType,
+		SlaveId:     slaveId,
+		FuncCode:    funcCode,
+		Attempt:     attempt,
+		Frame:       append([]byte(nil), frame...),
+		Err:         err,
+	})
+}
+
+// NewHexDumpTracer 创建一个将报文以带注释的十六进制格式写入w的Tracer
+func NewHexDumpTracer(w io.Writer) Tracer {
+	return &hexDumpTracer{w: w}
+}
+
+type hexDumpTracer struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (h *hexDumpTracer) Trace(event *TraceEvent) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s %s %d bytes", event.Time.Format(time.RFC3339Nano), event.Direction, event.Transport, event.StatuteType, len(event.Frame))
+	if event.Attempt > 1 {
+		fmt.Fprintf(&sb, " attempt %d", event.Attempt)
+	}
+	if event.Err != nil {
+		fmt.Fprintf(&sb, " error: %v", event.Err)
+	}
+	sb.WriteByte('\n')
+	sb.WriteString(HexDump(event.Frame, event.StatuteType))
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, _ = io.WriteString(h.w, sb.String())
+}
+
+// NewSlogTracer 创建一个输出到slog的Tracer，报文以Debug级别记录，出错时以Warn级别记录
+func NewSlogTracer(logger *slog.Logger) Tracer {
+	return TracerFunc(func(event *TraceEvent) {
+		level := slog.LevelDebug
+		attrs := []slog.Attr{
+			slog.String("direction", string(event.Direction)),
+			slog.String("transport", event.Transport),
+			slog.String("statute", string(event.StatuteType)),
+			slog.Int("slave", int(event.SlaveId)),
+			slog.String("function", statute.FuncCodeName(event.FuncCode)),
+			slog.String("frame", hex.EncodeToString(event.Frame)),
+		}
+		if event.Attempt > 1 {
+			attrs = append(attrs, slog.Int("attempt", event.Attempt))
+		}
+		if event.Err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.Any("error", event.Err))
+		}
+		logger.LogAttrs(context.Background(), level, "modbus frame", attrs...)
+	})
+}
+
+// HexDump 生成带字段注释的十六进制报文
+func HexDump(frame []byte, statuteType StatuteType) string {
+	var sb strings.Builder
+	for offset := 0; offset < len(frame); offset += 16 {
+		line := frame[offset:min(offset+16, len(frame))]
+		fmt.Fprintf(&sb, "%04x  ", offset)
+		for index := 0; index < 16; index++ {
+			if index == 8 {
+				sb.WriteByte(' ')
+			}
+			if index < len(line) {
+				fmt.Fprintf(&sb, "%02x ", line[index])
+			} else {
+				sb.WriteString("   ")
+			}
+		}
+		sb.WriteString(" |")
+		for _, b := range line {
+			if b >= 0x20 && b < 0x7F {
+				sb.WriteByte(b)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	if annotation := annotate(frame, statuteType); annotation != "" {
+		sb.WriteString("      " + annotation + "\n")
+	}
+	return sb.String()
+}
+
+// 报文字段注释
+func annotate(frame []byte, statuteType StatuteType) string {
+	switch statuteType {
+	case ModbusTCP:
+		if len(frame) < 8 {
+			return ""
+		}
+		return fmt.Sprintf("tid=0x%04x proto=0x%04x len=%d unit=%d func=0x%02x(%s) data=% x",
+			binary.BigEndian.Uint16(frame[0:2]), binary.BigEndian.Uint16(frame[2:4]), binary.BigEndian.Uint16(frame[4:6]),
+			frame[6], frame[7], statute.FuncCodeName(frame[7]), frame[8:])
+	case ModbusRTU:
+		if len(frame) < 4 {
+			return ""
+		}
+		return fmt.Sprintf("slave=%d func=0x%02x(%s) data=% x crc=%02x%02x",
+			frame[0], frame[1], statute.FuncCodeName(frame[1]), frame[2:len(frame)-2], frame[len(frame)-2], frame[len(frame)-1])
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package go_modbus
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VaccariaSeed/go-modbus/statute"
+)
+
+// 记录所有报文的Tracer
+type recordingTracer struct {
+	lock   sync.Mutex
+	events []*TraceEvent
+}
+
+func (r *recordingTracer) Trace(event *TraceEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingTracer) take() []*TraceEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestTrace(t *testing.T) {
+	request := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	tests := []struct {
+		name     string
+		response []byte
+		inbound  []byte //收到的报文，nil表示没有收到
+		err      error
+	}{
+		{name: "response", response: []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}, inbound: []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B}},
+		{name: "crc error", response: []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x00, 0x00}, inbound: []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x00, 0x00}, err: statute.CsError},
+		{name: "exception", response: []byte{0x01, 0x83, 0x02, 0xC0, 0xF1}, inbound: []byte{0x01, 0x83, 0x02, 0xC0, 0xF1}},
+		{name: "timeout", inbound: []byte{}},
+	}
+	var current []byte
+	var lock sync.Mutex
+	port := serveDevice(t, func([]byte) []byte {
+		lock.Lock()
+		defer lock.Unlock()
+		return current
+	})
+	packet, err := NewModbusTCPPacket("127.0.0.1", port, time.Second, 100*time.Millisecond, time.Second, time.Millisecond, ModbusRTU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = packet.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer packet.Close()
+	tracer := &recordingTracer{}
+	packet.SetTracer(tracer)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lock.Lock()
+			current = test.response
+			lock.Unlock()
+			_, readErr := packet.ReadHoldingRegisters(1, 0, 1)
+			_ = packet.Flush()
+			events := tracer.take()
+			if len(events) != 2 {
+				t.Fatalf("%d events, want 2", len(events))
+			}
+			tx, rx := events[0], events[1]
+			if tx.Direction != DirectionOutbound || !bytes.Equal(tx.Frame, request) || tx.Err != nil {
+				t.Fatalf("outbound event = %+v", tx)
+			}
+			if rx.Direction != DirectionInbound || !bytes.Equal(rx.Frame, test.inbound) {
+				t.Fatalf("inbound frame = % x, want % x", rx.Frame, test.inbound)
+			}
+			//请求返回的错误在追踪到的错误外附加了请求上下文
+			if !errors.Is(readErr, rx.Err) {
+				t.Fatalf("inbound error = %v, want the cause of %v", rx.Err, readErr)
+			}
+			if test.err != nil && !errors.Is(rx.Err, test.err) {
+				t.Fatalf("inbound error = %v, want %v", rx.Err, test.err)
+			}
+			for _, event := range events {
+				if event.Transport != TransportTCP || event.StatuteType != ModbusRTU || event.SlaveId != 1 || event.FuncCode != statute.ReadHoldingRegisters || event.Time.IsZero() {
+					t.Fatalf("event = %+v", event)
+				}
+			}
+		})
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       []byte
+		statuteType StatuteType
+		want        []string
+	}{
+		{
+			name:        "tcp",
+			frame:       []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x01},
+			statuteType: ModbusTCP,
+			want: []string{
+				"0000  00 01 00 00 00 06 01 03  00 00 00 01              |............|",
+				"tid=0x0001 proto=0x0000 len=6 unit=1 func=0x03(",
+			},
+		},
+		{
+			name:        "rtu",
+			frame:       []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B},
+			statuteType: ModbusRTU,
+			want:        []string{"slave=1 func=0x03(", "data=02 00 2a crc=399b"},
+		},
+		{
+			name:        "two lines",
+			frame:       bytes.Repeat([]byte{'A'}, 17),
+			statuteType: ModbusRTU,
+			want:        []string{"|AAAAAAAAAAAAAAAA|\n0010  41 "},
+		},
+		{
+			name:        "too short to annotate",
+			frame:       []byte{0x01},
+			statuteType: ModbusTCP,
+			want:        []string{"0000  01 "},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dump := HexDump(test.frame, test.statuteType)
+			for _, want := range test.want {
+				if !strings.Contains(dump, want) {
+					t.Fatalf("HexDump missing %q:\n%s", want, dump)
+				}
+			}
+		})
+	}
+}
+
+func TestTracers(t *testing.T) {
+	event := &TraceEvent{Time: time.Now(), Direction: DirectionInbound, Transport: TransportSerial, StatuteType: ModbusRTU, SlaveId: 1, FuncCode: 3,
+		Frame: []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x00, 0x00}, Err: statute.CsError}
+	var dump bytes.Buffer
+	NewHexDumpTracer(&dump).Trace(event)
+	if first := strings.SplitN(dump.String(), "\n", 2)[0]; !strings.Contains(first, "RX serial modbusRTU 7 bytes error: crc error") {
+		t.Fatalf("hex dump header = %q", first)
+	}
+	var logs bytes.Buffer
+	tracer := NewSlogTracer(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	tracer.Trace(event)
+	event.Err = nil
+	tracer.Trace(event)
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "level=WARN") || !strings.Contains(lines[1], "level=DEBUG") {
+		t.Fatalf("slog output:\n%s", logs.String())
+	}
+	if !strings.Contains(lines[1], "frame=010302002a0000") || !strings.Contains(lines[0], `error="crc error"`) {
+		t.Fatalf("slog output:\n%s", logs.String())
+	}
+}